@@ -29,3 +29,33 @@ type UserPasswordAuthenticator interface {
 type UserPasswordAuthenticatorFactory interface {
 	New(params []string) (UserPasswordAuthenticator, error)
 }
+
+// EnhancedAuthRequest carries the MQTT 5 Authentication Data of a CONNECT or AUTH packet.
+type EnhancedAuthRequest struct {
+	ClientIdentifier string
+	Username         string
+	AuthMethod       string
+	AuthData         []byte
+	ReAuth           bool // true when the client re-authenticates an established connection
+}
+
+// EnhancedAuthResponse is the result of a single authentication step.
+// ReasonCode is one of v5 Success, ContinueAuthentication or an error reason code (>= 0x80).
+type EnhancedAuthResponse struct {
+	ReasonCode   byte
+	AuthData     []byte
+	ReasonString string
+}
+
+// EnhancedAuthSession holds the state of a challenge / response exchange of a single connection.
+type EnhancedAuthSession interface {
+	Continue(context.Context, *EnhancedAuthRequest) (*EnhancedAuthResponse, error)
+}
+
+// EnhancedAuthenticator implements MQTT 5 enhanced authentication for one Authentication Method.
+type EnhancedAuthenticator interface {
+	Name() string
+	Method() string
+	Start(context.Context, *EnhancedAuthRequest) (EnhancedAuthSession, *EnhancedAuthResponse, error)
+	Close() error
+}
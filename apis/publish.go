@@ -1,6 +1,16 @@
 package apis
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// Publish errors are wrapped by the publishers, so that the clients can be notified with a matching MQTT 5 reason code.
+var (
+	ErrNoRoute         = errors.New("no route for topic") // the MQTT topic is not mapped to a destination
+	ErrQuotaExceeded   = errors.New("quota exceeded")     // the destination cannot accept more messages at the moment
+	ErrMessageRejected = errors.New("message rejected")   // the destination does not accept the message, e.g. it is too large
+)
 
 // PublishID is optional identifier for a particular message assigned by broker
 // It can be complete in case of fire and forget delivery
@@ -23,6 +33,9 @@ type PublishResponse struct {
 
 type PublishCallbackFunc func(*PublishRequest, *PublishResponse)
 
+// Publisher delivers the MQTT messages.
+// The request Message may reference a pooled buffer and is valid only until Publish returns
+// or the PublishAsync callback is invoked, it must be copied to be retained longer.
 type Publisher interface {
 	Name() string
 	Publish(context.Context, *PublishRequest) (*PublishResponse, error)
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/config"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	httpserver "github.com/grepplabs/mqtt-proxy/pkg/server/http"
+	"github.com/oklog/run"
+)
+
+func runAdmin(
+	group *run.Group,
+	logger log.Logger,
+	command string,
+	cfg *config.Admin,
+) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	var call func(ctx context.Context, client *httpserver.AdminClient) (interface{}, error)
+
+	switch command {
+	case "admin disconnect":
+		target := cfg.Disconnect.AdminTarget
+		call = func(ctx context.Context, client *httpserver.AdminClient) (interface{}, error) {
+			return client.Disconnect(ctx, httpserver.DisconnectRequest{ClientID: target.ClientID, Username: target.Username, IP: target.IP})
+		}
+	case "admin ban":
+		kind, value, err := banTarget(cfg.Ban.AdminTarget)
+		if err != nil {
+			return err
+		}
+		req := httpserver.BanRequest{Kind: kind, Value: value, Reason: cfg.Ban.Reason}
+		if cfg.Ban.TTL > 0 {
+			req.TTL = cfg.Ban.TTL.String()
+		}
+		call = func(ctx context.Context, client *httpserver.AdminClient) (interface{}, error) {
+			return client.Ban(ctx, req)
+		}
+	case "admin unban":
+		kind, value, err := banTarget(cfg.Unban.AdminTarget)
+		if err != nil {
+			return err
+		}
+		call = func(ctx context.Context, client *httpserver.AdminClient) (interface{}, error) {
+			return nil, client.Unban(ctx, kind, value)
+		}
+	case "admin bans":
+		call = func(ctx context.Context, client *httpserver.AdminClient) (interface{}, error) {
+			return client.Bans(ctx)
+		}
+	default:
+		return fmt.Errorf("unsupported admin command %s", command)
+	}
+	client := httpserver.NewAdminClient(cfg.URL, cfg.Timeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group.Add(func() error {
+		logger.Debugf("calling admin API %s", cfg.URL)
+
+		result, err := call(ctx, client)
+		if err != nil || result == nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}, func(error) {
+		cancel()
+	})
+	return nil
+}
+
+// banTarget returns the kind and value of the ban, exactly one selector must be set.
+func banTarget(target config.AdminTarget) (kind string, value string, err error) {
+	for _, t := range []struct{ kind, value string }{
+		{ban.KindClientID, target.ClientID},
+		{ban.KindUsername, target.Username},
+		{ban.KindIP, target.IP},
+	} {
+		if t.value == "" {
+			continue
+		}
+		if kind != "" {
+			return "", "", errors.New("only one of --client-id, --username or --ip can be banned at once")
+		}
+		kind, value = t.kind, t.value
+	}
+	if kind == "" {
+		return "", "", errors.New("one of --client-id, --username or --ip is required")
+	}
+	return kind, value, nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/config"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/capture"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/capture/replay"
+	"github.com/oklog/run"
+)
+
+func runReplay(
+	group *run.Group,
+	logger log.Logger,
+	cfg *config.Replay,
+) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	records, err := capture.ReadFile(cfg.File)
+	if err != nil {
+		return fmt.Errorf("read capture: %w", err)
+	}
+
+	opts := []replay.Option{
+		replay.WithTarget(cfg.Target),
+		replay.WithSpeed(cfg.Speed),
+		replay.WithConnections(cfg.Connections),
+		replay.WithLinger(cfg.Linger),
+	}
+	if cfg.Password != "" {
+		opts = append(opts, replay.WithPassword(cfg.Password))
+	}
+	if cfg.TLS.Enable {
+		opts = append(opts, replay.WithTLSConfig(&tls.Config{InsecureSkipVerify: cfg.TLS.InsecureSkipVerify}))
+	}
+	replayer := replay.New(logger, opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group.Add(func() error {
+		logger.Infof("replaying %d records from %s against %s", len(records), cfg.File, cfg.Target)
+
+		results, err := replayer.Replay(ctx, records)
+		for _, result := range results {
+			logger.Infof("connection %d: sent [%s], received [%s], captured responses [%s]", result.Conn,
+				strings.Join(result.Sent, " "), strings.Join(result.Received, " "), strings.Join(result.Expected, " "))
+		}
+		return err
+	}, func(error) {
+		cancel()
+	})
+	return nil
+}
@@ -23,6 +23,8 @@ type setupFunc func(*run.Group, log.Logger, *prometheus.Registry) error
 type CLI struct {
 	LogConfig log.Config    `embed:"" prefix:"log."`
 	Server    config.Server `name:"server" cmd:"" help:"MQTT Proxy"`
+	Replay    config.Replay `name:"replay" cmd:"" help:"Replay a packet capture against a MQTT Proxy"`
+	Admin     config.Admin  `name:"admin" cmd:"" help:"Disconnect and ban clients using the admin API of a MQTT Proxy"`
 	Version   struct{}      `name:"version" cmd:"" help:"Version information"`
 }
 
@@ -42,6 +44,15 @@ func Execute() {
 		cmds[ctx.Command()] = func(group *run.Group, logger log.Logger, registry *prometheus.Registry) error {
 			return runServer(group, logger, registry, &cli.Server)
 		}
+	case "replay <file>":
+		cmds[ctx.Command()] = func(group *run.Group, logger log.Logger, _ *prometheus.Registry) error {
+			return runReplay(group, logger, &cli.Replay)
+		}
+	case "admin disconnect", "admin ban", "admin unban", "admin bans":
+		command := ctx.Command()
+		cmds[command] = func(group *run.Group, logger log.Logger, _ *prometheus.Registry) error {
+			return runAdmin(group, logger, command, &cli.Admin)
+		}
 	case "version":
 		fmt.Println(version.Print("mqtt-proxy"))
 		os.Exit(0)
@@ -5,8 +5,13 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/grepplabs/mqtt-proxy/pkg/config"
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtthandler "github.com/grepplabs/mqtt-proxy/pkg/mqtt/handler"
 	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultServerConfig(t *testing.T) {
@@ -85,3 +90,288 @@ func parseTestCLI(args []string) (*CLI, string, error) {
 	}
 	return testCLI, command.Command(), nil
 }
+
+func TestMaxPacketSizeConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.max-packet-size", "65536",
+		"--mqtt.max-packet-sizes", "PUBLISH=1048576,connect=1024",
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(65536), testCLI.Server.MQTT.MaxPacketSize)
+	require.Equal(t, map[byte]uint32{mqttproto.PUBLISH: 1048576, mqttproto.CONNECT: 1024}, testCLI.Server.MQTT.MaxPacketSizes.Sizes)
+}
+
+func TestStrictConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server", "--mqtt.strict"})
+	require.NoError(t, err)
+	require.True(t, testCLI.Server.MQTT.Strict)
+}
+
+func TestCaptureConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.capture.file", "capture.jsonl",
+		"--mqtt.capture.redact-password",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "capture.jsonl", testCLI.Server.MQTT.Capture.File)
+	require.True(t, testCLI.Server.MQTT.Capture.RedactPassword)
+	require.False(t, testCLI.Server.MQTT.Capture.RedactPayload)
+}
+
+func TestReplayConfig(t *testing.T) {
+	testCLI, command, err := parseTestCLI([]string{
+		"replay", "root_test.go",
+		"--target", "127.0.0.1:1884",
+		"--connections", "1,3",
+		"--speed", "0",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "replay <file>", command)
+	require.True(t, strings.HasSuffix(testCLI.Replay.File, "root_test.go"))
+	require.Equal(t, "127.0.0.1:1884", testCLI.Replay.Target)
+	require.Equal(t, []uint64{1, 3}, testCLI.Replay.Connections)
+	require.Equal(t, float64(0), testCLI.Replay.Speed)
+	require.NoError(t, testCLI.Replay.Validate())
+}
+
+func TestWebSocketConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.websocket.listen-address", "0.0.0.0:8083",
+		"--mqtt.websocket.allowed-origins", "https://a.example.com,https://b.example.com",
+		"--mqtt.websocket.tls",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0:8083", testCLI.Server.MQTT.WebSocket.ListenAddress)
+	require.Equal(t, "/mqtt", testCLI.Server.MQTT.WebSocket.Path)
+	require.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, testCLI.Server.MQTT.WebSocket.AllowedOrigins)
+	require.True(t, testCLI.Server.MQTT.WebSocket.TLS)
+}
+
+func TestListenersConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.listener", "name=secure,address=0.0.0.0:8883,tls=true",
+		"--mqtt.listener", "name=internal,address=127.0.0.1:1884,auth=noop",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []config.Listener{
+		{Name: "secure", Address: "0.0.0.0:8883", TLS: true},
+		{Name: "internal", Address: "127.0.0.1:1884", Auth: "noop"},
+	}, testCLI.Server.MQTT.Listeners.Listeners)
+	require.True(t, testCLI.Server.MQTT.Listeners.UseServerTLS())
+}
+
+func TestProxyProtocolConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.proxy-protocol.enable",
+		"--mqtt.proxy-protocol.trusted", "10.0.0.0/8,192.168.0.0/16",
+	})
+	require.NoError(t, err)
+	require.True(t, testCLI.Server.MQTT.ProxyProtocol.Enable)
+	require.Len(t, testCLI.Server.MQTT.ProxyProtocol.Trusted.IPNets, 2)
+	require.Equal(t, "10.0.0.0/8", testCLI.Server.MQTT.ProxyProtocol.Trusted.IPNets[0].String())
+	require.Equal(t, 5*time.Second, testCLI.Server.MQTT.ProxyProtocol.HeaderTimeout)
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.proxy-protocol.trusted", "10.0.0.1"})
+	require.Error(t, err)
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.proxy-protocol.enable"})
+	require.ErrorContains(t, err, "proxy protocol requires trusted sources")
+}
+
+func TestUnixSocketConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.listen-address", "unix:///run/mqtt-proxy/mqtt.sock",
+		"--mqtt.unix-socket-mode", "0660",
+		"--mqtt.listener", "name=sidecar,network=unix,address=/run/mqtt-proxy/sidecar.sock",
+		"--mqtt.listener", "name=activated,address=systemd://mqtt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "unix:///run/mqtt-proxy/mqtt.sock", testCLI.Server.MQTT.ListenAddress)
+	require.Equal(t, "tcp", testCLI.Server.MQTT.Network)
+	require.Equal(t, os.FileMode(0660), testCLI.Server.MQTT.UnixSocketMode.Mode)
+	require.NoError(t, testCLI.Server.MQTT.Listeners.Validate())
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.unix-socket-mode", "rw"})
+	require.Error(t, err)
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.network", "udp"})
+	require.Error(t, err)
+}
+
+func TestAdminConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.False(t, testCLI.Server.HTTP.Admin.Enable)
+	require.Equal(t, "127.0.0.1:9091", testCLI.Server.HTTP.Admin.ListenAddress)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--http.admin.enable"})
+	require.NoError(t, err)
+	require.True(t, testCLI.Server.HTTP.Admin.Enable)
+}
+
+func TestAdminCommands(t *testing.T) {
+	testCLI, command, err := parseTestCLI([]string{"server", "--mqtt.handler.ban.file", "/var/lib/mqtt-proxy/bans.json"})
+	require.NoError(t, err)
+	require.Equal(t, "server", command)
+	require.Equal(t, "/var/lib/mqtt-proxy/bans.json", testCLI.Server.MQTT.Handler.Ban.File)
+
+	testCLI, command, err = parseTestCLI([]string{"admin", "ban", "--client-id", "sensor-1", "--ttl", "24h", "--reason", "flooding"})
+	require.NoError(t, err)
+	require.Equal(t, "admin ban", command)
+	require.Equal(t, "http://localhost:9091", testCLI.Admin.URL)
+	require.Equal(t, 24*time.Hour, testCLI.Admin.Ban.TTL)
+	require.Equal(t, "flooding", testCLI.Admin.Ban.Reason)
+	kind, value, err := banTarget(testCLI.Admin.Ban.AdminTarget)
+	require.NoError(t, err)
+	require.Equal(t, "client-id", kind)
+	require.Equal(t, "sensor-1", value)
+
+	testCLI, command, err = parseTestCLI([]string{"admin", "--url", "http://mqtt-proxy:9091", "disconnect", "--username", "alice", "--ip", "10.0.0.0/8"})
+	require.NoError(t, err)
+	require.Equal(t, "admin disconnect", command)
+	require.Equal(t, "http://mqtt-proxy:9091", testCLI.Admin.URL)
+	require.Equal(t, config.AdminTarget{Username: "alice", IP: "10.0.0.0/8"}, testCLI.Admin.Disconnect.AdminTarget)
+
+	testCLI, command, err = parseTestCLI([]string{"admin", "unban", "--ip", "192.0.2.1", "--username", "alice"})
+	require.NoError(t, err)
+	require.Equal(t, "admin unban", command)
+	_, _, err = banTarget(testCLI.Admin.Unban.AdminTarget)
+	require.Error(t, err)
+	_, _, err = banTarget(config.AdminTarget{})
+	require.Error(t, err)
+
+	_, command, err = parseTestCLI([]string{"admin", "bans"})
+	require.NoError(t, err)
+	require.Equal(t, "admin bans", command)
+}
+
+func TestKeepAliveConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.handler.keep-alive.min", "10s",
+		"--mqtt.handler.keep-alive.max", "10m",
+		"--mqtt.handler.keep-alive.default", "1m",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, testCLI.Server.MQTT.Handler.KeepAlive.Min)
+	require.Equal(t, 10*time.Minute, testCLI.Server.MQTT.Handler.KeepAlive.Max)
+	require.Equal(t, time.Minute, testCLI.Server.MQTT.Handler.KeepAlive.Default)
+	require.NoError(t, testCLI.Server.Validate())
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.handler.keep-alive.min", "10m", "--mqtt.handler.keep-alive.max", "1m"})
+	require.Error(t, err)
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.handler.keep-alive.max", "24h"})
+	require.Error(t, err)
+}
+
+func TestClientIDPolicyConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.Equal(t, config.ClientIDPolicyTakeover, testCLI.Server.MQTT.ClientIDPolicy)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--mqtt.client-id-policy", "reject-new"})
+	require.NoError(t, err)
+	require.Equal(t, config.ClientIDPolicyRejectNew, testCLI.Server.MQTT.ClientIDPolicy)
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.client-id-policy", "ignore"})
+	require.Error(t, err)
+}
+
+func TestPublishFailurePolicyConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.Equal(t, config.PublishFailurePolicyDrop, testCLI.Server.MQTT.Handler.Publish.FailurePolicy)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--mqtt.handler.publish.failure-policy", "nack"})
+	require.NoError(t, err)
+	require.Equal(t, config.PublishFailurePolicyNack, testCLI.Server.MQTT.Handler.Publish.FailurePolicy)
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.handler.publish.failure-policy", "retry"})
+	require.Error(t, err)
+}
+
+func TestTopicAliasMaximumConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(10), testCLI.Server.MQTT.Handler.TopicAliasMaximum)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--mqtt.handler.topic-alias-maximum", "0"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(0), testCLI.Server.MQTT.Handler.TopicAliasMaximum)
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.handler.topic-alias-maximum", "65536"})
+	require.Error(t, err)
+}
+
+func TestReceiveMaximumConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(100), testCLI.Server.MQTT.ReceiveMaximum)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--mqtt.receive-maximum", "0"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(0), testCLI.Server.MQTT.ReceiveMaximum)
+}
+
+func TestServerReferenceConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	require.Equal(t, "", testCLI.Server.MQTT.ServerReference)
+
+	testCLI, _, err = parseTestCLI([]string{"server", "--mqtt.server-reference", "mqtt-2.example.com:1883"})
+	require.NoError(t, err)
+	require.Equal(t, "mqtt-2.example.com:1883", testCLI.Server.MQTT.ServerReference)
+}
+
+func TestAdmissionConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{
+		"server",
+		"--mqtt.admission.max-connections", "10000",
+		"--mqtt.admission.max-connections-per-ip", "10",
+		"--mqtt.admission.max-connections-per-cidr", "10.0.0.0/8=1000",
+		"--mqtt.admission.accept-rate", "50.5",
+		"--mqtt.admission.accept-burst", "100",
+	})
+	require.NoError(t, err)
+	admission := testCLI.Server.MQTT.Admission
+	require.Equal(t, 10000, admission.MaxConnections)
+	require.Equal(t, 10, admission.MaxConnectionsPerIP)
+	require.Equal(t, 50.5, admission.AcceptRate)
+	require.Equal(t, 100, admission.AcceptBurst)
+
+	limits := cidrConnLimits(admission.MaxConnectionsPerCIDR)
+	require.Len(t, limits, 1)
+	require.Equal(t, "10.0.0.0/8", limits[0].IPNet.String())
+	require.Equal(t, 1000, limits[0].MaxConns)
+}
+
+func TestPublishRateLimitConfig(t *testing.T) {
+	testCLI, _, err := parseTestCLI([]string{"server"})
+	require.NoError(t, err)
+	rateLimit := testCLI.Server.MQTT.Handler.Publish.RateLimit
+	require.Equal(t, config.RateLimitKeyClientID, rateLimit.Key)
+	require.Equal(t, config.RateLimitActionThrottle, rateLimit.Action)
+
+	testCLI, _, err = parseTestCLI([]string{
+		"server",
+		"--mqtt.handler.publish.rate-limit.key", "username",
+		"--mqtt.handler.publish.rate-limit.action", "quota-exceeded",
+		"--mqtt.handler.publish.rate-limit.messages", "100",
+		"--mqtt.handler.publish.rate-limit.bytes", "1048576",
+		"--mqtt.handler.publish.rate-limit.overrides", "alice=1000:0",
+	})
+	require.NoError(t, err)
+	rateLimit = testCLI.Server.MQTT.Handler.Publish.RateLimit
+	require.Equal(t, config.RateLimitKeyUsername, rateLimit.Key)
+	require.Equal(t, config.RateLimitActionQuotaExceeded, rateLimit.Action)
+	require.Equal(t, 100.0, rateLimit.Messages)
+	require.Equal(t, 1048576.0, rateLimit.Bytes)
+	require.Equal(t, map[string]mqtthandler.RateLimit{"alice": {Messages: 1000}}, publishRateLimits(rateLimit.Overrides))
+
+	_, _, err = parseTestCLI([]string{"server", "--mqtt.handler.publish.rate-limit.action", "drop"})
+	require.Error(t, err)
+}
@@ -11,6 +11,8 @@ import (
 	authplain "github.com/grepplabs/mqtt-proxy/pkg/auth/plain"
 	"github.com/grepplabs/mqtt-proxy/pkg/config"
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/capture"
 	mqtthandler "github.com/grepplabs/mqtt-proxy/pkg/mqtt/handler"
 	"github.com/grepplabs/mqtt-proxy/pkg/prober"
 	pubinst "github.com/grepplabs/mqtt-proxy/pkg/publisher/instrument"
@@ -61,32 +63,46 @@ func runServer(
 			srv.Shutdown(err)
 		})
 	}
+	var adminSrv *httpserver.Server
+	if cfg.HTTP.Admin.Enable {
+		logger.Infof("setting up HTTP admin server")
 
-	var authenticator apis.UserPasswordAuthenticator
-	{
-		logger.Infof("setting up authenticator %s", cfg.MQTT.Handler.Authenticator.Name)
-
-		switch cfg.MQTT.Handler.Authenticator.Name {
-		case config.AuthNoop:
-			authenticator = authnoop.New(logger, registry)
-		case config.AuthPlain:
-			authenticator, err = authplain.New(logger, registry,
-				authplain.WithCredentials(cfg.MQTT.Handler.Authenticator.Plain.Credentials),
-				authplain.WithCredentialsFile(cfg.MQTT.Handler.Authenticator.Plain.CredentialsFile),
-			)
-			if err != nil {
-				return fmt.Errorf("setup plain authenticator: %w", err)
-			}
-		default:
-			return fmt.Errorf("unknown authenticator %s", cfg.MQTT.Handler.Authenticator.Name)
-		}
-		authenticator = authinst.New(authenticator, registry)
-		defer func() {
+		srv := httpserver.NewAdmin(logger,
+			httpserver.WithListen(cfg.HTTP.Admin.ListenAddress),
+			httpserver.WithGracePeriod(cfg.HTTP.GracePeriod),
+		)
+		group.Add(func() error {
+			return srv.ListenAndServe()
+		}, func(err error) {
+			srv.Shutdown(err)
+		})
+		adminSrv = srv
+	}
+
+	// authenticators by name, listeners using the same authenticator share the instance
+	authenticators := make(map[string]apis.UserPasswordAuthenticator)
+	defer func() {
+		for _, authenticator := range authenticators {
 			err := authenticator.Close()
 			if err != nil {
 				logger.WithError(err).Warnf("authenticator close failed")
 			}
-		}()
+		}
+	}()
+	getAuthenticator := func(name string) (apis.UserPasswordAuthenticator, error) {
+		if authenticator, ok := authenticators[name]; ok {
+			return authenticator, nil
+		}
+		authenticator, err := newAuthenticator(logger, registry, cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		authenticators[name] = authenticator
+		return authenticator, nil
+	}
+	authenticator, err := getAuthenticator(cfg.MQTT.Handler.Authenticator.Name)
+	if err != nil {
+		return err
 	}
 	var publisher apis.Publisher
 	{
@@ -168,31 +184,46 @@ func runServer(
 		logger.Infof("setting up MQTT server")
 
 		var tlsConfig *tls.Config
-		if cfg.MQTT.TLSSrv.Enable {
-			logger.Infof("enabling server side TLS")
-			var (
-				source tlscert.ServerSource
-				err    error
-			)
-			switch cfg.MQTT.TLSSrv.CertSource {
-			case config.CertSourceFile:
-				source, err = filesource.New(
-					filesource.WithLogger(logger),
-					filesource.WithX509KeyPair(cfg.MQTT.TLSSrv.File.Cert, cfg.MQTT.TLSSrv.File.Key),
-					filesource.WithClientAuthFile(cfg.MQTT.TLSSrv.File.ClientCA),
-					filesource.WithClientCRLFile(cfg.MQTT.TLSSrv.File.ClientCLR),
-					filesource.WithRefresh(cfg.MQTT.TLSSrv.Refresh),
-				)
-				if err != nil {
-					return fmt.Errorf("setup cert file source: %w", err)
+		if cfg.MQTT.TLSSrv.Enable || cfg.MQTT.WebSocket.TLS || cfg.MQTT.Listeners.UseServerTLS() {
+			logger.Infof("setting up server side TLS")
+			tlsConfig, err = newServerTLSConfig(logger, cfg)
+			if err != nil {
+				return err
+			}
+		}
+
+		var listeners []mqttserver.Listener
+		listenerAuthenticators := make(map[string]apis.UserPasswordAuthenticator)
+		for _, l := range cfg.MQTT.Listeners.Listeners {
+			listener := mqttserver.Listener{
+				Name:    l.Name,
+				Network: l.Network,
+				Address: l.Address,
+
+				MaxPacketSize: l.MaxPacketSize,
+			}
+			if l.TLS {
+				listener.TLSConfig = tlsConfig
+				if l.Cert != "" {
+					logger.Infof("setting up TLS of listener %s", l.Name)
+					listener.TLSConfig, err = newListenerTLSConfig(logger, cfg, l)
+					if err != nil {
+						return err
+					}
 				}
-			default:
-				return fmt.Errorf("unknown cert source %s", cfg.MQTT.TLSSrv.CertSource)
 			}
-			tlsConfig, err = servertls.NewServerConfig(logger, source)
-			if err != nil {
-				return fmt.Errorf("setup server TLS config: %w", err)
+			if l.Auth != "" {
+				listenerAuthenticators[l.Name], err = getAuthenticator(l.Auth)
+				if err != nil {
+					return err
+				}
 			}
+			listeners = append(listeners, listener)
+		}
+
+		banList, err := ban.Open(cfg.MQTT.Handler.Ban.File)
+		if err != nil {
+			return fmt.Errorf("setup ban list: %w", err)
 		}
 
 		handler := mqtthandler.New(logger, registry, publisher,
@@ -203,19 +234,79 @@ func runServer(
 			mqtthandler.WithPublishAsyncAtLeastOnce(cfg.MQTT.Handler.Publish.Async.AtLeastOnce),
 			mqtthandler.WithPublishAsyncExactlyOnce(cfg.MQTT.Handler.Publish.Async.ExactlyOnce),
 			mqtthandler.WithAuthenticator(authenticator),
+			mqtthandler.WithListenerAuthenticators(listenerAuthenticators),
+			mqtthandler.WithPublishRateLimit(mqtthandler.RateLimit{
+				Messages: cfg.MQTT.Handler.Publish.RateLimit.Messages,
+				Bytes:    cfg.MQTT.Handler.Publish.RateLimit.Bytes,
+			}),
+			mqtthandler.WithPublishRateLimitKey(cfg.MQTT.Handler.Publish.RateLimit.Key),
+			mqtthandler.WithPublishRateLimitAction(cfg.MQTT.Handler.Publish.RateLimit.Action),
+			mqtthandler.WithPublishRateLimits(publishRateLimits(cfg.MQTT.Handler.Publish.RateLimit.Overrides)),
+			mqtthandler.WithPublishFailurePolicy(cfg.MQTT.Handler.Publish.FailurePolicy),
+			mqtthandler.WithBanList(banList),
+			mqtthandler.WithKeepAliveMin(cfg.MQTT.Handler.KeepAlive.Min),
+			mqtthandler.WithKeepAliveMax(cfg.MQTT.Handler.KeepAlive.Max),
+			mqtthandler.WithKeepAliveDefault(cfg.MQTT.Handler.KeepAlive.Default),
+			mqtthandler.WithTopicAliasMaximum(cfg.MQTT.Handler.TopicAliasMaximum),
 		)
 
-		srv := mqttserver.New(logger, registry, httpProbe,
+		var packetCapture *capture.Capture
+		if cfg.MQTT.Capture.File != "" {
+			logger.Infof("capturing MQTT packets to %s", cfg.MQTT.Capture.File)
+
+			packetCapture, err = capture.NewFile(cfg.MQTT.Capture.File,
+				capture.WithRedactPayload(cfg.MQTT.Capture.RedactPayload),
+				capture.WithRedactPassword(cfg.MQTT.Capture.RedactPassword),
+			)
+			if err != nil {
+				return fmt.Errorf("setup packet capture: %w", err)
+			}
+		}
+
+		serverOpts := []mqttserver.Option{
 			mqttserver.WithListen(cfg.MQTT.ListenAddress),
+			mqttserver.WithNetwork(cfg.MQTT.Network),
+			mqttserver.WithUnixSocketMode(cfg.MQTT.UnixSocketMode.Mode),
 			mqttserver.WithGracePeriod(cfg.MQTT.GracePeriod),
+			mqttserver.WithServerReference(cfg.MQTT.ServerReference),
+			mqttserver.WithClientIDPolicy(cfg.MQTT.ClientIDPolicy),
 			mqttserver.WithReadTimeout(cfg.MQTT.ReadTimeout),
 			mqttserver.WithWriteTimeout(cfg.MQTT.WriteTimeout),
 			mqttserver.WithIdleTimeout(cfg.MQTT.IdleTimeout),
 			mqttserver.WithReaderBufferSize(cfg.MQTT.ReaderBufferSize),
 			mqttserver.WithWriterBufferSize(cfg.MQTT.WriterBufferSize),
+			mqttserver.WithMaxPacketSize(cfg.MQTT.MaxPacketSize),
+			mqttserver.WithMaxPacketSizeByType(cfg.MQTT.MaxPacketSizes.Sizes),
+			mqttserver.WithReceiveMaximum(cfg.MQTT.ReceiveMaximum),
+			mqttserver.WithStrict(cfg.MQTT.Strict),
 			mqttserver.WithHandler(handler),
-			mqttserver.WithTLSConfig(tlsConfig),
-		)
+			mqttserver.WithListeners(listeners),
+			mqttserver.WithProxyProtocol(cfg.MQTT.ProxyProtocol.Enable),
+			mqttserver.WithProxyProtocolTrusted(cfg.MQTT.ProxyProtocol.Trusted.IPNets),
+			mqttserver.WithProxyProtocolHeaderTimeout(cfg.MQTT.ProxyProtocol.HeaderTimeout),
+			mqttserver.WithMaxConnections(cfg.MQTT.Admission.MaxConnections),
+			mqttserver.WithMaxConnectionsPerIP(cfg.MQTT.Admission.MaxConnectionsPerIP),
+			mqttserver.WithMaxConnectionsPerCIDR(cidrConnLimits(cfg.MQTT.Admission.MaxConnectionsPerCIDR)),
+			mqttserver.WithAcceptRate(cfg.MQTT.Admission.AcceptRate),
+			mqttserver.WithAcceptBurst(cfg.MQTT.Admission.AcceptBurst),
+		}
+		if cfg.MQTT.TLSSrv.Enable {
+			serverOpts = append(serverOpts, mqttserver.WithTLSConfig(tlsConfig))
+		}
+		if cfg.MQTT.WebSocket.ListenAddress != "" {
+			serverOpts = append(serverOpts,
+				mqttserver.WithWebSocketListen(cfg.MQTT.WebSocket.ListenAddress),
+				mqttserver.WithWebSocketPath(cfg.MQTT.WebSocket.Path),
+				mqttserver.WithWebSocketAllowedOrigins(cfg.MQTT.WebSocket.AllowedOrigins),
+			)
+			if cfg.MQTT.WebSocket.TLS {
+				serverOpts = append(serverOpts, mqttserver.WithWebSocketTLSConfig(tlsConfig))
+			}
+		}
+		if packetCapture != nil {
+			serverOpts = append(serverOpts, mqttserver.WithCapture(packetCapture))
+		}
+		srv := mqttserver.New(logger, registry, httpProbe, serverOpts...)
 
 		_ = promauto.With(registry).NewGaugeFunc(prometheus.GaugeOpts{
 			Name: "mqtt_proxy_server_connections_active",
@@ -231,6 +322,30 @@ func runServer(
 			return float64(srv.TotalConnections())
 		})
 
+		_ = promauto.With(registry).NewCounterFunc(prometheus.CounterOpts{
+			Name: "mqtt_proxy_server_client_id_conflicts_total",
+			Help: "Total number of connections using the client ID of a connected client.",
+		}, func() float64 {
+			return float64(srv.ClientIDConflicts())
+		})
+
+		if adminSrv != nil {
+			adminSrv.HandleConnections(srv)
+			adminSrv.HandleDisconnect(srv)
+			adminSrv.HandleBans(banList, srv)
+		}
+
+		for _, reason := range mqttserver.RejectReasons {
+			reason := reason
+			_ = promauto.With(registry).NewCounterFunc(prometheus.CounterOpts{
+				Name:        "mqtt_proxy_server_connections_rejected_total",
+				Help:        "Total number of connections rejected by the admission control.",
+				ConstLabels: prometheus.Labels{"reason": reason.String()},
+			}, func() float64 {
+				return float64(srv.RejectedConnections(reason))
+			})
+		}
+
 		group.Add(func() error {
 			httpProbe.Ready()
 			return srv.ListenAndServe()
@@ -238,8 +353,96 @@ func runServer(
 			httpProbe.NotReady(err)
 
 			srv.Shutdown(err)
+			if packetCapture != nil {
+				_ = packetCapture.Close()
+			}
 		})
 	}
 	logger.Infof("starting MQTT server")
 	return nil
 }
+
+func publishRateLimits(limits config.RateLimits) map[string]mqtthandler.RateLimit {
+	result := make(map[string]mqtthandler.RateLimit)
+	for key, l := range limits.Limits {
+		result[key] = mqtthandler.RateLimit{Messages: l.Messages, Bytes: l.Bytes}
+	}
+	return result
+}
+
+func cidrConnLimits(limits config.CIDRLimits) []mqttserver.CIDRConnLimit {
+	var result []mqttserver.CIDRConnLimit
+	for _, l := range limits.Limits {
+		result = append(result, mqttserver.CIDRConnLimit{IPNet: l.IPNet, MaxConns: l.Limit})
+	}
+	return result
+}
+
+func newAuthenticator(logger log.Logger, registry *prometheus.Registry, cfg *config.Server, name string) (apis.UserPasswordAuthenticator, error) {
+	logger.Infof("setting up authenticator %s", name)
+
+	var (
+		authenticator apis.UserPasswordAuthenticator
+		err           error
+	)
+	switch name {
+	case config.AuthNoop:
+		authenticator = authnoop.New(logger, registry)
+	case config.AuthPlain:
+		authenticator, err = authplain.New(logger, registry,
+			authplain.WithCredentials(cfg.MQTT.Handler.Authenticator.Plain.Credentials),
+			authplain.WithCredentialsFile(cfg.MQTT.Handler.Authenticator.Plain.CredentialsFile),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("setup plain authenticator: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown authenticator %s", name)
+	}
+	return authinst.New(authenticator, registry), nil
+}
+
+func newServerTLSConfig(logger log.Logger, cfg *config.Server) (*tls.Config, error) {
+	var (
+		source tlscert.ServerSource
+		err    error
+	)
+	switch cfg.MQTT.TLSSrv.CertSource {
+	case config.CertSourceFile:
+		source, err = filesource.New(
+			filesource.WithLogger(logger),
+			filesource.WithX509KeyPair(cfg.MQTT.TLSSrv.File.Cert, cfg.MQTT.TLSSrv.File.Key),
+			filesource.WithClientAuthFile(cfg.MQTT.TLSSrv.File.ClientCA),
+			filesource.WithClientCRLFile(cfg.MQTT.TLSSrv.File.ClientCLR),
+			filesource.WithRefresh(cfg.MQTT.TLSSrv.Refresh),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("setup cert file source: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown cert source %s", cfg.MQTT.TLSSrv.CertSource)
+	}
+	tlsConfig, err := servertls.NewServerConfig(logger, source)
+	if err != nil {
+		return nil, fmt.Errorf("setup server TLS config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// newListenerTLSConfig creates the TLS config of a listener with its own certificate files.
+func newListenerTLSConfig(logger log.Logger, cfg *config.Server, l config.Listener) (*tls.Config, error) {
+	source, err := filesource.New(
+		filesource.WithLogger(logger),
+		filesource.WithX509KeyPair(l.Cert, l.Key),
+		filesource.WithClientAuthFile(l.ClientCA),
+		filesource.WithRefresh(cfg.MQTT.TLSSrv.Refresh),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("setup cert file source of listener %s: %w", l.Name, err)
+	}
+	tlsConfig, err := servertls.NewServerConfig(logger, source)
+	if err != nil {
+		return nil, fmt.Errorf("setup TLS config of listener %s: %w", l.Name, err)
+	}
+	return tlsConfig, nil
+}
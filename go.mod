@@ -12,6 +12,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sts v1.18.9
 	github.com/confluentinc/confluent-kafka-go/v2 v2.0.2
 	github.com/go-playground/validator/v10 v10.11.1
+	github.com/hashicorp/go-multierror v1.1.1
 	github.com/oklog/run v1.1.0
 	github.com/prometheus/client_golang v1.13.1
 	github.com/prometheus/common v0.37.0
@@ -40,7 +41,6 @@ require (
 	github.com/go-playground/universal-translator v0.18.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
-	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
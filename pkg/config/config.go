@@ -2,14 +2,18 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/go-playground/validator/v10"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 )
 
 // publisher names
@@ -27,6 +31,28 @@ const (
 	AuthPlain = "plain"
 )
 
+// publish rate limit keys and actions
+const (
+	RateLimitKeyClientID         = "client-id"
+	RateLimitKeyUsername         = "username"
+	RateLimitActionThrottle      = "throttle"
+	RateLimitActionQuotaExceeded = "quota-exceeded"
+	RateLimitActionDisconnect    = "disconnect"
+)
+
+// client identifier policies
+const (
+	ClientIDPolicyTakeover  = "takeover"
+	ClientIDPolicyRejectNew = "reject-new"
+)
+
+// publish failure policies
+const (
+	PublishFailurePolicyDrop       = "drop"
+	PublishFailurePolicyNack       = "nack"
+	PublishFailurePolicyDisconnect = "disconnect"
+)
+
 // message format
 const (
 	MessageFormatPlain  = "plain"
@@ -43,16 +69,52 @@ type Server struct {
 	HTTP struct {
 		ListenAddress string        `default:"0.0.0.0:9090" help:"Listen host:port for HTTP endpoints." validate:"required"`
 		GracePeriod   time.Duration `default:"10s" help:"Time to wait after an interrupt received for HTTP Server." validate:"gte=0"`
+		Admin         struct {
+			Enable        bool   `default:"false" help:"Enable the admin API under /admin/, e.g. listing and disconnecting the MQTT connections."`
+			ListenAddress string `default:"127.0.0.1:9091" help:"Listen host:port for the admin API. The API is not authenticated, the address must not be reachable by the clients."`
+		} `embed:"" prefix:"admin."`
 	} `embed:"" prefix:"http."`
 	MQTT struct {
-		ListenAddress    string        `default:"0.0.0.0:1883" help:"Listen host:port for MQTT endpoints." validate:"required"`
-		GracePeriod      time.Duration `default:"10s" help:"Time to wait after an interrupt received for MQTT Server." validate:"gte=0"`
+		ListenAddress    string        `default:"0.0.0.0:1883" help:"Listen host:port, unix:///path/to/socket or systemd://name for MQTT endpoints. systemd:// selects a socket passed by systemd socket activation by its FileDescriptorName or index." validate:"required"`
+		Network          string        `default:"${NetworkDefault}" enum:"${NetworkEnum}" help:"Network of the listen address. One of: [${NetworkEnum}]"`
+		UnixSocketMode   FileMode      `placeholder:"MODE" help:"Octal permissions of the unix domain sockets, e.g. 0660. The umask applies if empty."`
+		GracePeriod      time.Duration `default:"10s" help:"Time to wait after an interrupt received for MQTT Server. The connections are disconnected over the first half of the grace period." validate:"gte=0"`
+		ServerReference  string        `placeholder:"REFERENCE" help:"Server Reference sent to MQTT 5 clients disconnected on shutdown, e.g. other-host:1883."`
+		ClientIDPolicy   string        `default:"${ClientIDPolicyDefault}" enum:"${ClientIDPolicyEnum}" name:"client-id-policy" help:"Policy for a new connection with the client ID of a connected client: takeover disconnects the connected client, reject-new rejects the new one. One of: [${ClientIDPolicyEnum}]"`
 		ReadTimeout      time.Duration `default:"5s" help:"Maximum duration for reading the entire request." validate:"gte=0"`
 		WriteTimeout     time.Duration `default:"5s" help:"Maximum duration before timing out writes of the response." validate:"gte=0"`
 		IdleTimeout      time.Duration `default:"0s" help:"Maximum duration before timing out writes of the response." validate:"gte=0"`
 		ReaderBufferSize int           `default:"1024" help:"Read buffer size pro tcp connection." validate:"gte=0"`
 		WriterBufferSize int           `default:"1024" help:"Write buffer size pro tcp connection." validate:"gte=0"`
-		TLSSrv           struct {
+		MaxPacketSize    uint32        `default:"0" help:"Maximum size of a MQTT packet accepted from clients. 0 means no limit."`
+		MaxPacketSizes   PacketSizes   `placeholder:"MSG=SIZE" help:"Comma separated list of maximum packet sizes per packet type, overrides max-packet-size."`
+		ReceiveMaximum   uint16        `default:"100" help:"Maximum number of QoS 1 and 2 publishes inflight per connection. The connection is not read while the maximum is reached. 0 means no limit."`
+		Strict           bool          `default:"false" help:"Reject packets violating the MQTT specification."`
+		Listeners        Listeners     `name:"listener" placeholder:"KEY=VALUE" help:"Additional MQTT listener, repeat the flag for each listener. Comma separated list of name, address, network, tls, auth, cert, key, client-ca and max-packet-size properties, e.g. name=secure,address=0.0.0.0:8883,tls=true,auth=plain"`
+		Capture          struct {
+			File           string `default:"" help:"File to which the packets exchanged with clients are appended. Empty disables the capture."`
+			RedactPayload  bool   `default:"false" help:"Replace the captured message payloads with zero bytes."`
+			RedactPassword bool   `default:"false" help:"Replace the captured passwords and authentication data with zero bytes."`
+		} `embed:"" prefix:"capture."`
+		ProxyProtocol struct {
+			Enable        bool          `default:"false" help:"Read the PROXY protocol v1/v2 header sent by load balancers on all listeners."`
+			Trusted       CIDRs         `placeholder:"CIDR" help:"Comma separated list of sources allowed to send the PROXY protocol header. The connections from these sources must start with the header. Required if the PROXY protocol is enabled."`
+			HeaderTimeout time.Duration `default:"5s" help:"Maximum duration for reading the PROXY protocol header." validate:"gte=0"`
+		} `embed:"" prefix:"proxy-protocol."`
+		Admission struct {
+			MaxConnections        int        `default:"0" help:"Maximum number of client connections. 0 means no limit." validate:"gte=0"`
+			MaxConnectionsPerIP   int        `default:"0" name:"max-connections-per-ip" help:"Maximum number of connections from a source IP. 0 means no limit." validate:"gte=0"`
+			MaxConnectionsPerCIDR CIDRLimits `name:"max-connections-per-cidr" placeholder:"CIDR=MAX" help:"Comma separated list of maximum number of connections from all sources of a network, e.g. 10.0.0.0/8=1000."`
+			AcceptRate            float64    `default:"0" help:"Maximum number of connections accepted per second. 0 means no limit." validate:"gte=0"`
+			AcceptBurst           int        `default:"0" help:"Maximum number of connections accepted at once. 0 means the accept rate rounded up." validate:"gte=0"`
+		} `embed:"" prefix:"admission."`
+		WebSocket struct {
+			ListenAddress  string   `default:"" help:"Listen host:port for MQTT over WebSocket endpoints. Empty disables the listener."`
+			Path           string   `default:"/mqtt" help:"HTTP path of the MQTT over WebSocket endpoint."`
+			AllowedOrigins []string `placeholder:"ORIGIN" help:"List of origins allowed to connect, * allows any origin. If empty, only the Origin matching the Host is accepted. Requests without Origin are always accepted."`
+			TLS            bool     `default:"false" help:"Enable secure WebSocket using the server-tls certificate source."`
+		} `embed:"" prefix:"websocket."`
+		TLSSrv struct {
 			Enable     bool          `default:"false" help:"Enable server side TLS."`
 			CertSource string        `default:"${CertSourceDefault}" enum:"${CertSourceEnum}" help:"TLS certificate source. One of: [${CertSourceEnum}]"`
 			Refresh    time.Duration `default:"0s" help:"Option to specify the refresh interval for the TLS certificates." validate:"gte=0"`
@@ -73,6 +135,14 @@ type Server struct {
 					AtLeastOnce bool `default:"false" help:"Async publish for AT_LEAST_ONCE QoS."`
 					ExactlyOnce bool `default:"false" help:"Async publish for EXACTLY_ONCE QoS."`
 				} `embed:"" prefix:"async."`
+				RateLimit struct {
+					Key       string     `default:"${RateLimitKeyDefault}" enum:"${RateLimitKeyEnum}" help:"Publish rate limit key. One of: [${RateLimitKeyEnum}]"`
+					Action    string     `default:"${RateLimitActionDefault}" enum:"${RateLimitActionEnum}" help:"Action when a client exceeds the publish rate limit. One of: [${RateLimitActionEnum}]"`
+					Messages  float64    `default:"0" help:"Maximum number of messages per second published by a client. 0 means no limit." validate:"gte=0"`
+					Bytes     float64    `default:"0" help:"Maximum number of payload bytes per second published by a client. 0 means no limit." validate:"gte=0"`
+					Overrides RateLimits `placeholder:"KEY=MESSAGES:BYTES" help:"Comma separated list of publish rate limits by client ID or username overriding the defaults, 0 means no limit."`
+				} `embed:"" prefix:"rate-limit."`
+				FailurePolicy string `default:"${FailurePolicyDefault}" enum:"${FailurePolicyEnum}" help:"Policy when a QoS 1 or QoS 2 message cannot be published. One of: [${FailurePolicyEnum}]"`
 			} `embed:"" prefix:"publish."`
 			Authenticator struct {
 				Name  string `default:"${AuthDefault}" enum:"${AuthEnum}" help:"Authenticator name. One of: [${AuthEnum}]"`
@@ -81,6 +151,15 @@ type Server struct {
 					CredentialsFile string            `default:"" help:"Location of a headerless CSV file containing \"usernanme,password\" records."`
 				} `embed:"" prefix:"plain."`
 			} `embed:"" prefix:"auth."`
+			KeepAlive struct {
+				Min     time.Duration `default:"0s" help:"Minimum keep alive, a lower keep alive of a client is increased. 0 means no minimum." validate:"gte=0,lte=65535s"`
+				Max     time.Duration `default:"0s" help:"Maximum keep alive, a higher or 0 keep alive of a client is decreased. Only keep alive 0 of MQTT 3.1.1 clients is decreased. 0 means no maximum." validate:"gte=0,lte=65535s"`
+				Default time.Duration `default:"0s" help:"Keep alive of the clients sending keep alive 0. 0 means the connections of such clients never time out." validate:"gte=0,lte=65535s"`
+			} `embed:"" prefix:"keep-alive."`
+			Ban struct {
+				File string `default:"" help:"Location of the JSON file storing the bans managed by the admin API. The bans are kept in memory if empty."`
+			} `embed:"" prefix:"ban."`
+			TopicAliasMaximum uint16 `default:"10" help:"Highest topic alias accepted from MQTT 5 clients. 0 means topic aliases are not accepted."`
 		} `embed:"" prefix:"handler."`
 		Publisher struct {
 			Name          string `default:"${PublisherDefault}" enum:"${PublisherEnum}" help:"Publisher name. One of: [${PublisherEnum}]"`
@@ -127,6 +206,61 @@ type Server struct {
 	} `embed:"" prefix:"mqtt."`
 }
 
+type Replay struct {
+	File        string        `arg:"" type:"existingfile" help:"Capture file written by the server with --mqtt.capture.file."`
+	Target      string        `default:"localhost:1883" help:"Host:port of the MQTT proxy to replay the capture against." validate:"required"`
+	Speed       float64       `default:"1" help:"Factor applied to the captured delays, 0 replays without delays." validate:"gte=0"`
+	Connections []uint64      `placeholder:"ID" help:"List of captured connection ids to replay. All connections are replayed if empty."`
+	Password    string        `default:"" help:"Password replacing the captured one, required for captures with redacted passwords."`
+	Linger      time.Duration `default:"1s" help:"Time to wait for responses after the last packet of a connection was sent." validate:"gte=0"`
+	TLS         struct {
+		Enable             bool `default:"false" help:"Connect to the target using TLS."`
+		InsecureSkipVerify bool `default:"false" help:"Skip the verification of the target certificate."`
+	} `embed:"" prefix:"tls."`
+}
+
+func (c *Replay) Validate() error {
+	validate := validator.New()
+	err := validate.Struct(c)
+	if err != nil {
+		return fmt.Errorf("config validation failure: %w", err)
+	}
+	return nil
+}
+
+// AdminTarget selects the clients by client ID, username or IP.
+type AdminTarget struct {
+	ClientID string `name:"client-id" default:"" help:"Client ID."`
+	Username string `default:"" help:"Username."`
+	IP       string `name:"ip" default:"" help:"Source IP address or CIDR network."`
+}
+
+type Admin struct {
+	URL        string        `default:"http://localhost:9091" help:"URL of the HTTP server of the MQTT proxy started with --http.admin.enable." validate:"required"`
+	Timeout    time.Duration `default:"10s" help:"Timeout of the admin API requests." validate:"gt=0"`
+	Disconnect struct {
+		AdminTarget `embed:""`
+	} `cmd:"" help:"Disconnect the clients matching all given selectors."`
+	Ban struct {
+		AdminTarget `embed:""`
+		TTL         time.Duration `name:"ttl" default:"0s" help:"Duration of the ban. 0 means the ban does not expire." validate:"gte=0"`
+		Reason      string        `default:"" help:"Reason of the ban."`
+	} `cmd:"" help:"Ban the clients with the client ID, username or IP and disconnect them."`
+	Unban struct {
+		AdminTarget `embed:""`
+	} `cmd:"" help:"Remove the ban of the client ID, username or IP."`
+	Bans struct{} `cmd:"" help:"List the bans."`
+}
+
+func (c *Admin) Validate() error {
+	validate := validator.New()
+	err := validate.Struct(c)
+	if err != nil {
+		return fmt.Errorf("config validation failure: %w", err)
+	}
+	return nil
+}
+
 func ServerVars() kong.Vars {
 	return map[string]string{
 		"CertSourceDefault":        CertSourceFile,
@@ -139,6 +273,16 @@ func ServerVars() kong.Vars {
 		"PublisherEnum":            strings.Join([]string{PublisherNoop, PublisherKafka, PublisherSQS, PublisherSNS, PublisherRabbitMQ}, ", "),
 		"MessageFormatDefault":     MessageFormatPlain,
 		"MessageFormatEnum":        strings.Join([]string{MessageFormatPlain, MessageFormatBase64, MessageFormatJson}, ", "),
+		"NetworkDefault":           "tcp",
+		"NetworkEnum":              strings.Join([]string{"tcp", "tcp4", "tcp6", "unix"}, ", "),
+		"RateLimitKeyDefault":      RateLimitKeyClientID,
+		"RateLimitKeyEnum":         strings.Join([]string{RateLimitKeyClientID, RateLimitKeyUsername}, ", "),
+		"ClientIDPolicyDefault":    ClientIDPolicyTakeover,
+		"ClientIDPolicyEnum":       strings.Join([]string{ClientIDPolicyTakeover, ClientIDPolicyRejectNew}, ", "),
+		"RateLimitActionDefault":   RateLimitActionThrottle,
+		"RateLimitActionEnum":      strings.Join([]string{RateLimitActionThrottle, RateLimitActionQuotaExceeded, RateLimitActionDisconnect}, ", "),
+		"FailurePolicyDefault":     PublishFailurePolicyDrop,
+		"FailurePolicyEnum":        strings.Join([]string{PublishFailurePolicyDrop, PublishFailurePolicyNack, PublishFailurePolicyDisconnect}, ", "),
 		"RabbitMQSchemeDefault":    "amqp",
 		"RabbitMQSchemeEnum":       strings.Join([]string{"amqp", "amqps"}, ", "),
 		"RabbitMQPassword":         os.Getenv("MQTT_PUBLISHER_RABBITMQ_PASSWORD"),
@@ -155,6 +299,15 @@ func (c *Server) Validate() error {
 	if err != nil {
 		return fmt.Errorf("config validation failure: %w", err)
 	}
+	if err = c.MQTT.Listeners.Validate(); err != nil {
+		return fmt.Errorf("config validation failure: %w", err)
+	}
+	if c.MQTT.ProxyProtocol.Enable && len(c.MQTT.ProxyProtocol.Trusted.IPNets) == 0 {
+		return fmt.Errorf("config validation failure: proxy protocol requires trusted sources")
+	}
+	if keepAlive := c.MQTT.Handler.KeepAlive; keepAlive.Max > 0 && keepAlive.Max < keepAlive.Min {
+		return fmt.Errorf("config validation failure: keep alive max %v is lower than min %v", keepAlive.Max, keepAlive.Min)
+	}
 	return nil
 }
 
@@ -238,3 +391,301 @@ func (c *TopicMappings) String() string {
 func (c *TopicMappings) UnmarshalText(text []byte) error {
 	return c.Set(string(text))
 }
+
+type PacketSizes struct {
+	Sizes map[byte]uint32
+}
+
+func (c *PacketSizes) Set(value string) error {
+	if c.Sizes == nil {
+		c.Sizes = make(map[byte]uint32)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.Split(pair, "=")
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value, but got %s", pair)
+		}
+		k := strings.ToUpper(strings.TrimSpace(kv[0]))
+		v := strings.TrimSpace(kv[1])
+
+		messageType, ok := mqttproto.MqttMessageTypeByName(k)
+		if !ok {
+			return fmt.Errorf("unknown packet type %s", pair)
+		}
+		size, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid packet size '%s': %w", v, err)
+		}
+		c.Sizes[messageType] = uint32(size)
+	}
+	return nil
+}
+
+func (c *PacketSizes) String() string {
+	return fmt.Sprintf("%v", c.Sizes)
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *PacketSizes) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+type CIDRs struct {
+	IPNets []*net.IPNet
+}
+
+func (c *CIDRs) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid CIDR '%s': %w", s, err)
+		}
+		c.IPNets = append(c.IPNets, ipNet)
+	}
+	return nil
+}
+
+func (c *CIDRs) String() string {
+	return fmt.Sprintf("%v", c.IPNets)
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *CIDRs) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// RateLimit is a publish rate limit, 0 means no limit.
+type RateLimit struct {
+	Messages float64
+	Bytes    float64
+}
+
+type RateLimits struct {
+	Limits map[string]RateLimit
+}
+
+func (c *RateLimits) Set(value string) error {
+	if c.Limits == nil {
+		c.Limits = make(map[string]RateLimit)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=messages:bytes, but got %s", pair)
+		}
+		key := strings.TrimSpace(kv[0])
+		limits := strings.SplitN(strings.TrimSpace(kv[1]), ":", 2)
+		if len(limits) != 2 {
+			return fmt.Errorf("expected key=messages:bytes, but got %s", pair)
+		}
+		messages, err := strconv.ParseFloat(limits[0], 64)
+		if err != nil || messages < 0 {
+			return fmt.Errorf("invalid messages rate '%s'", limits[0])
+		}
+		bytes, err := strconv.ParseFloat(limits[1], 64)
+		if err != nil || bytes < 0 {
+			return fmt.Errorf("invalid bytes rate '%s'", limits[1])
+		}
+		c.Limits[key] = RateLimit{Messages: messages, Bytes: bytes}
+	}
+	return nil
+}
+
+func (c *RateLimits) String() string {
+	return fmt.Sprintf("%v", c.Limits)
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *RateLimits) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// CIDRLimit is a limit applied to all sources of a network.
+type CIDRLimit struct {
+	IPNet *net.IPNet
+	Limit int
+}
+
+type CIDRLimits struct {
+	Limits []CIDRLimit
+}
+
+func (c *CIDRLimits) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected CIDR=limit, but got %s", pair)
+		}
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return fmt.Errorf("invalid CIDR '%s': %w", kv[0], err)
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid limit '%s': %w", kv[1], err)
+		}
+		c.Limits = append(c.Limits, CIDRLimit{IPNet: ipNet, Limit: int(limit)})
+	}
+	return nil
+}
+
+func (c *CIDRLimits) String() string {
+	return fmt.Sprintf("%v", c.Limits)
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *CIDRLimits) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// FileMode is a file mode in the octal notation.
+type FileMode struct {
+	Mode os.FileMode
+}
+
+func (c *FileMode) Set(value string) error {
+	if value == "" {
+		c.Mode = 0
+		return nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return fmt.Errorf("invalid file mode '%s'", value)
+	}
+	c.Mode = os.FileMode(mode)
+	return nil
+}
+
+func (c *FileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(c.Mode))
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *FileMode) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// names reserved for the listeners configured by the mqtt.listen-address and mqtt.websocket flags
+var reservedListenerNames = []string{"default", "websocket"}
+
+// Listener is an additional MQTT listener, by default it uses the server TLS certificates and the server authenticator.
+type Listener struct {
+	Name     string
+	Address  string
+	Network  string
+	TLS      bool
+	Auth     string
+	Cert     string
+	Key      string
+	ClientCA string
+
+	MaxPacketSize *uint32 // overrides the server max-packet-size if set
+}
+
+type Listeners struct {
+	Listeners []Listener
+}
+
+// Set parses a single listener.
+func (c *Listeners) Set(value string) error {
+	var l Listener
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value, but got %s", pair)
+		}
+		k := strings.TrimSpace(kv[0])
+		v := strings.TrimSpace(kv[1])
+		switch k {
+		case "name":
+			l.Name = v
+		case "address":
+			l.Address = v
+		case "network":
+			l.Network = v
+		case "tls":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid listener tls '%s': %w", v, err)
+			}
+			l.TLS = b
+		case "auth":
+			l.Auth = v
+		case "cert":
+			l.Cert = v
+		case "key":
+			l.Key = v
+		case "client-ca":
+			l.ClientCA = v
+		case "max-packet-size":
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid listener max-packet-size '%s': %w", v, err)
+			}
+			size := uint32(n)
+			l.MaxPacketSize = &size
+		default:
+			return fmt.Errorf("unknown listener property %s", pair)
+		}
+	}
+	if l.Name == "" {
+		l.Name = l.Address
+	}
+	c.Listeners = append(c.Listeners, l)
+	return nil
+}
+
+func (c *Listeners) String() string {
+	return fmt.Sprintf("%v", c.Listeners)
+}
+
+// UnmarshalText implements Kong encoding.TextUnmarshaler
+func (c *Listeners) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// UseServerTLS reports whether a TLS listener uses the server TLS certificates.
+func (c *Listeners) UseServerTLS() bool {
+	for _, l := range c.Listeners {
+		if l.TLS && l.Cert == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Listeners) Validate() error {
+	names := make(map[string]bool)
+	for _, l := range c.Listeners {
+		if l.Address == "" {
+			return fmt.Errorf("listener %s: address is required", l.Name)
+		}
+		for _, reserved := range reservedListenerNames {
+			if l.Name == reserved {
+				return fmt.Errorf("listener %s: name is reserved", l.Name)
+			}
+		}
+		if names[l.Name] {
+			return fmt.Errorf("listener %s: duplicate name", l.Name)
+		}
+		names[l.Name] = true
+
+		switch l.Network {
+		case "", "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return fmt.Errorf("listener %s: unsupported network %s", l.Name, l.Network)
+		}
+		switch l.Auth {
+		case "", AuthNoop, AuthPlain:
+		default:
+			return fmt.Errorf("listener %s: unknown authenticator %s", l.Name, l.Auth)
+		}
+		if (l.Cert == "") != (l.Key == "") {
+			return fmt.Errorf("listener %s: cert and key must be provided together", l.Name)
+		}
+		if !l.TLS && (l.Cert != "" || l.ClientCA != "") {
+			return fmt.Errorf("listener %s: certificates require tls=true", l.Name)
+		}
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"regexp"
 	"testing"
 	"time"
@@ -94,6 +97,52 @@ func TestTopicMappings(t *testing.T) {
 	}
 }
 
+func TestPacketSizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output PacketSizes
+		err    string
+	}{
+		{
+			name:  "Set parameters",
+			input: "PUBLISH=1048576, subscribe=1024",
+			output: PacketSizes{
+				Sizes: map[byte]uint32{
+					mqttproto.PUBLISH:   1048576,
+					mqttproto.SUBSCRIBE: 1024,
+				},
+			},
+		},
+		{
+			name:   "Unknown packet type",
+			input:  "PUBLISHED=1024",
+			output: PacketSizes{Sizes: map[byte]uint32{}},
+			err:    "unknown packet type PUBLISHED=1024",
+		},
+		{
+			name:   "Invalid size",
+			input:  "PUBLISH=-1",
+			output: PacketSizes{Sizes: map[byte]uint32{}},
+			err:    "invalid packet size '-1': strconv.ParseUint: parsing \"-1\": invalid syntax",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			s := new(Server)
+			err := s.MQTT.MaxPacketSizes.Set(tc.input)
+			if tc.err == "" {
+				a.Nil(err)
+			} else {
+				a.EqualError(err, tc.err)
+			}
+			a.Equal(tc.output, s.MQTT.MaxPacketSizes)
+		})
+	}
+}
+
 func TestConfigValidation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -156,3 +205,230 @@ func TestConfigValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestRateLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output map[string]RateLimit
+		err    string
+	}{
+		{
+			name:  "Set limits",
+			input: "sensor-1=10:65536, admin=0:0",
+			output: map[string]RateLimit{
+				"sensor-1": {Messages: 10, Bytes: 65536},
+				"admin":    {},
+			},
+		},
+		{
+			name:  "Missing bytes",
+			input: "sensor-1=10",
+			err:   "expected key=messages:bytes, but got sensor-1=10",
+		},
+		{
+			name:  "Invalid messages",
+			input: "sensor-1=-1:0",
+			err:   "invalid messages rate '-1'",
+		},
+		{
+			name:  "Invalid bytes",
+			input: "sensor-1=1:1k",
+			err:   "invalid bytes rate '1k'",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			s := new(Server)
+			err := s.MQTT.Handler.Publish.RateLimit.Overrides.Set(tc.input)
+			if tc.err != "" {
+				a.EqualError(err, tc.err)
+				return
+			}
+			a.Nil(err)
+			a.Equal(tc.output, s.MQTT.Handler.Publish.RateLimit.Overrides.Limits)
+		})
+	}
+}
+
+func TestCIDRLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output []string
+		err    string
+	}{
+		{
+			name:   "Set limits",
+			input:  "10.0.0.0/8=1000, 192.168.1.0/24=10",
+			output: []string{"10.0.0.0/8=1000", "192.168.1.0/24=10"},
+		},
+		{
+			name:  "Missing limit",
+			input: "10.0.0.0/8",
+			err:   "expected CIDR=limit, but got 10.0.0.0/8",
+		},
+		{
+			name:  "Invalid CIDR",
+			input: "10.0.0.1=10",
+			err:   "invalid CIDR '10.0.0.1': invalid CIDR address: 10.0.0.1",
+		},
+		{
+			name:  "Invalid limit",
+			input: "10.0.0.0/8=-1",
+			err:   "invalid limit '-1': strconv.ParseUint: parsing \"-1\": invalid syntax",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			s := new(Server)
+			err := s.MQTT.Admission.MaxConnectionsPerCIDR.Set(tc.input)
+			if tc.err != "" {
+				a.EqualError(err, tc.err)
+				return
+			}
+			a.Nil(err)
+			var output []string
+			for _, l := range s.MQTT.Admission.MaxConnectionsPerCIDR.Limits {
+				output = append(output, fmt.Sprintf("%s=%d", l.IPNet, l.Limit))
+			}
+			a.Equal(tc.output, output)
+		})
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output os.FileMode
+		err    string
+	}{
+		{name: "Octal mode", input: "0660", output: 0660},
+		{name: "Without leading zero", input: "600", output: 0600},
+		{name: "Empty", input: "", output: 0},
+		{name: "Invalid digit", input: "0680", err: "invalid file mode '0680'"},
+		{name: "Not a permission", input: "1777", err: "invalid file mode '1777'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			var mode FileMode
+			err := mode.Set(tc.input)
+			if tc.err == "" {
+				a.Nil(err)
+				a.Equal(tc.output, mode.Mode)
+			} else {
+				a.EqualError(err, tc.err)
+			}
+		})
+	}
+}
+
+func TestListeners(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []string
+		output Listeners
+		err    string
+	}{
+		{
+			name:  "Set listeners",
+			input: []string{"address=0.0.0.0:1884", "name=secure, address=0.0.0.0:8883, network=tcp4, tls=true, auth=plain, cert=tls.crt, key=tls.key, client-ca=ca.crt"},
+			output: Listeners{Listeners: []Listener{
+				{Name: "0.0.0.0:1884", Address: "0.0.0.0:1884"},
+				{Name: "secure", Address: "0.0.0.0:8883", Network: "tcp4", TLS: true, Auth: "plain", Cert: "tls.crt", Key: "tls.key", ClientCA: "ca.crt"},
+			}},
+		},
+		{
+			name:  "Unix listener",
+			input: []string{"name=sidecar,network=unix,address=/run/mqtt-proxy/sidecar.sock"},
+			output: Listeners{Listeners: []Listener{
+				{Name: "sidecar", Address: "/run/mqtt-proxy/sidecar.sock", Network: "unix"},
+			}},
+		},
+		{
+			name:  "Max packet size",
+			input: []string{"name=internal,address=127.0.0.1:1884,max-packet-size=1024"},
+			output: Listeners{Listeners: []Listener{
+				{Name: "internal", Address: "127.0.0.1:1884", MaxPacketSize: uint32Ptr(1024)},
+			}},
+		},
+		{
+			name:  "Invalid max packet size",
+			input: []string{"address=0.0.0.0:1884,max-packet-size=-1"},
+			err:   "invalid listener max-packet-size '-1': strconv.ParseUint: parsing \"-1\": invalid syntax",
+		},
+		{
+			name:  "Unsupported network",
+			input: []string{"address=0.0.0.0:1884,network=udp"},
+			err:   "listener 0.0.0.0:1884: unsupported network udp",
+		},
+		{
+			name:  "Unknown property",
+			input: []string{"address=0.0.0.0:1884,port=1884"},
+			err:   "unknown listener property port=1884",
+		},
+		{
+			name:  "Invalid tls",
+			input: []string{"address=0.0.0.0:1884,tls=yes"},
+			err:   "invalid listener tls 'yes': strconv.ParseBool: parsing \"yes\": invalid syntax",
+		},
+		{
+			name:  "Missing address",
+			input: []string{"name=internal"},
+			err:   "listener internal: address is required",
+		},
+		{
+			name:  "Reserved name",
+			input: []string{"name=default,address=0.0.0.0:1884"},
+			err:   "listener default: name is reserved",
+		},
+		{
+			name:  "Duplicate name",
+			input: []string{"name=internal,address=0.0.0.0:1884", "name=internal,address=0.0.0.0:1885"},
+			err:   "listener internal: duplicate name",
+		},
+		{
+			name:  "Unknown authenticator",
+			input: []string{"address=0.0.0.0:1884,auth=ldap"},
+			err:   "listener 0.0.0.0:1884: unknown authenticator ldap",
+		},
+		{
+			name:  "Certificates without TLS",
+			input: []string{"address=0.0.0.0:1884,cert=tls.crt,key=tls.key"},
+			err:   "listener 0.0.0.0:1884: certificates require tls=true",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			s := new(Server)
+			var err error
+			for _, input := range tc.input {
+				if err = s.MQTT.Listeners.Set(input); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = s.MQTT.Listeners.Validate()
+			}
+			if tc.err == "" {
+				a.Nil(err)
+				a.Equal(tc.output, s.MQTT.Listeners)
+			} else {
+				a.EqualError(err, tc.err)
+			}
+		})
+	}
+}
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
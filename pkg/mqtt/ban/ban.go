@@ -0,0 +1,253 @@
+package ban
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// kinds of ban entries
+const (
+	KindClientID = "client-id"
+	KindUsername = "username"
+	KindIP       = "ip" // an IP address or a CIDR network
+)
+
+// Kinds lists the kinds of ban entries.
+var Kinds = []string{KindClientID, KindUsername, KindIP}
+
+// Entry bans the clients with the client ID, username or source IP.
+type Entry struct {
+	Kind    string     `json:"kind"`
+	Value   string     `json:"value"`
+	Reason  string     `json:"reason,omitempty"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"` // nil when the ban does not expire
+}
+
+// Validate checks the kind and the value of the entry.
+func (e Entry) Validate() error {
+	switch e.Kind {
+	case KindClientID, KindUsername:
+		if e.Value == "" {
+			return fmt.Errorf("ban: empty %s", e.Kind)
+		}
+	case KindIP:
+		if _, err := parseIPNet(e.Value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("ban: unsupported kind '%s'", e.Kind)
+	}
+	return nil
+}
+
+// Match reports whether the entry bans the client, ip can be nil. The expiration is not checked.
+func (e Entry) Match(clientID string, username string, ip net.IP) bool {
+	switch e.Kind {
+	case KindClientID:
+		return clientID != "" && clientID == e.Value
+	case KindUsername:
+		return username != "" && username == e.Value
+	case KindIP:
+		ipNet, err := parseIPNet(e.Value)
+		return err == nil && ip != nil && ipNet.Contains(ip)
+	default:
+		return false
+	}
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return e.Expires != nil && !now.Before(*e.Expires)
+}
+
+type key struct {
+	kind  string
+	value string
+}
+
+// List keeps the ban entries. When the list has a file, the entries are stored in the file on every change
+// and loaded on start, so that the bans survive restarts. Expired entries are ignored and dropped on the next change.
+type List struct {
+	path string
+
+	mu      sync.RWMutex
+	entries map[key]Entry
+	ipNets  map[key]*net.IPNet
+}
+
+// Open creates the list backed by the file at path, the list is kept in memory only if path is empty.
+// A missing file is created on the first change.
+func Open(path string) (*List, error) {
+	l := &List{
+		path:    path,
+		entries: make(map[key]Entry),
+		ipNets:  make(map[key]*net.IPNet),
+	}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ban: read %s: %w", path, err)
+	}
+	var entries []Entry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("ban: decode %s: %w", path, err)
+	}
+	for _, e := range entries {
+		if err = e.Validate(); err != nil {
+			return nil, fmt.Errorf("ban: invalid entry in %s: %w", path, err)
+		}
+		l.put(e)
+	}
+	return l, nil
+}
+
+func (l *List) put(e Entry) {
+	k := key{kind: e.Kind, value: e.Value}
+	l.entries[k] = e
+	if e.Kind == KindIP {
+		l.ipNets[k], _ = parseIPNet(e.Value)
+	}
+}
+
+// Add adds or replaces the entry.
+func (l *List) Add(e Entry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.put(e)
+	return l.saveLocked()
+}
+
+// Remove removes the entry and reports whether it was found.
+func (l *List) Remove(kind string, value string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := key{kind: kind, value: value}
+	if _, ok := l.entries[k]; !ok {
+		return false, nil
+	}
+	delete(l.entries, k)
+	delete(l.ipNets, k)
+	return true, l.saveLocked()
+}
+
+// Entries provides the entries which are not expired ordered by kind and value.
+func (l *List) Entries() []Entry {
+	now := time.Now()
+	l.mu.RLock()
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	l.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Value < entries[j].Value
+	})
+	return entries
+}
+
+// Banned returns the entry banning the client, ip can be nil.
+func (l *List) Banned(clientID string, username string, ip net.IP) (Entry, bool) {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.entries) == 0 {
+		return Entry{}, false
+	}
+	if e, ok := l.entries[key{kind: KindClientID, value: clientID}]; ok && clientID != "" && !e.expired(now) {
+		return e, true
+	}
+	if e, ok := l.entries[key{kind: KindUsername, value: username}]; ok && username != "" && !e.expired(now) {
+		return e, true
+	}
+	if ip != nil {
+		for k, ipNet := range l.ipNets {
+			if e := l.entries[k]; ipNet.Contains(ip) && !e.expired(now) {
+				return e, true
+			}
+		}
+	}
+	return Entry{}, false
+}
+
+// saveLocked drops the expired entries and writes the file atomically.
+func (l *List) saveLocked() error {
+	now := time.Now()
+	entries := make([]Entry, 0, len(l.entries))
+	for k, e := range l.entries {
+		if e.expired(now) {
+			delete(l.entries, k)
+			delete(l.ipNets, k)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if l.path == "" {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("ban: write %s: %w", l.path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("ban: write %s: %w", l.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("ban: write %s: %w", l.path, err)
+	}
+	if err = os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("ban: write %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// parseIPNet parses an IP address or a CIDR network.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("ban: invalid IP or CIDR '%s'", s)
+	}
+	return ipNet, nil
+}
@@ -0,0 +1,99 @@
+package ban
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanned(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	l, err := Open("")
+	require.NoError(t, err)
+	require.NoError(t, l.Add(Entry{Kind: KindClientID, Value: "sensor-1"}))
+	require.NoError(t, l.Add(Entry{Kind: KindUsername, Value: "mallory", Expires: &future}))
+	require.NoError(t, l.Add(Entry{Kind: KindUsername, Value: "bob", Expires: &past}))
+	require.NoError(t, l.Add(Entry{Kind: KindIP, Value: "192.0.2.1"}))
+	require.NoError(t, l.Add(Entry{Kind: KindIP, Value: "10.0.0.0/8"}))
+
+	tests := []struct {
+		name     string
+		clientID string
+		username string
+		ip       string
+		banned   string
+	}{
+		{name: "client id", clientID: "sensor-1", username: "alice", ip: "192.0.2.2", banned: "sensor-1"},
+		{name: "username", clientID: "sensor-2", username: "mallory", banned: "mallory"},
+		{name: "expired", clientID: "sensor-2", username: "bob"},
+		{name: "ip", clientID: "sensor-2", ip: "192.0.2.1", banned: "192.0.2.1"},
+		{name: "cidr", clientID: "sensor-2", ip: "10.1.2.3", banned: "10.0.0.0/8"},
+		{name: "empty client id", clientID: "", username: "alice", ip: "192.0.2.2"},
+		{name: "not banned", clientID: "sensor-2", username: "alice", ip: "192.0.2.2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, banned := l.Banned(tc.clientID, tc.username, net.ParseIP(tc.ip))
+			assert.Equal(t, tc.banned != "", banned)
+			assert.Equal(t, tc.banned, entry.Value)
+		})
+	}
+	assert.Len(t, l.Entries(), 4)
+}
+
+func TestEntryValidate(t *testing.T) {
+	assert.NoError(t, Entry{Kind: KindIP, Value: "2001:db8::1"}.Validate())
+	assert.NoError(t, Entry{Kind: KindIP, Value: "2001:db8::/32"}.Validate())
+	assert.Error(t, Entry{Kind: KindIP, Value: "host"}.Validate())
+	assert.Error(t, Entry{Kind: KindClientID, Value: ""}.Validate())
+	assert.Error(t, Entry{Kind: "topic", Value: "a/b"}.Validate())
+}
+
+func TestListFile(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "bans.json")
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	l, err := Open(path)
+	require.NoError(t, err)
+	a.Empty(l.Entries())
+	require.NoError(t, l.Add(Entry{Kind: KindClientID, Value: "sensor-1", Reason: "flooding"}))
+	require.NoError(t, l.Add(Entry{Kind: KindIP, Value: "192.0.2.0/24", Expires: &future}))
+	require.NoError(t, l.Add(Entry{Kind: KindUsername, Value: "bob", Expires: &past}))
+
+	// the bans survive a restart, expired entries are dropped
+	l, err = Open(path)
+	require.NoError(t, err)
+	entries := l.Entries()
+	require.Len(t, entries, 2)
+	a.Equal("sensor-1", entries[0].Value)
+	a.Equal("flooding", entries[0].Reason)
+	a.Nil(entries[0].Expires)
+	a.Equal("192.0.2.0/24", entries[1].Value)
+	a.True(future.Equal(*entries[1].Expires))
+	_, banned := l.Banned("", "", net.ParseIP("192.0.2.7"))
+	a.True(banned)
+
+	found, err := l.Remove(KindClientID, "sensor-1")
+	require.NoError(t, err)
+	a.True(found)
+	found, err = l.Remove(KindClientID, "sensor-1")
+	require.NoError(t, err)
+	a.False(found)
+
+	l, err = Open(path)
+	require.NoError(t, err)
+	a.Len(l.Entries(), 1)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"kind":"ip","value":"host"}]`), 0600))
+	_, err = Open(path)
+	a.Error(err)
+}
@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	mqttcodec "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// capture record events
+const (
+	EventOpen     = "open"
+	EventReceived = "received"
+	EventSent     = "sent"
+	EventClose    = "close"
+)
+
+// Record is a single line of a capture file.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Conn    uint64    `json:"conn"`
+	Event   string    `json:"event"`
+	Remote  string    `json:"remote,omitempty"`
+	Version byte      `json:"version,omitempty"`
+	Type    string    `json:"type,omitempty"`
+	Packet  string    `json:"packet,omitempty"`
+	Data    []byte    `json:"data,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Capture writes the packets of all connections as JSON lines.
+type Capture struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+
+	connID atomic.Uint64
+	opts   options
+}
+
+var _ mqttserver.Capture = (*Capture)(nil)
+
+func New(w io.Writer, opts ...Option) *Capture {
+	options := options{}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	return &Capture{
+		w:    bufio.NewWriter(w),
+		opts: options,
+	}
+}
+
+// NewFile creates a capture appending to the file.
+func NewFile(name string, opts ...Option) (*Capture, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	c := New(f, opts...)
+	c.closer = f
+	return c, nil
+}
+
+func (c *Capture) NewConn(rwc net.Conn) mqttserver.ConnCapture {
+	cc := &connCapture{
+		capture: c,
+		id:      c.connID.Inc(),
+	}
+	c.write(&Record{Time: time.Now(), Conn: cc.id, Event: EventOpen, Remote: rwc.RemoteAddr().String()})
+	return cc
+}
+
+// Close flushes the records and closes the underlying file.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.w.Flush()
+	if c.closer != nil {
+		if cerr := c.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (c *Capture) write(record *Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _ = c.w.Write(data)
+	_ = c.w.WriteByte('\n')
+	// records are flushed at once, so the capture is complete even if the proxy crashes
+	_ = c.w.Flush()
+}
+
+type connCapture struct {
+	capture *Capture
+	id      uint64
+	version atomic.Uint32 // protocol version of the connection, 0 until CONNECT is received
+}
+
+func (cc *connCapture) Received(b []byte, err error) {
+	record := cc.newRecord(EventReceived, b)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if record.Type == "CONNECT" {
+		cc.version.Store(uint32(record.Version))
+	}
+	cc.capture.write(record)
+}
+
+func (cc *connCapture) Sent(b []byte) {
+	cc.capture.write(cc.newRecord(EventSent, b))
+}
+
+func (cc *connCapture) Close() {
+	cc.capture.write(&Record{Time: time.Now(), Conn: cc.id, Event: EventClose})
+}
+
+// newRecord decodes a copy of the packet, the packet handled by the server is never modified.
+func (cc *connCapture) newRecord(event string, b []byte) *Record {
+	record := &Record{Time: time.Now(), Conn: cc.id, Event: event}
+
+	packet, err := mqttcodec.ReadPacket(bytes.NewReader(b), byte(cc.version.Load()))
+	if err != nil {
+		if !cc.capture.opts.redacted() {
+			// undecodable bytes are kept only when nothing has to be redacted
+			record.Data = append([]byte(nil), b...)
+		}
+		record.Error = err.Error()
+		return record
+	}
+	record.Version = packet.Version()
+	record.Type = packet.Name()
+
+	if redact(packet, cc.capture.opts) {
+		var buf bytes.Buffer
+		if err = packet.Write(&buf); err != nil {
+			record.Error = err.Error()
+			return record
+		}
+		record.Data = buf.Bytes()
+	} else {
+		record.Data = append([]byte(nil), b...)
+	}
+	record.Packet = packet.String()
+	return record
+}
+
+// ReadRecords reads all records of a capture.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// ReadFile reads all records of a capture file.
+func ReadFile(name string) ([]Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecords(f)
+}
@@ -0,0 +1,163 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttcodec "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtthandler "github.com/grepplabs/mqtt-proxy/pkg/mqtt/handler"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+// syncBuffer is written by the server and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func serveCaptured(t *testing.T, c *Capture) net.Addr {
+	logger := log.NewDefaultLogger()
+	registry := prometheus.NewRegistry()
+	srv := &mqttserver.Server{
+		Handler:  mqtthandler.New(logger, registry, noop.New(logger, registry)),
+		ErrorLog: logger,
+		Capture:  c,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr()
+}
+
+func runSession(t *testing.T, addr net.Addr) {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+	connect.ProtocolName = mqttproto.MQTT
+	connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+	connect.ClientIdentifier = "device-1"
+	connect.HasUsername = true
+	connect.Username = "alice"
+	connect.HasPassword = true
+	connect.Password = []byte("secret")
+	require.NoError(t, connect.Write(conn))
+	_, err = mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+
+	publish := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+	publish.Qos = mqttproto.AT_LEAST_ONCE
+	publish.MessageID = 7
+	publish.TopicName = "dummy"
+	publish.Message = []byte("temperature=21")
+	require.NoError(t, publish.Write(conn))
+	_, err = mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+
+	require.NoError(t, mqtt311.NewControlPacket(mqttproto.DISCONNECT).Write(conn))
+}
+
+func waitForRecords(t *testing.T, buf *syncBuffer, event string) []Record {
+	var records []Record
+	require.Eventually(t, func() bool {
+		var err error
+		records, err = ReadRecords(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		return len(records) > 0 && records[len(records)-1].Event == event
+	}, 5*time.Second, 10*time.Millisecond)
+	return records
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             []Option
+		expectedPassword []byte
+		expectedMessage  []byte
+	}{
+		{
+			name:             "plain",
+			expectedPassword: []byte("secret"),
+			expectedMessage:  []byte("temperature=21"),
+		},
+		{
+			name:             "redacted",
+			opts:             []Option{WithRedactPayload(true), WithRedactPassword(true)},
+			expectedPassword: make([]byte, 6),
+			expectedMessage:  make([]byte, 14),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			buf := &syncBuffer{}
+			runSession(t, serveCaptured(t, New(buf, tc.opts...)))
+
+			records := waitForRecords(t, buf, EventClose)
+			var events []string
+			for _, record := range records {
+				a.Equal(uint64(1), record.Conn)
+				events = append(events, record.Event+" "+record.Type)
+			}
+			a.Equal([]string{"open ", "received CONNECT", "sent CONNACK", "received PUBLISH", "sent PUBACK", "received DISCONNECT", "close "}, events)
+			a.NotEmpty(records[0].Remote)
+
+			connect, err := mqttcodec.ReadPacket(bytes.NewReader(records[1].Data), 0)
+			require.NoError(t, err)
+			a.Equal(mqttproto.MQTT_3_1_1, records[1].Version)
+			a.Equal("alice", connect.(*mqtt311.ConnectPacket).Username)
+			a.Equal(tc.expectedPassword, connect.(*mqtt311.ConnectPacket).Password)
+
+			publish, err := mqttcodec.ReadPacket(bytes.NewReader(records[3].Data), mqttproto.MQTT_3_1_1)
+			require.NoError(t, err)
+			a.Equal(tc.expectedMessage, publish.(*mqtt311.PublishPacket).Message)
+			a.Equal(uint16(7), publish.(*mqtt311.PublishPacket).MessageID)
+		})
+	}
+}
+
+func TestCaptureMalformedPacket(t *testing.T) {
+	a := assert.New(t)
+	buf := &syncBuffer{}
+	addr := serveCaptured(t, New(buf))
+
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	// PUBLISH before CONNECT
+	_, err = conn.Write([]byte{0x30, 0x03, 0x00, 0x01, 'a'})
+	require.NoError(t, err)
+
+	records := waitForRecords(t, buf, EventClose)
+	require.Len(t, records, 3)
+	a.Equal(EventReceived, records[1].Event)
+	// the server stops reading at the fixed header
+	a.Equal([]byte{0x30, 0x03}, records[1].Data)
+	a.Equal("expected CONNECT packet but got type 0x3", records[1].Error)
+}
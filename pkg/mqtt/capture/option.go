@@ -0,0 +1,34 @@
+package capture
+
+type options struct {
+	redactPayload  bool
+	redactPassword bool
+}
+
+func (o options) redacted() bool {
+	return o.redactPayload || o.redactPassword
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithRedactPayload replaces PUBLISH and will payloads with zero bytes of the same length.
+func WithRedactPayload(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.redactPayload = b
+	})
+}
+
+// WithRedactPassword replaces CONNECT passwords and authentication data with zero bytes of the same length.
+func WithRedactPassword(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.redactPassword = b
+	})
+}
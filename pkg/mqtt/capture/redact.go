@@ -0,0 +1,53 @@
+package capture
+
+import (
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+// redact clears the sensitive fields of the packet, it returns true if the packet was modified.
+func redact(packet mqttproto.ControlPacket, opts options) bool {
+	modified := false
+	zero := func(b []byte) []byte {
+		if len(b) == 0 {
+			return b
+		}
+		modified = true
+		return make([]byte, len(b))
+	}
+	switch p := packet.(type) {
+	case *mqtt311.ConnectPacket:
+		if opts.redactPassword {
+			p.Password = zero(p.Password)
+		}
+		if opts.redactPayload {
+			p.WillMessage = zero(p.WillMessage)
+		}
+	case *mqtt311.PublishPacket:
+		if opts.redactPayload {
+			p.Message = zero(p.Message)
+		}
+	case *mqtt5.ConnectPacket:
+		if opts.redactPassword {
+			p.Password = zero(p.Password)
+			p.ConnectProperties.AuthenticationData = zero(p.ConnectProperties.AuthenticationData)
+		}
+		if opts.redactPayload {
+			p.WillPayload = zero(p.WillPayload)
+		}
+	case *mqtt5.ConnackPacket:
+		if opts.redactPassword {
+			p.ConnackProperties.AuthenticationData = zero(p.ConnackProperties.AuthenticationData)
+		}
+	case *mqtt5.AuthPacket:
+		if opts.redactPassword {
+			p.AuthProperties.AuthenticationData = zero(p.AuthProperties.AuthenticationData)
+		}
+	case *mqtt5.PublishPacket:
+		if opts.redactPayload {
+			p.Message = zero(p.Message)
+		}
+	}
+	return modified
+}
@@ -0,0 +1,79 @@
+package replay
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type options struct {
+	network     string
+	target      string
+	tlsConfig   *tls.Config
+	speed       float64
+	connections map[uint64]bool
+	password    *string
+	linger      time.Duration
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+func WithNetwork(s string) Option {
+	return optionFunc(func(o *options) {
+		o.network = s
+	})
+}
+
+func WithTarget(s string) Option {
+	return optionFunc(func(o *options) {
+		o.target = s
+	})
+}
+
+func WithTLSConfig(cfg *tls.Config) Option {
+	return optionFunc(func(o *options) {
+		o.tlsConfig = cfg
+	})
+}
+
+// WithSpeed scales the captured delays between packets, 0 replays without delays.
+func WithSpeed(f float64) Option {
+	return optionFunc(func(o *options) {
+		o.speed = f
+	})
+}
+
+// WithConnections restricts the replay to the captured connections with the given ids.
+func WithConnections(ids []uint64) Option {
+	return optionFunc(func(o *options) {
+		if len(ids) == 0 {
+			o.connections = nil
+			return
+		}
+		o.connections = make(map[uint64]bool)
+		for _, id := range ids {
+			o.connections[id] = true
+		}
+	})
+}
+
+// WithPassword replaces the password of the captured CONNECT packets, which is required for redacted captures.
+func WithPassword(s string) Option {
+	return optionFunc(func(o *options) {
+		o.password = &s
+	})
+}
+
+// WithLinger sets how long to wait for responses after the last packet of a connection was sent.
+func WithLinger(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.linger = d
+	})
+}
@@ -0,0 +1,242 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/capture"
+	mqttcodec "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+// Replayer sends the packets received by a proxy, as recorded in a capture, to a running proxy.
+type Replayer struct {
+	logger log.Logger
+	opts   options
+}
+
+// Result summarizes the replay of a single captured connection.
+type Result struct {
+	Conn     uint64
+	Sent     []string // names of the packets sent to the target
+	Received []string // names of the packets received from the target
+	Expected []string // names of the packets sent by the proxy when captured
+	Err      error
+}
+
+func New(logger log.Logger, opts ...Option) *Replayer {
+	options := options{
+		network: "tcp",
+		target:  "localhost:1883",
+		speed:   1,
+		linger:  time.Second,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	return &Replayer{
+		logger: logger.WithField("service", "mqtt/replay"),
+		opts:   options,
+	}
+}
+
+// Replay replays all connections of the capture concurrently, preserving their relative start times.
+func (r *Replayer) Replay(ctx context.Context, records []capture.Record) ([]*Result, error) {
+	conns := r.groupByConn(records)
+	if len(conns) == 0 {
+		return nil, errors.New("no connections to replay")
+	}
+	start := conns[0].records[0].Time
+
+	results := make([]*Result, len(conns))
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(1)
+		go func(i int, c *capturedConn) {
+			defer wg.Done()
+			results[i] = r.replayConn(ctx, c, r.delay(start, c.records[0].Time))
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Err != nil {
+			return results, fmt.Errorf("replay of connection %d failed: %w", result.Conn, result.Err)
+		}
+	}
+	return results, nil
+}
+
+type capturedConn struct {
+	id      uint64
+	version byte
+	records []capture.Record
+}
+
+func (r *Replayer) groupByConn(records []capture.Record) []*capturedConn {
+	var conns []*capturedConn
+	byID := make(map[uint64]*capturedConn)
+	for _, record := range records {
+		if r.opts.connections != nil && !r.opts.connections[record.Conn] {
+			continue
+		}
+		c, ok := byID[record.Conn]
+		if !ok {
+			c = &capturedConn{id: record.Conn}
+			byID[record.Conn] = c
+			conns = append(conns, c)
+		}
+		if c.version == 0 && record.Event == capture.EventReceived && record.Type == "CONNECT" {
+			c.version = record.Version
+		}
+		c.records = append(c.records, record)
+	}
+	for _, c := range conns {
+		if c.version == 0 {
+			// the responses are decoded as MQTT 3.1.1 if the CONNECT was not captured
+			c.version = mqttproto.MQTT_3_1_1
+		}
+	}
+	return conns
+}
+
+func (r *Replayer) delay(from time.Time, to time.Time) time.Duration {
+	if r.opts.speed <= 0 || !to.After(from) {
+		return 0
+	}
+	return time.Duration(float64(to.Sub(from)) / r.opts.speed)
+}
+
+func (r *Replayer) replayConn(ctx context.Context, c *capturedConn, startDelay time.Duration) *Result {
+	result := &Result{Conn: c.id}
+	logger := r.logger.WithField("conn", fmt.Sprintf("%d", c.id))
+
+	if err := sleep(ctx, startDelay); err != nil {
+		result.Err = err
+		return result
+	}
+	conn, err := r.dial(ctx)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+
+	var mu sync.Mutex
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			packet, err := mqttcodec.ReadPacket(conn, c.version)
+			if err != nil {
+				return
+			}
+			logger.Infof("Received %v", packet)
+			mu.Lock()
+			result.Received = append(result.Received, packet.Name())
+			mu.Unlock()
+		}
+	}()
+
+	last := c.records[0].Time
+	for _, record := range c.records {
+		switch record.Event {
+		case capture.EventSent:
+			result.Expected = append(result.Expected, record.Type)
+			continue
+		case capture.EventReceived:
+		default:
+			continue
+		}
+		if err = sleep(ctx, r.delay(last, record.Time)); err != nil {
+			result.Err = err
+			return result
+		}
+		last = record.Time
+		if len(record.Data) == 0 {
+			logger.Warnf("Skipping captured packet without data: %s", record.Error)
+			continue
+		}
+		data, err := r.prepare(record)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		logger.Infof("Sending %s", record.Packet)
+		if _, err = conn.Write(data); err != nil {
+			// closing the connection is a valid reaction of the target, the remaining packets are skipped
+			logger.WithError(err).Warnf("Write '%s' failed", record.Type)
+			break
+		}
+		result.Sent = append(result.Sent, record.Type)
+	}
+
+	select {
+	case <-readDone:
+	case <-time.After(r.opts.linger):
+	case <-ctx.Done():
+	}
+	_ = conn.Close()
+	<-readDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	return result
+}
+
+func (r *Replayer) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if r.opts.tlsConfig != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: r.opts.tlsConfig}).DialContext(ctx, r.opts.network, r.opts.target)
+	}
+	return dialer.DialContext(ctx, r.opts.network, r.opts.target)
+}
+
+// prepare returns the packet bytes to be sent, with the password replaced if requested.
+func (r *Replayer) prepare(record capture.Record) ([]byte, error) {
+	if r.opts.password == nil || record.Type != "CONNECT" {
+		return record.Data, nil
+	}
+	packet, err := mqttcodec.ReadPacket(bytes.NewReader(record.Data), 0)
+	if err != nil {
+		return nil, err
+	}
+	switch p := packet.(type) {
+	case *mqtt311.ConnectPacket:
+		p.HasPassword = true
+		p.Password = []byte(*r.opts.password)
+	case *mqtt5.ConnectPacket:
+		p.HasPassword = true
+		p.Password = []byte(*r.opts.password)
+	default:
+		return nil, fmt.Errorf("unexpected CONNECT packet type %T", packet)
+	}
+	var buf bytes.Buffer
+	if err = packet.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
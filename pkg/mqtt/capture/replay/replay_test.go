@@ -0,0 +1,136 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	authplain "github.com/grepplabs/mqtt-proxy/pkg/auth/plain"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/capture"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtthandler "github.com/grepplabs/mqtt-proxy/pkg/mqtt/handler"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+func serveTestServer(t *testing.T) net.Addr {
+	logger := log.NewDefaultLogger()
+	registry := prometheus.NewRegistry()
+	authenticator, err := authplain.New(logger, registry, authplain.WithCredentials(map[string]string{"alice": "secret"}))
+	require.NoError(t, err)
+	srv := &mqttserver.Server{
+		Handler:  mqtthandler.New(logger, registry, noop.New(logger, registry), mqtthandler.WithAuthenticator(authenticator)),
+		ErrorLog: logger,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr()
+}
+
+func newRecord(t *testing.T, conn uint64, event string, at time.Time, packet mqttproto.ControlPacket) capture.Record {
+	var buf bytes.Buffer
+	require.NoError(t, packet.Write(&buf))
+	return capture.Record{Time: at, Conn: conn, Event: event, Version: packet.Version(), Type: packet.Name(), Data: buf.Bytes()}
+}
+
+func newSession(t *testing.T, conn uint64, password []byte) []capture.Record {
+	start := time.Now()
+
+	connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+	connect.ProtocolName = mqttproto.MQTT
+	connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+	connect.ClientIdentifier = "device-1"
+	connect.HasUsername = true
+	connect.Username = "alice"
+	connect.HasPassword = true
+	connect.Password = password
+
+	publish := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+	publish.Qos = mqttproto.AT_LEAST_ONCE
+	publish.MessageID = 1
+	publish.TopicName = "dummy"
+	publish.Message = []byte("test")
+
+	return []capture.Record{
+		{Time: start, Conn: conn, Event: capture.EventOpen},
+		newRecord(t, conn, capture.EventReceived, start.Add(10*time.Millisecond), connect),
+		newRecord(t, conn, capture.EventSent, start.Add(11*time.Millisecond), mqtt311.NewControlPacket(mqttproto.CONNACK)),
+		newRecord(t, conn, capture.EventReceived, start.Add(20*time.Millisecond), publish),
+		newRecord(t, conn, capture.EventSent, start.Add(21*time.Millisecond), mqtt311.NewControlPacket(mqttproto.PUBACK)),
+		{Time: start.Add(30 * time.Millisecond), Conn: conn, Event: capture.EventClose},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	addr := serveTestServer(t)
+	logger := log.NewDefaultLogger()
+
+	tests := []struct {
+		name             string
+		records          []capture.Record
+		opts             []Option
+		expectedReceived [][]string
+	}{
+		{
+			name:             "captured password",
+			records:          newSession(t, 1, []byte("secret")),
+			expectedReceived: [][]string{{"CONNACK", "PUBACK"}},
+		},
+		{
+			name:             "redacted password",
+			records:          newSession(t, 1, make([]byte, 6)),
+			expectedReceived: [][]string{{"CONNACK"}},
+		},
+		{
+			name:             "password override",
+			records:          newSession(t, 1, make([]byte, 6)),
+			opts:             []Option{WithPassword("secret")},
+			expectedReceived: [][]string{{"CONNACK", "PUBACK"}},
+		},
+		{
+			name:             "selected connection",
+			records:          append(newSession(t, 1, []byte("invalid")), newSession(t, 2, []byte("secret"))...),
+			opts:             []Option{WithConnections([]uint64{2})},
+			expectedReceived: [][]string{{"CONNACK", "PUBACK"}},
+		},
+		{
+			name:             "multiple connections",
+			records:          append(newSession(t, 1, []byte("invalid")), newSession(t, 2, []byte("secret"))...),
+			opts:             []Option{WithSpeed(0)},
+			expectedReceived: [][]string{{"CONNACK"}, {"CONNACK", "PUBACK"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			opts := append([]Option{WithTarget(addr.String()), WithLinger(200 * time.Millisecond)}, tc.opts...)
+			results, err := New(logger, opts...).Replay(context.Background(), tc.records)
+			require.NoError(t, err)
+			require.Len(t, results, len(tc.expectedReceived))
+			for i, result := range results {
+				a.Equal([]string{"CONNACK", "PUBACK"}, result.Expected)
+				a.Equal(tc.expectedReceived[i], result.Received)
+			}
+		})
+	}
+}
+
+func TestReplayConnectionRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	_, err = New(log.NewDefaultLogger(), WithTarget(addr)).Replay(context.Background(), newSession(t, 1, nil))
+	assert.Error(t, err)
+}
@@ -10,7 +10,7 @@ import (
 	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
 )
 
-func ReadPacket(r io.Reader, protocolVersion byte) (mqttproto.ControlPacket, error) {
+func ReadPacket(r io.Reader, protocolVersion byte, opts ...mqttproto.ReadOption) (mqttproto.ControlPacket, error) {
 	if protocolVersion == 0 {
 		var (
 			err error
@@ -23,13 +23,37 @@ func ReadPacket(r io.Reader, protocolVersion byte) (mqttproto.ControlPacket, err
 		}
 		r = io.MultiReader(bytes.NewReader(buf.Bytes()), r)
 	}
+	options := mqttproto.NewReadOptions(opts...)
+	packet, err := readVersionPacket(r, protocolVersion, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Strict {
+		err = ValidateStrict(packet)
+		if err != nil {
+			if releaser, ok := packet.(mqttproto.Releaser); ok {
+				releaser.Release()
+			}
+			return nil, err
+		}
+	}
+	return packet, nil
+}
+
+func readVersionPacket(r io.Reader, protocolVersion byte, options mqttproto.ReadOptions) (mqttproto.ControlPacket, error) {
 	switch protocolVersion {
-	case mqttproto.MQTT_3_1_1:
-		return mqtt311.ReadPacket(r)
+	case mqttproto.MQTT_3_1, mqttproto.MQTT_3_1_1:
+		// MQTT 3.1 differs from 3.1.1 only in the CONNECT protocol name and level
+		return mqtt311.ReadPacketWithOptions(r, options)
 	case mqttproto.MQTT_5:
-		return mqtt5.ReadPacket(r)
+		return mqtt5.ReadPacketWithOptions(r, options)
 	default:
-		return nil, mqtt311.NewConnAckError(mqttproto.RefusedUnacceptableProtocolVersion, fmt.Sprintf("unsupported protocol version %v", protocolVersion))
+		text := fmt.Sprintf("unsupported protocol version %v", protocolVersion)
+		if protocolVersion > mqttproto.MQTT_5 {
+			// clients supporting newer versions are expected to understand MQTT 5 reason codes
+			return nil, mqtt5.NewConnAckError(mqtt5.UnsupportedProtocolVersion, text)
+		}
+		return nil, mqtt311.NewConnAckError(mqttproto.RefusedUnacceptableProtocolVersion, text)
 	}
 }
 
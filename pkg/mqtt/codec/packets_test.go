@@ -9,6 +9,7 @@ import (
 
 	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
 )
 
 func TestReadPacketV311(t *testing.T) {
@@ -209,3 +210,86 @@ func TestReadPacketV311(t *testing.T) {
 		})
 	}
 }
+
+func TestReadPacketV31(t *testing.T) {
+	encodedBytes, err := hex.DecodeString("101200064d51497364700302003c000474657374")
+	require.Nil(t, err)
+
+	decoded, err := ReadPacket(bytes.NewReader(encodedBytes), 0)
+	require.Nil(t, err)
+	packet := decoded.(*mqtt311.ConnectPacket)
+	require.Equal(t, mqttproto.MQIsdp, packet.ProtocolName)
+	require.Equal(t, mqttproto.MQTT_3_1, packet.Version())
+
+	// subsequent packets use the 3.1.1 codec
+	encodedBytes, err = hex.DecodeString("40020001")
+	require.Nil(t, err)
+	decoded, err = ReadPacket(bytes.NewReader(encodedBytes), mqttproto.MQTT_3_1)
+	require.Nil(t, err)
+	require.Equal(t, mqttproto.PUBACK, decoded.Type())
+}
+
+func TestReadPacketResponseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		encodedHex string
+		version    byte
+		response   string
+		code       byte
+	}{
+		{
+			name:       "CONNECT unsupported version 3.1.1 response",
+			encodedHex: "100c00044d5154540202003c0000",
+			response:   "CONNACK",
+			version:    0,
+			code:       mqttproto.RefusedUnacceptableProtocolVersion,
+		},
+		{
+			name:       "CONNECT unsupported version 5 response",
+			encodedHex: "100c00044d5154540602003c0000",
+			response:   "CONNACK",
+			version:    0,
+			code:       mqtt5.UnsupportedProtocolVersion,
+		},
+		{
+			name:       "CONNECT malformed properties",
+			encodedHex: "100b00044d5154540502003c05",
+			response:   "CONNACK",
+			version:    0,
+			code:       mqtt5.MalformedPacket,
+		},
+		{
+			name:       "PUBLISH malformed properties",
+			encodedHex: "320700017401000a05",
+			response:   "DISCONNECT",
+			version:    mqttproto.MQTT_5,
+			code:       mqtt5.MalformedPacket,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			require.Nil(t, err)
+
+			_, err = ReadPacket(bytes.NewReader(encodedBytes), tc.version)
+			require.NotNil(t, err)
+			rp, ok := err.(mqttproto.ResponsePacket)
+			require.True(t, ok, "%T is not a response packet", err)
+			response := rp.Response()
+			require.Equal(t, tc.response, response.Name())
+
+			switch p := response.(type) {
+			case *mqtt311.ConnackPacket:
+				require.Equal(t, tc.code, p.ReturnCode)
+			case *mqtt5.ConnackPacket:
+				require.Equal(t, tc.code, p.ReturnCode)
+				require.NotEmpty(t, p.ConnackProperties.ReasonString)
+			case *mqtt5.DisconnectPacket:
+				require.Equal(t, tc.code, p.ReasonCode)
+				require.NotEmpty(t, p.DisconnectProperties.ReasonString)
+			default:
+				t.Fatalf("unexpected response %T", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func BenchmarkReadPublishPacket(b *testing.B) {
+	for _, size := range []int{64, 1024, 16384} {
+		for _, version := range []byte{mqttproto.MQTT_3_1_1, mqttproto.MQTT_5} {
+			encoded := encodePublishPacket(b, version, size)
+			for _, pooled := range []bool{false, true} {
+				name := fmt.Sprintf("v%s/%dB/pooled=%t", mqttproto.MqttProtocolVersionName(version), size, pooled)
+				b.Run(name, func(b *testing.B) {
+					benchmarkReadPacket(b, encoded, version, mqttproto.WithPooledBuffers(pooled))
+				})
+			}
+		}
+	}
+}
+
+func benchmarkReadPacket(b *testing.B, encoded []byte, version byte, opts ...mqttproto.ReadOption) {
+	src := bytes.NewReader(encoded)
+	r := bufio.NewReaderSize(src, 1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(encoded)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src.Reset(encoded)
+		r.Reset(src)
+		packet, err := ReadPacket(r, version, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if releaser, ok := packet.(mqttproto.Releaser); ok {
+			releaser.Release()
+		}
+	}
+}
+
+func encodePublishPacket(tb testing.TB, version byte, size int) []byte {
+	var packet mqttproto.ControlPacket
+	switch version {
+	case mqttproto.MQTT_5:
+		p := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		p.Qos = mqttproto.AT_LEAST_ONCE
+		p.MessageID = 1
+		p.TopicName = "devices/sensor/temperature"
+		p.Message = make([]byte, size)
+		packet = p
+	default:
+		p := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+		p.Qos = mqttproto.AT_LEAST_ONCE
+		p.MessageID = 1
+		p.TopicName = "devices/sensor/temperature"
+		p.Message = make([]byte, size)
+		packet = p
+	}
+	var buf bytes.Buffer
+	if err := packet.Write(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadPacketPooled(t *testing.T) {
+	for _, version := range []byte{mqttproto.MQTT_3_1_1, mqttproto.MQTT_5} {
+		encoded := encodePublishPacket(t, version, 2048)
+
+		packet, err := ReadPacket(bytes.NewReader(encoded), version, mqttproto.WithPooledBuffers(true))
+		require.NoError(t, err)
+		var message []byte
+		switch p := packet.(type) {
+		case *mqtt311.PublishPacket:
+			message = p.Message
+		case *mqtt5.PublishPacket:
+			message = p.Message
+		}
+		assert.Equal(t, make([]byte, 2048), message)
+
+		packet.(mqttproto.Releaser).Release()
+		packet.(mqttproto.Releaser).Release()
+		assert.Equal(t, "PUBLISH", packet.Name())
+	}
+}
@@ -0,0 +1,145 @@
+package proto
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+)
+
+const (
+	minPooledBufferBits = 9  // 512 B
+	maxPooledBufferBits = 20 // 1 MiB
+)
+
+var packetBufferPools [maxPooledBufferBits - minPooledBufferBits + 1]sync.Pool
+
+// Releaser is implemented by packets which reference a pooled PacketBuffer.
+// Release must be called once, after the packet content is no longer used.
+type Releaser interface {
+	Release()
+}
+
+// PacketBuffer holds the encoded body of a single packet and reads it without copying.
+type PacketBuffer struct {
+	buf    []byte
+	off    int
+	pooled bool
+}
+
+// NewPacketBuffer returns a buffer of the given size which is not pooled.
+func NewPacketBuffer(size int) *PacketBuffer {
+	return &PacketBuffer{buf: make([]byte, size)}
+}
+
+// GetPacketBuffer returns a buffer of the given size from the pool. Buffers larger than 1 MiB are not pooled.
+func GetPacketBuffer(size int) *PacketBuffer {
+	class := bufferClass(size)
+	if class >= len(packetBufferPools) {
+		return NewPacketBuffer(size)
+	}
+	if pb, ok := packetBufferPools[class].Get().(*PacketBuffer); ok {
+		pb.buf = pb.buf[:size]
+		pb.off = 0
+		return pb
+	}
+	return &PacketBuffer{buf: make([]byte, size, 1<<(class+minPooledBufferBits)), pooled: true}
+}
+
+func bufferClass(size int) int {
+	if size <= 1<<minPooledBufferBits {
+		return 0
+	}
+	return bits.Len(uint(size-1)) - minPooledBufferBits
+}
+
+// Release returns the buffer to the pool. The buffer and any slice obtained from it must not be used afterwards.
+func (b *PacketBuffer) Release() {
+	if b == nil || !b.pooled {
+		return
+	}
+	b.buf = b.buf[:0]
+	b.off = 0
+	packetBufferPools[bufferClass(cap(b.buf))].Put(b)
+}
+
+// Pooled reports whether the buffer must be released after use.
+func (b *PacketBuffer) Pooled() bool {
+	return b.pooled
+}
+
+// Bytes returns the whole buffer.
+func (b *PacketBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// Len returns the number of unread bytes.
+func (b *PacketBuffer) Len() int {
+	return len(b.buf) - b.off
+}
+
+func (b *PacketBuffer) Read(p []byte) (n int, err error) {
+	if b.off >= len(b.buf) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n = copy(p, b.buf[b.off:])
+	b.off += n
+	return n, nil
+}
+
+func (b *PacketBuffer) ReadByte() (byte, error) {
+	if b.off >= len(b.buf) {
+		return 0, io.EOF
+	}
+	c := b.buf[b.off]
+	b.off++
+	return c, nil
+}
+
+// Next returns a slice of the next n unread bytes, which is valid until the buffer is released.
+func (b *PacketBuffer) Next(n int) ([]byte, error) {
+	if n > b.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := b.buf[b.off : b.off+n : b.off+n]
+	b.off += n
+	return data, nil
+}
+
+// ReadPacketBody reads the body of the packet described by the fixed header.
+func ReadPacketBody(r io.Reader, fh *FixedHeader, pooled bool) (*PacketBuffer, error) {
+	var body *PacketBuffer
+	if pooled {
+		body = GetPacketBuffer(fh.RemainingLength)
+	} else {
+		body = NewPacketBuffer(fh.RemainingLength)
+	}
+	_, err := io.ReadFull(r, body.buf)
+	if err != nil {
+		body.Release()
+		return nil, err
+	}
+	return body, nil
+}
+
+// ReadFixedHeader reads and validates the fixed header of the next packet.
+func ReadFixedHeader(r io.Reader) (fh FixedHeader, err error) {
+	var typeAndFlags byte
+	if br, ok := r.(io.ByteReader); ok {
+		typeAndFlags, err = br.ReadByte()
+	} else {
+		var b1 [1]byte
+		_, err = io.ReadFull(r, b1[:])
+		typeAndFlags = b1[0]
+	}
+	if err != nil {
+		return fh, err
+	}
+	err = fh.Unpack(typeAndFlags, r)
+	if err != nil {
+		return fh, err
+	}
+	return fh, fh.Validate()
+}
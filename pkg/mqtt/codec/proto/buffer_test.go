@@ -0,0 +1,58 @@
+package proto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPacketBuffer(t *testing.T) {
+	tests := []struct {
+		size        int
+		expectedCap int
+		pooled      bool
+	}{
+		{size: 0, expectedCap: 512, pooled: true},
+		{size: 512, expectedCap: 512, pooled: true},
+		{size: 513, expectedCap: 1024, pooled: true},
+		{size: 1 << 20, expectedCap: 1 << 20, pooled: true},
+		{size: 1<<20 + 1, expectedCap: 1<<20 + 1, pooled: false},
+	}
+	for _, tc := range tests {
+		pb := GetPacketBuffer(tc.size)
+		assert.Equal(t, tc.size, len(pb.Bytes()))
+		assert.Equal(t, tc.expectedCap, cap(pb.Bytes()))
+		assert.Equal(t, tc.pooled, pb.Pooled())
+		pb.Release()
+	}
+}
+
+func TestPacketBufferRead(t *testing.T) {
+	a := assert.New(t)
+	pb, err := ReadPacketBody(bytes.NewReader([]byte{0, 3, 'a', '/', 'b', 1, 2, 3}), &FixedHeader{RemainingLength: 8}, true)
+	require.Nil(t, err)
+	defer pb.Release()
+
+	s, err := DecodeString(pb)
+	a.Nil(err)
+	a.Equal("a/b", s)
+	a.Equal(3, pb.Len())
+
+	data, err := pb.Next(3)
+	a.Nil(err)
+	a.Equal([]byte{1, 2, 3}, data)
+	a.Equal(3, cap(data))
+
+	_, err = pb.Next(1)
+	a.Equal(io.ErrUnexpectedEOF, err)
+	_, err = pb.ReadByte()
+	a.Equal(io.EOF, err)
+}
+
+func TestReadPacketBodyShort(t *testing.T) {
+	_, err := ReadPacketBody(bytes.NewReader([]byte{1, 2}), &FixedHeader{RemainingLength: 3}, true)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -2,12 +2,15 @@ package proto
 
 const (
 	MQTT                               = "MQTT"
+	MQIsdp                             = "MQIsdp" // protocol name of MQTT 3.1
+	MQTT_3_1                      byte = 3
 	MQTT_3_1_1                    byte = 4
 	MQTT_5                        byte = 5
 	MQTT_DEFAULT_PROTOCOL_VERSION      = MQTT_3_1_1
 )
 
 var MqttProtocolVersionNames = map[byte]string{
+	MQTT_3_1:   "3.1",
 	MQTT_3_1_1: "3.1.1",
 	MQTT_5:     "5",
 }
@@ -52,6 +55,15 @@ var MqttMessageTypeNames = map[byte]string{
 	AUTH:        "AUTH",
 }
 
+func MqttMessageTypeByName(name string) (byte, bool) {
+	for t, n := range MqttMessageTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
 const (
 	AT_MOST_ONCE  = 0
 	AT_LEAST_ONCE = 1
@@ -3,11 +3,15 @@ package proto
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
 
 func DecodeByte(r io.Reader) (byte, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
 	b := make([]byte, 1)
 	_, err := r.Read(b)
 	if err != nil {
@@ -48,6 +52,17 @@ func EncodeBytes(b []byte) []byte {
 }
 
 func DecodeUint16(r io.Reader) (uint16, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		b0, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		b1, err := br.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		return uint16(b0)<<8 | uint16(b1), nil
+	}
 	b := make([]byte, 2)
 	_, err := io.ReadFull(r, b)
 	if err != nil {
@@ -62,16 +77,49 @@ func EncodeUint16(v uint16) []byte {
 	return b
 }
 
-func DecodeUvarint(r io.Reader) (int, error) {
-	byteReader := newByteReader(r)
-	length, err := binary.ReadUvarint(byteReader)
+func DecodeUint32(r io.Reader) (uint32, error) {
+	b := make([]byte, 4)
+	_, err := io.ReadFull(r, b)
 	if err != nil {
 		return 0, err
 	}
-	if byteReader.bytesRead > 4 {
-		return 0, fmt.Errorf("the maximum number of bytes in the variable byte integer is 4, but was %d", byteReader.bytesRead)
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func EncodeUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func DecodeUvarint(r io.Reader) (int, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = newByteReader(r)
+	}
+	// modified binary.ReadUvarint, which counts the bytes read
+	var x uint64
+	var s uint
+	for i := 1; ; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			if i > 1 {
+				err = unexpectedEOF(err)
+			}
+			return 0, err
+		}
+		if b < 0x80 {
+			if i > 4 {
+				return 0, fmt.Errorf("the maximum number of bytes in the variable byte integer is 4, but was %d", i)
+			}
+			return int(x | uint64(b)<<s), nil
+		}
+		if i == binary.MaxVarintLen64 {
+			return 0, errors.New("variable byte integer overflows a 64-bit integer")
+		}
+		x |= uint64(b&0x7f) << s
+		s += 7
 	}
-	return int(length), nil
 }
 
 // WriteUvarint is a modified binary.PutUvarint
@@ -91,17 +139,15 @@ func newByteReader(r io.Reader) *byteReader {
 }
 
 type byteReader struct {
-	reader    io.Reader
-	bytesRead int
-	buf       [1]byte
+	reader io.Reader
+	buf    [1]byte
 }
 
 func (r *byteReader) ReadByte() (byte, error) {
-	n, err := io.ReadFull(r.reader, r.buf[:])
+	_, err := io.ReadFull(r.reader, r.buf[:])
 	if err != nil {
 		return 0, err
 	}
-	r.bytesRead += n
 	return r.buf[0], nil
 }
 
@@ -115,3 +161,22 @@ func (r *CountingReader) Read(p []byte) (n int, err error) {
 	r.BytesRead += n
 	return n, err
 }
+
+func (r *CountingReader) ReadByte() (b byte, err error) {
+	if br, ok := r.Reader.(io.ByteReader); ok {
+		b, err = br.ReadByte()
+	} else {
+		b, err = newByteReader(r.Reader).ReadByte()
+	}
+	if err == nil {
+		r.BytesRead++
+	}
+	return b, err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -30,6 +30,38 @@ func (fh *FixedHeader) Validate() error {
 	return nil
 }
 
+// ValidateFlags verifies the flags of the fixed header, which are reserved for all packet types but PUBLISH (MQTT 2.2.2).
+func (fh *FixedHeader) ValidateFlags() error {
+	switch fh.MessageType {
+	case PUBLISH:
+		if fh.Qos > EXACTLY_ONCE {
+			return fmt.Errorf("invalid PUBLISH QoS %d", fh.Qos)
+		}
+		return nil
+	case PUBREL, SUBSCRIBE, UNSUBSCRIBE:
+		if fh.Dup || fh.Qos != AT_LEAST_ONCE || fh.Retain {
+			return fmt.Errorf("invalid fixed header flags 0x%x for %s, expected 0x2", fh.getFixedHeaderByte1()&0x0f, fh.MessageName())
+		}
+	default:
+		if fh.Dup || fh.Qos != 0 || fh.Retain {
+			return fmt.Errorf("invalid fixed header flags 0x%x for %s, expected 0x0", fh.getFixedHeaderByte1()&0x0f, fh.MessageName())
+		}
+	}
+	return nil
+}
+
+// PacketSize returns the size of the whole packet including the fixed header.
+func (fh *FixedHeader) PacketSize() int {
+	size := 1 + fh.RemainingLength
+	for x := fh.RemainingLength; ; x >>= 7 {
+		size++
+		if x < 0x80 {
+			break
+		}
+	}
+	return size
+}
+
 func (fh *FixedHeader) decode(r io.Reader) (err error) {
 	b1 := make([]byte, 1)
 	_, err = io.ReadFull(r, b1)
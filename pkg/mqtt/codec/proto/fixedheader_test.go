@@ -123,6 +123,7 @@ func TestFixedHeaderCodec(t *testing.T) {
 			buffer := tc.header.Pack()
 			encodedBytes := buffer.Bytes()
 			a.Equal(tc.encodedHex, hex.EncodeToString(encodedBytes))
+			a.Equal(len(encodedBytes)+tc.header.RemainingLength, tc.header.PacketSize())
 
 			header := FixedHeader{}
 			err := header.decode(bytes.NewBuffer(encodedBytes))
@@ -193,3 +194,46 @@ func TestFixedHeaderValidationError(t *testing.T) {
 		})
 	}
 }
+
+func TestFixedHeaderValidateFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    FixedHeader
+		expected string
+	}{
+		{
+			name:  "publish qos 2 dup retain",
+			input: FixedHeader{MessageType: PUBLISH, Qos: EXACTLY_ONCE, Dup: true, Retain: true},
+		},
+		{
+			name:  "subscribe",
+			input: FixedHeader{MessageType: SUBSCRIBE, Qos: AT_LEAST_ONCE},
+		},
+		{
+			name:     "publish qos 3",
+			input:    FixedHeader{MessageType: PUBLISH, Qos: 3},
+			expected: "invalid PUBLISH QoS 3",
+		},
+		{
+			name:     "pubrel without reserved flag",
+			input:    FixedHeader{MessageType: PUBREL},
+			expected: "invalid fixed header flags 0x0 for PUBREL, expected 0x2",
+		},
+		{
+			name:     "connect with retain flag",
+			input:    FixedHeader{MessageType: CONNECT, Retain: true},
+			expected: "invalid fixed header flags 0x1 for CONNECT, expected 0x0",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := tc.input.ValidateFlags()
+			if tc.expected == "" {
+				a.Nil(err)
+			} else {
+				a.EqualError(err, tc.expected)
+			}
+		})
+	}
+}
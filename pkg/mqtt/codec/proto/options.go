@@ -0,0 +1,101 @@
+package proto
+
+import "fmt"
+
+// ReadOptions control the decoding of packets read from a connection.
+type ReadOptions struct {
+	MaxPacketSize       uint32          // maximum packet size in bytes (fixed header included), 0 means no limit
+	MaxPacketSizeByType map[byte]uint32 // maximum packet size per packet type, overrides MaxPacketSize
+	Strict              bool            // reject packets violating the specification which are otherwise tolerated
+	PooledBuffers       bool            // read packets into pooled buffers, PUBLISH packets must be released by the caller
+}
+
+type ReadOption interface {
+	apply(*ReadOptions)
+}
+
+type readOptionFunc func(*ReadOptions)
+
+func (f readOptionFunc) apply(o *ReadOptions) {
+	f(o)
+}
+
+func WithMaxPacketSize(n uint32) ReadOption {
+	return readOptionFunc(func(o *ReadOptions) {
+		o.MaxPacketSize = n
+	})
+}
+
+func WithMaxPacketSizeByType(m map[byte]uint32) ReadOption {
+	return readOptionFunc(func(o *ReadOptions) {
+		o.MaxPacketSizeByType = m
+	})
+}
+
+func WithStrict(b bool) ReadOption {
+	return readOptionFunc(func(o *ReadOptions) {
+		o.Strict = b
+	})
+}
+
+func WithPooledBuffers(b bool) ReadOption {
+	return readOptionFunc(func(o *ReadOptions) {
+		o.PooledBuffers = b
+	})
+}
+
+func NewReadOptions(opts ...ReadOption) ReadOptions {
+	options := ReadOptions{}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	return options
+}
+
+// PacketSizeLimit returns the maximum packet size for the packet type, 0 means no limit.
+func (o ReadOptions) PacketSizeLimit(messageType byte) uint32 {
+	if limit, ok := o.MaxPacketSizeByType[messageType]; ok {
+		return limit
+	}
+	return o.MaxPacketSize
+}
+
+// AdvertisedPacketSize returns the size to be announced as MQTT 5 Maximum Packet Size, 0 when any packet type is unlimited.
+func (o ReadOptions) AdvertisedPacketSize() uint32 {
+	if o.MaxPacketSize == 0 {
+		return 0
+	}
+	result := o.MaxPacketSize
+	for _, limit := range o.MaxPacketSizeByType {
+		if limit == 0 {
+			return 0
+		}
+		if limit > result {
+			result = limit
+		}
+	}
+	return result
+}
+
+// CheckPacketSize verifies the size of the packet before its body is read.
+func (o ReadOptions) CheckPacketSize(fh *FixedHeader) error {
+	limit := o.PacketSizeLimit(fh.MessageType)
+	if limit == 0 {
+		return nil
+	}
+	size := fh.PacketSize()
+	if size > int(limit) {
+		return &PacketTooLargeError{MessageType: fh.MessageType, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+type PacketTooLargeError struct {
+	MessageType byte
+	Size        int
+	Limit       uint32
+}
+
+func (e *PacketTooLargeError) Error() string {
+	return fmt.Sprintf("%s packet size %d exceeds the maximum packet size %d", MqttMessageTypeNames[e.MessageType], e.Size, e.Limit)
+}
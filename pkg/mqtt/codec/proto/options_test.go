@@ -0,0 +1,64 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPacketSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  ReadOptions
+		header   FixedHeader
+		expected string
+	}{
+		{
+			name:    "no limit",
+			options: NewReadOptions(),
+			header:  FixedHeader{MessageType: PUBLISH, RemainingLength: maxRemainingLength},
+		},
+		{
+			name:    "within limit",
+			options: NewReadOptions(WithMaxPacketSize(130)),
+			header:  FixedHeader{MessageType: PUBLISH, RemainingLength: 127},
+		},
+		{
+			name:     "exceeds limit",
+			options:  NewReadOptions(WithMaxPacketSize(130)),
+			header:   FixedHeader{MessageType: PUBLISH, RemainingLength: 128},
+			expected: "PUBLISH packet size 131 exceeds the maximum packet size 130",
+		},
+		{
+			name:    "packet type limit overrides the global limit",
+			options: NewReadOptions(WithMaxPacketSize(100), WithMaxPacketSizeByType(map[byte]uint32{PUBLISH: 1024})),
+			header:  FixedHeader{MessageType: PUBLISH, RemainingLength: 1000},
+		},
+		{
+			name:     "exceeds packet type limit",
+			options:  NewReadOptions(WithMaxPacketSizeByType(map[byte]uint32{CONNECT: 64})),
+			header:   FixedHeader{MessageType: CONNECT, RemainingLength: 63},
+			expected: "CONNECT packet size 65 exceeds the maximum packet size 64",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := tc.options.CheckPacketSize(&tc.header)
+			if tc.expected == "" {
+				a.Nil(err)
+			} else {
+				a.EqualError(err, tc.expected)
+				a.IsType(&PacketTooLargeError{}, err)
+			}
+		})
+	}
+}
+
+func TestAdvertisedPacketSize(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(uint32(0), NewReadOptions().AdvertisedPacketSize())
+	a.Equal(uint32(0), NewReadOptions(WithMaxPacketSizeByType(map[byte]uint32{PUBLISH: 1024})).AdvertisedPacketSize())
+	a.Equal(uint32(2048), NewReadOptions(WithMaxPacketSize(2048), WithMaxPacketSizeByType(map[byte]uint32{CONNECT: 256})).AdvertisedPacketSize())
+	a.Equal(uint32(4096), NewReadOptions(WithMaxPacketSize(2048), WithMaxPacketSizeByType(map[byte]uint32{PUBLISH: 4096})).AdvertisedPacketSize())
+}
@@ -0,0 +1,52 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrMalformedString = errors.New("malformed UTF-8 string")
+
+// ValidateUTF8String verifies a UTF-8 Encoded String (MQTT 1.5.3 / MQTT 5 1.5.4).
+func ValidateUTF8String(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("%w: invalid encoding", ErrMalformedString)
+	}
+	if strings.ContainsRune(s, 0) {
+		return fmt.Errorf("%w: null character U+0000", ErrMalformedString)
+	}
+	return nil
+}
+
+// ValidateTopicName verifies a topic name of a PUBLISH packet, which must not contain wildcards.
+func ValidateTopicName(s string) error {
+	if err := ValidateUTF8String(s); err != nil {
+		return fmt.Errorf("topic name: %w", err)
+	}
+	if strings.ContainsAny(s, "+#") {
+		return fmt.Errorf("topic name '%s' contains wildcard characters", s)
+	}
+	return nil
+}
+
+// ValidateTopicFilter verifies a topic filter and the placement of its wildcards (MQTT 4.7.1).
+func ValidateTopicFilter(s string) error {
+	if err := ValidateUTF8String(s); err != nil {
+		return fmt.Errorf("topic filter: %w", err)
+	}
+	if s == "" {
+		return errors.New("empty topic filter")
+	}
+	levels := strings.Split(s, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("topic filter '%s' has invalid multi-level wildcard", s)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("topic filter '%s' has invalid single-level wildcard", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package proto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTopicName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  string
+		malformed bool
+	}{
+		{name: "simple", input: "a/b/c"},
+		{name: "empty levels", input: "/a//b/"},
+		{name: "single-level wildcard", input: "a/+/c", expected: "topic name 'a/+/c' contains wildcard characters"},
+		{name: "multi-level wildcard", input: "a/#", expected: "topic name 'a/#' contains wildcard characters"},
+		{name: "null character", input: "a\x00b", expected: "topic name: malformed UTF-8 string: null character U+0000", malformed: true},
+		{name: "invalid encoding", input: "a\xffb", expected: "topic name: malformed UTF-8 string: invalid encoding", malformed: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := ValidateTopicName(tc.input)
+			if tc.expected == "" {
+				a.Nil(err)
+			} else {
+				a.EqualError(err, tc.expected)
+				a.Equal(tc.malformed, errors.Is(err, ErrMalformedString))
+			}
+		})
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "simple", input: "a/b/c"},
+		{name: "multi-level wildcard", input: "#"},
+		{name: "trailing multi-level wildcard", input: "a/b/#"},
+		{name: "single-level wildcards", input: "+/b/+"},
+		{name: "single-level and multi-level wildcards", input: "+/#"},
+		{name: "empty", input: "", expected: "empty topic filter"},
+		{name: "multi-level wildcard not last", input: "a/#/c", expected: "topic filter 'a/#/c' has invalid multi-level wildcard"},
+		{name: "multi-level wildcard in level", input: "a/b#", expected: "topic filter 'a/b#' has invalid multi-level wildcard"},
+		{name: "single-level wildcard in level", input: "a/b+/c", expected: "topic filter 'a/b+/c' has invalid single-level wildcard"},
+		{name: "null character", input: "a/\x00", expected: "topic filter: malformed UTF-8 string: null character U+0000"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := ValidateTopicFilter(tc.input)
+			if tc.expected == "" {
+				a.Nil(err)
+			} else {
+				a.EqualError(err, tc.expected)
+			}
+		})
+	}
+}
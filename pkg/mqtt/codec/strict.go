@@ -0,0 +1,200 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+type flagsValidator interface {
+	ValidateFlags() error
+}
+
+// ValidateStrict verifies the conformance rules which are not enforced by the decoders.
+// The returned error carries the CONNACK return code or the v5 reason code the client should receive.
+func ValidateStrict(packet mqttproto.ControlPacket) error {
+	switch packet.Version() {
+	case mqttproto.MQTT_5:
+		return validateStrict5(packet)
+	default:
+		return validateStrict311(packet)
+	}
+}
+
+func validateStrict311(packet mqttproto.ControlPacket) error {
+	if fv, ok := packet.(flagsValidator); ok {
+		if err := fv.ValidateFlags(); err != nil {
+			return err
+		}
+	}
+	switch p := packet.(type) {
+	case *mqtt311.ConnectPacket:
+		if !isValidProtocolName(p.ProtocolName, p.ProtocolLevel) {
+			return fmt.Errorf("invalid protocol name '%s' for protocol level %d", p.ProtocolName, p.ProtocolLevel)
+		}
+		if p.ReservedBit {
+			return errors.New("CONNECT reserved flag is set")
+		}
+		if err := validateWillFlags(p.WillFlag, p.WillQos, p.WillRetain); err != nil {
+			return err
+		}
+		if p.HasPassword && !p.HasUsername {
+			return errors.New("CONNECT password flag is set without user name flag")
+		}
+		if err := mqttproto.ValidateUTF8String(p.ClientIdentifier); err != nil {
+			return mqtt311.NewConnAckError(mqttproto.RefusedIdentifierRejected, fmt.Sprintf("client identifier: %v", err))
+		}
+		if err := mqttproto.ValidateUTF8String(p.Username); err != nil {
+			return fmt.Errorf("user name: %w", err)
+		}
+		if p.WillFlag {
+			if err := validateTopicName(p.WillTopic); err != nil {
+				return fmt.Errorf("will %w", err)
+			}
+		}
+	case *mqtt311.PublishPacket:
+		if p.Qos == mqttproto.AT_MOST_ONCE && p.Dup {
+			return errors.New("PUBLISH DUP flag is set for QoS 0")
+		}
+		return validateTopicName(p.TopicName)
+	case *mqtt311.SubscribePacket:
+		if len(p.TopicSubscriptions) == 0 {
+			return errors.New("SUBSCRIBE without topic filters")
+		}
+		for _, ts := range p.TopicSubscriptions {
+			if err := mqttproto.ValidateTopicFilter(ts.TopicFilter); err != nil {
+				return err
+			}
+			if ts.Qos > mqttproto.EXACTLY_ONCE {
+				return fmt.Errorf("invalid requested QoS %d", ts.Qos)
+			}
+		}
+	case *mqtt311.UnsubscribePacket:
+		if len(p.TopicFilters) == 0 {
+			return errors.New("UNSUBSCRIBE without topic filters")
+		}
+		for _, topicFilter := range p.TopicFilters {
+			if err := mqttproto.ValidateTopicFilter(topicFilter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateStrict5(packet mqttproto.ControlPacket) error {
+	if fv, ok := packet.(flagsValidator); ok {
+		if err := fv.ValidateFlags(); err != nil {
+			return mqtt5.NewResponseError(packet.Type(), mqtt5.MalformedPacket, err.Error())
+		}
+	}
+	reasonCode, err := getStrictViolation5(packet)
+	if err != nil {
+		return mqtt5.NewResponseError(packet.Type(), reasonCode, err.Error())
+	}
+	return nil
+}
+
+func getStrictViolation5(packet mqttproto.ControlPacket) (byte, error) {
+	switch p := packet.(type) {
+	case *mqtt5.ConnectPacket:
+		if p.ProtocolName != mqttproto.MQTT {
+			return mqtt5.UnsupportedProtocolVersion, fmt.Errorf("invalid protocol name '%s'", p.ProtocolName)
+		}
+		if p.ReservedBit {
+			return mqtt5.MalformedPacket, errors.New("CONNECT reserved flag is set")
+		}
+		if err := validateWillFlags(p.WillFlag, p.WillQos, p.WillRetain); err != nil {
+			return mqtt5.MalformedPacket, err
+		}
+		if err := mqttproto.ValidateUTF8String(p.ClientIdentifier); err != nil {
+			return mqtt5.ClientIdentifierNotValid, fmt.Errorf("client identifier: %w", err)
+		}
+		if err := mqttproto.ValidateUTF8String(p.Username); err != nil {
+			return mqtt5.MalformedPacket, fmt.Errorf("user name: %w", err)
+		}
+		if p.WillFlag {
+			if err := mqttproto.ValidateTopicName(p.WillTopic); err != nil {
+				return topicNameReasonCode(err), fmt.Errorf("will %w", err)
+			}
+		}
+	case *mqtt5.PublishPacket:
+		if p.Qos == mqttproto.AT_MOST_ONCE && p.Dup {
+			return mqtt5.MalformedPacket, errors.New("PUBLISH DUP flag is set for QoS 0")
+		}
+		if p.TopicName == "" {
+			if p.PublishProperties.TopicAlias == nil {
+				return mqtt5.ProtocolError, errors.New("empty topic name without topic alias")
+			}
+			return 0, nil
+		}
+		if err := mqttproto.ValidateTopicName(p.TopicName); err != nil {
+			return topicNameReasonCode(err), err
+		}
+	case *mqtt5.SubscribePacket:
+		if len(p.TopicSubscriptions) == 0 {
+			return mqtt5.ProtocolError, errors.New("SUBSCRIBE without topic filters")
+		}
+		for _, ts := range p.TopicSubscriptions {
+			if err := mqttproto.ValidateTopicFilter(ts.TopicFilter); err != nil {
+				return topicFilterReasonCode(err), err
+			}
+			if ts.Qos > mqttproto.EXACTLY_ONCE || ts.RetainHandling > 2 || ts.ReservedBits != 0 {
+				return mqtt5.MalformedPacket, fmt.Errorf("invalid subscription options for topic filter '%s'", ts.TopicFilter)
+			}
+		}
+	case *mqtt5.UnsubscribePacket:
+		if len(p.TopicFilters) == 0 {
+			return mqtt5.ProtocolError, errors.New("UNSUBSCRIBE without topic filters")
+		}
+		for _, topicFilter := range p.TopicFilters {
+			if err := mqttproto.ValidateTopicFilter(topicFilter); err != nil {
+				return topicFilterReasonCode(err), err
+			}
+		}
+	}
+	return 0, nil
+}
+
+func isValidProtocolName(name string, level byte) bool {
+	switch level {
+	case mqttproto.MQTT_3_1:
+		return name == mqttproto.MQIsdp
+	default:
+		return name == mqttproto.MQTT
+	}
+}
+
+func validateWillFlags(willFlag bool, willQos byte, willRetain bool) error {
+	if willQos > mqttproto.EXACTLY_ONCE {
+		return fmt.Errorf("invalid will QoS %d", willQos)
+	}
+	if !willFlag && (willQos != 0 || willRetain) {
+		return errors.New("will QoS or will retain flag is set without will flag")
+	}
+	return nil
+}
+
+func validateTopicName(topicName string) error {
+	if topicName == "" {
+		return errors.New("empty topic name")
+	}
+	return mqttproto.ValidateTopicName(topicName)
+}
+
+func topicNameReasonCode(err error) byte {
+	if errors.Is(err, mqttproto.ErrMalformedString) {
+		return mqtt5.MalformedPacket
+	}
+	return mqtt5.TopicNameInvalid
+}
+
+func topicFilterReasonCode(err error) byte {
+	if errors.Is(err, mqttproto.ErrMalformedString) {
+		return mqtt5.MalformedPacket
+	}
+	return mqtt5.TopicFilterInvalid
+}
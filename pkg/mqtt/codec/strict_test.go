@@ -0,0 +1,278 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func TestValidateStrict311(t *testing.T) {
+	newConnect := func(f func(p *mqtt311.ConnectPacket)) *mqtt311.ConnectPacket {
+		p := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+		p.ProtocolName = mqttproto.MQTT
+		p.ProtocolLevel = mqttproto.MQTT_3_1_1
+		p.ClientIdentifier = "client"
+		f(p)
+		return p
+	}
+	newPublish := func(f func(p *mqtt311.PublishPacket)) *mqtt311.PublishPacket {
+		p := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+		p.TopicName = "a/b"
+		f(p)
+		return p
+	}
+	tests := []struct {
+		name       string
+		packet     mqttproto.ControlPacket
+		expected   string
+		returnCode byte
+	}{
+		{
+			name:   "valid connect",
+			packet: newConnect(func(p *mqtt311.ConnectPacket) {}),
+		},
+		{
+			name: "valid 3.1 connect",
+			packet: newConnect(func(p *mqtt311.ConnectPacket) {
+				p.ProtocolName = mqttproto.MQIsdp
+				p.ProtocolLevel = mqttproto.MQTT_3_1
+			}),
+		},
+		{
+			name:     "connect protocol name mismatch",
+			packet:   newConnect(func(p *mqtt311.ConnectPacket) { p.ProtocolName = mqttproto.MQIsdp }),
+			expected: "invalid protocol name 'MQIsdp' for protocol level 4",
+		},
+		{
+			name:     "connect reserved bit",
+			packet:   newConnect(func(p *mqtt311.ConnectPacket) { p.ReservedBit = true }),
+			expected: "CONNECT reserved flag is set",
+		},
+		{
+			name:     "connect will qos without will flag",
+			packet:   newConnect(func(p *mqtt311.ConnectPacket) { p.WillQos = mqttproto.AT_LEAST_ONCE }),
+			expected: "will QoS or will retain flag is set without will flag",
+		},
+		{
+			name:     "connect password without user name",
+			packet:   newConnect(func(p *mqtt311.ConnectPacket) { p.HasPassword = true }),
+			expected: "CONNECT password flag is set without user name flag",
+		},
+		{
+			name:       "connect client identifier with null character",
+			packet:     newConnect(func(p *mqtt311.ConnectPacket) { p.ClientIdentifier = "a\x00" }),
+			expected:   "CONNACK return code 2: client identifier: malformed UTF-8 string: null character U+0000",
+			returnCode: mqttproto.RefusedIdentifierRejected,
+		},
+		{
+			name:     "connect fixed header flags",
+			packet:   newConnect(func(p *mqtt311.ConnectPacket) { p.Retain = true }),
+			expected: "invalid fixed header flags 0x1 for CONNECT, expected 0x0",
+		},
+		{
+			name:     "publish qos 3",
+			packet:   newPublish(func(p *mqtt311.PublishPacket) { p.Qos = 3 }),
+			expected: "invalid PUBLISH QoS 3",
+		},
+		{
+			name:     "publish dup with qos 0",
+			packet:   newPublish(func(p *mqtt311.PublishPacket) { p.Dup = true }),
+			expected: "PUBLISH DUP flag is set for QoS 0",
+		},
+		{
+			name:     "publish topic with wildcard",
+			packet:   newPublish(func(p *mqtt311.PublishPacket) { p.TopicName = "a/#" }),
+			expected: "topic name 'a/#' contains wildcard characters",
+		},
+		{
+			name:     "publish empty topic",
+			packet:   newPublish(func(p *mqtt311.PublishPacket) { p.TopicName = "" }),
+			expected: "empty topic name",
+		},
+		{
+			name: "subscribe invalid topic filter",
+			packet: &mqtt311.SubscribePacket{
+				FixedHeader:        mqttproto.FixedHeader{MessageType: mqttproto.SUBSCRIBE, Qos: mqttproto.AT_LEAST_ONCE},
+				TopicSubscriptions: []mqtt311.TopicSubscription{{TopicFilter: "a/#/b"}},
+			},
+			expected: "topic filter 'a/#/b' has invalid multi-level wildcard",
+		},
+		{
+			name: "subscribe invalid qos",
+			packet: &mqtt311.SubscribePacket{
+				FixedHeader:        mqttproto.FixedHeader{MessageType: mqttproto.SUBSCRIBE, Qos: mqttproto.AT_LEAST_ONCE},
+				TopicSubscriptions: []mqtt311.TopicSubscription{{TopicFilter: "a/+", Qos: 3}},
+			},
+			expected: "invalid requested QoS 3",
+		},
+		{
+			name: "unsubscribe without topic filters",
+			packet: &mqtt311.UnsubscribePacket{
+				FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.UNSUBSCRIBE, Qos: mqttproto.AT_LEAST_ONCE},
+			},
+			expected: "UNSUBSCRIBE without topic filters",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := ValidateStrict(tc.packet)
+			if tc.expected == "" {
+				a.Nil(err)
+				return
+			}
+			a.EqualError(err, tc.expected)
+			if connAckError, ok := err.(*mqtt311.ConnectAckError); ok {
+				a.Equal(tc.returnCode, connAckError.ReturnCode())
+			} else {
+				a.Equal(byte(0), tc.returnCode)
+			}
+		})
+	}
+}
+
+func TestValidateStrict5(t *testing.T) {
+	newConnect := func(f func(p *mqtt5.ConnectPacket)) *mqtt5.ConnectPacket {
+		p := mqtt5.NewControlPacket(mqttproto.CONNECT).(*mqtt5.ConnectPacket)
+		p.ProtocolName = mqttproto.MQTT
+		p.ProtocolLevel = mqttproto.MQTT_5
+		p.ClientIdentifier = "client"
+		f(p)
+		return p
+	}
+	newPublish := func(f func(p *mqtt5.PublishPacket)) *mqtt5.PublishPacket {
+		p := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		p.TopicName = "a/b"
+		f(p)
+		return p
+	}
+	alias := uint16(1)
+	tests := []struct {
+		name       string
+		packet     mqttproto.ControlPacket
+		expected   string
+		reasonCode byte
+	}{
+		{
+			name:   "valid connect",
+			packet: newConnect(func(p *mqtt5.ConnectPacket) {}),
+		},
+		{
+			name:       "connect protocol name",
+			packet:     newConnect(func(p *mqtt5.ConnectPacket) { p.ProtocolName = mqttproto.MQIsdp }),
+			expected:   "CONNACK reason code 0x84: invalid protocol name 'MQIsdp'",
+			reasonCode: mqtt5.UnsupportedProtocolVersion,
+		},
+		{
+			name:       "connect reserved bit",
+			packet:     newConnect(func(p *mqtt5.ConnectPacket) { p.ReservedBit = true }),
+			expected:   "CONNACK reason code 0x81: CONNECT reserved flag is set",
+			reasonCode: mqtt5.MalformedPacket,
+		},
+		{
+			name:       "connect client identifier",
+			packet:     newConnect(func(p *mqtt5.ConnectPacket) { p.ClientIdentifier = "\xff" }),
+			expected:   "CONNACK reason code 0x85: client identifier: malformed UTF-8 string: invalid encoding",
+			reasonCode: mqtt5.ClientIdentifierNotValid,
+		},
+		{
+			name: "connect will topic",
+			packet: newConnect(func(p *mqtt5.ConnectPacket) {
+				p.WillFlag = true
+				p.WillTopic = "a/+"
+			}),
+			expected:   "CONNACK reason code 0x90: will topic name 'a/+' contains wildcard characters",
+			reasonCode: mqtt5.TopicNameInvalid,
+		},
+		{
+			name:   "publish empty topic with alias",
+			packet: newPublish(func(p *mqtt5.PublishPacket) { p.TopicName = ""; p.PublishProperties.TopicAlias = &alias }),
+		},
+		{
+			name:       "publish empty topic without alias",
+			packet:     newPublish(func(p *mqtt5.PublishPacket) { p.TopicName = "" }),
+			expected:   "DISCONNECT reason code 0x82: empty topic name without topic alias",
+			reasonCode: mqtt5.ProtocolError,
+		},
+		{
+			name:       "publish qos 3",
+			packet:     newPublish(func(p *mqtt5.PublishPacket) { p.Qos = 3 }),
+			expected:   "DISCONNECT reason code 0x81: invalid PUBLISH QoS 3",
+			reasonCode: mqtt5.MalformedPacket,
+		},
+		{
+			name:       "publish topic with wildcard",
+			packet:     newPublish(func(p *mqtt5.PublishPacket) { p.TopicName = "a/+/b" }),
+			expected:   "DISCONNECT reason code 0x90: topic name 'a/+/b' contains wildcard characters",
+			reasonCode: mqtt5.TopicNameInvalid,
+		},
+		{
+			name:       "publish topic with null character",
+			packet:     newPublish(func(p *mqtt5.PublishPacket) { p.TopicName = "a\x00" }),
+			expected:   "DISCONNECT reason code 0x81: topic name: malformed UTF-8 string: null character U+0000",
+			reasonCode: mqtt5.MalformedPacket,
+		},
+		{
+			name: "subscribe retain handling",
+			packet: &mqtt5.SubscribePacket{
+				FixedHeader:        mqttproto.FixedHeader{MessageType: mqttproto.SUBSCRIBE, Qos: mqttproto.AT_LEAST_ONCE},
+				TopicSubscriptions: []mqtt5.TopicSubscription{{TopicFilter: "a/#", RetainHandling: 3}},
+			},
+			expected:   "DISCONNECT reason code 0x81: invalid subscription options for topic filter 'a/#'",
+			reasonCode: mqtt5.MalformedPacket,
+		},
+		{
+			name: "subscribe invalid topic filter",
+			packet: &mqtt5.SubscribePacket{
+				FixedHeader:        mqttproto.FixedHeader{MessageType: mqttproto.SUBSCRIBE, Qos: mqttproto.AT_LEAST_ONCE},
+				TopicSubscriptions: []mqtt5.TopicSubscription{{TopicFilter: "a+"}},
+			},
+			expected:   "DISCONNECT reason code 0x8f: topic filter 'a+' has invalid single-level wildcard",
+			reasonCode: mqtt5.TopicFilterInvalid,
+		},
+		{
+			name:       "pubrel fixed header flags",
+			packet:     mqtt5.NewControlPacket(mqttproto.PUBREL),
+			expected:   "DISCONNECT reason code 0x81: invalid fixed header flags 0x0 for PUBREL, expected 0x2",
+			reasonCode: mqtt5.MalformedPacket,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := ValidateStrict(tc.packet)
+			if tc.expected == "" {
+				a.Nil(err)
+				return
+			}
+			a.EqualError(err, tc.expected)
+			switch e := err.(type) {
+			case *mqtt5.ConnectAckError:
+				a.Equal(tc.reasonCode, e.ReasonCode())
+			case *mqtt5.DisconnectError:
+				a.Equal(tc.reasonCode, e.ReasonCode())
+			default:
+				t.Fatalf("unexpected error type %T", err)
+			}
+		})
+	}
+}
+
+func TestReadPacketStrict(t *testing.T) {
+	// CONNECT with the reserved flag set
+	encodedBytes, err := hex.DecodeString("101000044d5154540403003c000474657374")
+	require.Nil(t, err)
+
+	_, err = ReadPacket(bytes.NewReader(encodedBytes), 0)
+	require.Nil(t, err)
+
+	_, err = ReadPacket(bytes.NewReader(encodedBytes), 0, mqttproto.WithStrict(true))
+	require.EqualError(t, err, "CONNECT reserved flag is set")
+}
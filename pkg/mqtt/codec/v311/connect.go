@@ -34,6 +34,9 @@ func (p *ConnectPacket) Type() byte {
 }
 
 func (p *ConnectPacket) Version() byte {
+	if p.ProtocolLevel == mqttproto.MQTT_3_1 {
+		return mqttproto.MQTT_3_1
+	}
 	return mqttproto.MQTT_3_1_1
 }
 
@@ -98,6 +98,21 @@ func TestDecodeConnectPacket(t *testing.T) {
 				Password:         []byte("my-password"),
 			},
 		},
+		{
+			name:       "MQTT 3.1",
+			encodedHex: "101200064d51497364700302003c000474657374",
+			packet: &ConnectPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.CONNECT,
+					RemainingLength: 18,
+				},
+				ProtocolName:     mqttproto.MQIsdp,
+				ProtocolLevel:    mqttproto.MQTT_3_1,
+				CleanSession:     true,
+				KeepAliveSeconds: 60,
+				ClientIdentifier: "test",
+			},
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -116,7 +131,7 @@ func TestDecodeConnectPacket(t *testing.T) {
 			}
 			packet := decoded.(*ConnectPacket)
 			a.Equal(*tc.packet, *packet)
-			a.Equal(mqttproto.MQTT_3_1_1, packet.Version())
+			a.Equal(tc.packet.ProtocolLevel, packet.Version())
 
 			// encode
 			var output bytes.Buffer
@@ -1,27 +1,23 @@
 package v311
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 
 	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 )
 
-func ReadPacket(r io.Reader) (mqttproto.ControlPacket, error) {
-	var fh mqttproto.FixedHeader
-	b1 := make([]byte, 1)
-	_, err := io.ReadFull(r, b1)
-	if err != nil {
-		return nil, err
-	}
+func ReadPacket(r io.Reader, opts ...mqttproto.ReadOption) (mqttproto.ControlPacket, error) {
+	return ReadPacketWithOptions(r, mqttproto.NewReadOptions(opts...))
+}
 
-	err = fh.Unpack(b1[0], r)
+func ReadPacketWithOptions(r io.Reader, options mqttproto.ReadOptions) (mqttproto.ControlPacket, error) {
+	fh, err := mqttproto.ReadFixedHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	err = fh.Validate()
+	err = options.CheckPacketSize(&fh)
 	if err != nil {
 		return nil, err
 	}
@@ -31,15 +27,15 @@ func ReadPacket(r io.Reader) (mqttproto.ControlPacket, error) {
 		return nil, err
 	}
 
-	packetBytes := make([]byte, fh.RemainingLength)
-	n, err := io.ReadFull(r, packetBytes)
+	body, err := mqttproto.ReadPacketBody(r, &fh, options.PooledBuffers)
 	if err != nil {
 		return nil, err
 	}
-	if n != fh.RemainingLength {
-		return nil, fmt.Errorf("failed to read encoded data, read %d from %d", n, fh.RemainingLength)
+	err = cp.Unpack(body)
+	if _, ok := cp.(mqttproto.Releaser); !ok || err != nil {
+		// only packets implementing Releaser keep references to the body
+		body.Release()
 	}
-	err = cp.Unpack(bytes.NewBuffer(packetBytes))
 	return cp, err
 }
 
@@ -0,0 +1,76 @@
+package v5
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+type AuthPacket struct {
+	mqttproto.FixedHeader
+	ReasonCode     byte
+	AuthProperties Properties
+}
+
+func (p *AuthPacket) Type() byte {
+	return p.MessageType
+}
+
+func (p *AuthPacket) Version() byte {
+	return mqttproto.MQTT_5
+}
+
+func (p *AuthPacket) Name() string {
+	return "AUTH"
+}
+
+func (p *AuthPacket) String() string {
+	return fmt.Sprintf("%v ReasonCode: %d", p.FixedHeader, p.ReasonCode)
+}
+
+func (p *AuthPacket) Write(w io.Writer) (err error) {
+	if p.ReasonCode == 0 && p.AuthProperties.IsEmpty() {
+		packet := p.FixedHeader.Pack()
+		_, err = packet.WriteTo(w)
+		return err
+	} else {
+		var body bytes.Buffer
+		body.WriteByte(p.ReasonCode)
+		body.Write(p.AuthProperties.Encode())
+
+		p.FixedHeader.RemainingLength = body.Len()
+		packet := p.FixedHeader.Pack()
+		packet.Write(body.Bytes())
+		_, err = packet.WriteTo(w)
+		return err
+	}
+}
+
+func (p *AuthPacket) Unpack(b io.Reader) (err error) {
+	// 3.15.2.1 Authenticate Reason Code
+	if p.RemainingLength == 0 {
+		p.ReasonCode = 0
+		p.AuthProperties = Properties{}
+	} else {
+		p.ReasonCode, err = mqttproto.DecodeByte(b)
+		if err != nil {
+			return err
+		}
+		// 3.15.2.2 If the Remaining Length is less than 2, the Property Length is omitted
+		if p.RemainingLength < 2 {
+			p.AuthProperties = Properties{}
+			return nil
+		}
+		err = p.AuthProperties.Unpack(b)
+		if err != nil {
+			return err
+		}
+		err = p.AuthProperties.Validate(mqttproto.AUTH)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
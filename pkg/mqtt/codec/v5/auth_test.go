@@ -0,0 +1,95 @@
+package v5
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+func TestNewAuthPacket(t *testing.T) {
+	a := assert.New(t)
+	packet := NewControlPacket(mqttproto.AUTH).(*AuthPacket)
+	a.Equal(mqttproto.AUTH, packet.MessageType)
+	a.Equal(mqttproto.MqttMessageTypeNames[packet.MessageType], packet.Name())
+	a.Equal(mqttproto.MQTT_5, packet.Version())
+	t.Log(packet)
+}
+
+func TestAuthPacketCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		encodedHex string
+		packet     *AuthPacket
+	}{
+		{
+			name:       "auth success, no properties",
+			encodedHex: "f000",
+			packet: &AuthPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.AUTH,
+					RemainingLength: 0,
+				},
+				ReasonCode:     Success,
+				AuthProperties: Properties{},
+			},
+		},
+		{
+			name:       "continue authentication with method and data",
+			encodedHex: "f00f180d150005534352414d1600026162",
+			packet: &AuthPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.AUTH,
+					RemainingLength: 15,
+				},
+				ReasonCode:     ContinueAuthentication,
+				AuthProperties: Properties{AuthenticationMethod: ptr("SCRAM"), AuthenticationData: []byte("ab")},
+			},
+		},
+		{
+			name:       "re-authenticate with method",
+			encodedHex: "f00a1908150005534352414d",
+			packet: &AuthPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.AUTH,
+					RemainingLength: 10,
+				},
+				ReasonCode:     ReAuthenticate,
+				AuthProperties: Properties{AuthenticationMethod: ptr("SCRAM")},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			t.Log(tc.packet)
+
+			// decode
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(encodedBytes)
+			decoded, err := ReadPacket(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet := decoded.(*AuthPacket)
+			a.Equal(*tc.packet, *packet)
+			a.Equal(mqttproto.MQTT_5, packet.Version())
+
+			// encode
+			var output bytes.Buffer
+			err = packet.Write(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Equal(tc.packet.RemainingLength, packet.RemainingLength)
+			encodedBytes = output.Bytes()
+			a.Equal(tc.encodedHex, hex.EncodeToString(encodedBytes))
+		})
+	}
+}
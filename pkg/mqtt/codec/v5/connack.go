@@ -58,7 +58,7 @@ func (p *ConnackPacket) Unpack(b io.Reader) error {
 	if err != nil {
 		return err
 	}
-	return err
+	return p.ConnackProperties.Validate(mqttproto.CONNACK)
 }
 
 func (p *ConnackPacket) getConnAckFlags() byte {
@@ -35,7 +35,7 @@ func TestConnackPacketCodec(t *testing.T) {
 				},
 				SessionPresent:    false,
 				ReturnCode:        0,
-				ConnackProperties: Properties{RawData: []byte{}},
+				ConnackProperties: Properties{},
 			},
 		},
 	}
@@ -112,6 +112,10 @@ func (p *ConnectPacket) Unpack(r io.Reader) (err error) {
 	if err != nil {
 		return err
 	}
+	err = p.ConnectProperties.Validate(mqttproto.CONNECT)
+	if err != nil {
+		return err
+	}
 	// payload
 	p.ClientIdentifier, err = mqttproto.DecodeString(r)
 	if err != nil {
@@ -122,6 +126,10 @@ func (p *ConnectPacket) Unpack(r io.Reader) (err error) {
 		if err != nil {
 			return err
 		}
+		err = p.WillProperties.Validate(WILL)
+		if err != nil {
+			return err
+		}
 		p.WillTopic, err = mqttproto.DecodeString(r)
 		if err != nil {
 			return err
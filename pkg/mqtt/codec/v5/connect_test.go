@@ -36,7 +36,7 @@ func TestDecodeConnectPacket(t *testing.T) {
 				ProtocolLevel:     mqttproto.MQTT_5,
 				CleanStart:        true,
 				KeepAliveSeconds:  60,
-				ConnectProperties: Properties{RawData: MustHexDecodeString("210014")},
+				ConnectProperties: Properties{ReceiveMaximum: ptr(uint16(20))},
 			},
 		},
 		{
@@ -51,11 +51,11 @@ func TestDecodeConnectPacket(t *testing.T) {
 				ProtocolLevel:     mqttproto.MQTT_5,
 				CleanStart:        true,
 				KeepAliveSeconds:  60,
-				ConnectProperties: Properties{RawData: MustHexDecodeString("210014")},
+				ConnectProperties: Properties{ReceiveMaximum: ptr(uint16(20))},
 				WillFlag:          true,
 				WillTopic:         "mytopic",
 				WillPayload:       []byte("mymessage"),
-				WillProperties:    Properties{RawData: []byte{}},
+				WillProperties:    Properties{},
 			},
 		},
 		{
@@ -70,11 +70,11 @@ func TestDecodeConnectPacket(t *testing.T) {
 				ProtocolLevel:     mqttproto.MQTT_5,
 				CleanStart:        true,
 				KeepAliveSeconds:  60,
-				ConnectProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262210014")},
+				ConnectProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}, ReceiveMaximum: ptr(uint16(20))},
 				WillFlag:          true,
 				WillTopic:         "mytopic",
 				WillPayload:       []byte{},
-				WillProperties:    Properties{RawData: MustHexDecodeString("0800076d79746f706963")},
+				WillProperties:    Properties{ResponseTopic: ptr("mytopic")},
 			},
 		},
 	}
@@ -31,7 +31,7 @@ func (p *DisconnectPacket) String() string {
 }
 
 func (p *DisconnectPacket) Write(w io.Writer) (err error) {
-	if p.ReasonCode == 0 && len(p.DisconnectProperties.RawData) == 0 {
+	if p.ReasonCode == 0 && p.DisconnectProperties.IsEmpty() {
 		packet := p.FixedHeader.Pack()
 		_, err = packet.WriteTo(w)
 		return err
@@ -52,16 +52,25 @@ func (p *DisconnectPacket) Unpack(b io.Reader) (err error) {
 	// 3.14.2.1 Disconnect Reason Code
 	if p.RemainingLength == 0 {
 		p.ReasonCode = 0
-		p.DisconnectProperties = Properties{RawData: []byte{}}
+		p.DisconnectProperties = Properties{}
 	} else {
 		p.ReasonCode, err = mqttproto.DecodeByte(b)
 		if err != nil {
 			return err
 		}
+		// 3.14.2.2 If the Remaining Length is less than 2, the Property Length is omitted
+		if p.RemainingLength < 2 {
+			p.DisconnectProperties = Properties{}
+			return nil
+		}
 		err = p.DisconnectProperties.Unpack(b)
 		if err != nil {
 			return err
 		}
+		err = p.DisconnectProperties.Validate(mqttproto.DISCONNECT)
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
@@ -34,7 +34,7 @@ func TestDisconnectPacketCodec(t *testing.T) {
 					RemainingLength: 0,
 				},
 				ReasonCode:           0,
-				DisconnectProperties: Properties{RawData: []byte{}},
+				DisconnectProperties: Properties{},
 			},
 		},
 		{
@@ -46,7 +46,7 @@ func TestDisconnectPacketCodec(t *testing.T) {
 					RemainingLength: 2,
 				},
 				ReasonCode:           0x80,
-				DisconnectProperties: Properties{RawData: []byte{}},
+				DisconnectProperties: Properties{},
 			},
 		},
 		{
@@ -58,7 +58,7 @@ func TestDisconnectPacketCodec(t *testing.T) {
 					RemainingLength: 13,
 				},
 				ReasonCode:           0,
-				DisconnectProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262")},
+				DisconnectProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}},
 			},
 		},
 		{
@@ -70,7 +70,7 @@ func TestDisconnectPacketCodec(t *testing.T) {
 					RemainingLength: 19,
 				},
 				ReasonCode:           0x80,
-				DisconnectProperties: Properties{RawData: MustHexDecodeString("2600056d796b657900076d7976616c7565")},
+				DisconnectProperties: Properties{UserProperties: []UserProperty{{Key: "mykey", Value: "myvalue"}}},
 			},
 		},
 	}
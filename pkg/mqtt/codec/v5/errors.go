@@ -0,0 +1,63 @@
+package v5
+
+import (
+	"fmt"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+// NewResponseError returns an error answered with CONNACK for the CONNECT packet or DISCONNECT for other packets.
+func NewResponseError(messageType byte, reasonCode byte, text string) error {
+	if messageType == mqttproto.CONNECT {
+		return NewConnAckError(reasonCode, text)
+	}
+	return NewDisconnectError(reasonCode, text)
+}
+
+func NewConnAckError(reasonCode byte, text string) error {
+	return &ConnectAckError{rc: reasonCode, s: text}
+}
+
+type ConnectAckError struct {
+	rc byte
+	s  string
+}
+
+func (e *ConnectAckError) Error() string {
+	return fmt.Sprintf("CONNACK reason code 0x%x: %s", e.rc, e.s)
+}
+
+func (e *ConnectAckError) ReasonCode() byte {
+	return e.rc
+}
+
+func (e *ConnectAckError) Response() mqttproto.ControlPacket {
+	packet := NewControlPacket(mqttproto.CONNACK).(*ConnackPacket)
+	packet.ReturnCode = e.rc
+	packet.ConnackProperties.ReasonString = StringProperty(e.s)
+	return packet
+}
+
+func NewDisconnectError(reasonCode byte, text string) error {
+	return &DisconnectError{rc: reasonCode, s: text}
+}
+
+type DisconnectError struct {
+	rc byte
+	s  string
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("DISCONNECT reason code 0x%x: %s", e.rc, e.s)
+}
+
+func (e *DisconnectError) ReasonCode() byte {
+	return e.rc
+}
+
+func (e *DisconnectError) Response() mqttproto.ControlPacket {
+	packet := NewControlPacket(mqttproto.DISCONNECT).(*DisconnectPacket)
+	packet.ReasonCode = e.rc
+	packet.DisconnectProperties.ReasonString = StringProperty(e.s)
+	return packet
+}
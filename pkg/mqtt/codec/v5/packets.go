@@ -1,29 +1,25 @@
 package v5
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 
 	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 )
 
-func ReadPacket(r io.Reader) (mqttproto.ControlPacket, error) {
-	var fh mqttproto.FixedHeader
-	b1 := make([]byte, 1)
-	_, err := io.ReadFull(r, b1)
-	if err != nil {
-		return nil, err
-	}
+func ReadPacket(r io.Reader, opts ...mqttproto.ReadOption) (mqttproto.ControlPacket, error) {
+	return ReadPacketWithOptions(r, mqttproto.NewReadOptions(opts...))
+}
 
-	err = fh.Unpack(b1[0], r)
+func ReadPacketWithOptions(r io.Reader, options mqttproto.ReadOptions) (mqttproto.ControlPacket, error) {
+	fh, err := mqttproto.ReadFixedHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	err = fh.Validate()
+	err = options.CheckPacketSize(&fh)
 	if err != nil {
-		return nil, err
+		return nil, NewResponseError(fh.MessageType, PacketTooLarge, err.Error())
 	}
 
 	cp, err := NewControlPacketWithHeader(fh)
@@ -31,16 +27,20 @@ func ReadPacket(r io.Reader) (mqttproto.ControlPacket, error) {
 		return nil, err
 	}
 
-	packetBytes := make([]byte, fh.RemainingLength)
-	n, err := io.ReadFull(r, packetBytes)
+	body, err := mqttproto.ReadPacketBody(r, &fh, options.PooledBuffers)
 	if err != nil {
 		return nil, err
 	}
-	if n != fh.RemainingLength {
-		return nil, fmt.Errorf("failed to read encoded data, read %d from %d", n, fh.RemainingLength)
+	err = cp.Unpack(body)
+	if _, ok := cp.(mqttproto.Releaser); !ok || err != nil {
+		// only packets implementing Releaser keep references to the body
+		body.Release()
+	}
+	if err != nil {
+		// the whole body was read, so the client is told that its packet is malformed
+		return nil, NewResponseError(fh.MessageType, MalformedPacket, err.Error())
 	}
-	err = cp.Unpack(bytes.NewBuffer(packetBytes))
-	return cp, err
+	return cp, nil
 }
 
 func NewControlPacket(packetType byte) mqttproto.ControlPacket {
@@ -59,12 +59,22 @@ func NewControlPacket(packetType byte) mqttproto.ControlPacket {
 		return &PubrelPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.PUBREL}}
 	case mqttproto.PUBCOMP:
 		return &PubcompPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.PUBCOMP}}
+	case mqttproto.SUBSCRIBE:
+		return &SubscribePacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.SUBSCRIBE}}
+	case mqttproto.SUBACK:
+		return &SubackPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.SUBACK}}
+	case mqttproto.UNSUBSCRIBE:
+		return &UnsubscribePacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.UNSUBSCRIBE}}
+	case mqttproto.UNSUBACK:
+		return &UnsubackPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.UNSUBACK}}
 	case mqttproto.PINGREQ:
 		return &PingreqPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.PINGREQ}}
 	case mqttproto.PINGRESP:
 		return &PingrespPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.PINGRESP}}
 	case mqttproto.DISCONNECT:
 		return &DisconnectPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.DISCONNECT}}
+	case mqttproto.AUTH:
+		return &AuthPacket{FixedHeader: mqttproto.FixedHeader{MessageType: mqttproto.AUTH}}
 	}
 	return nil
 }
@@ -85,12 +95,22 @@ func NewControlPacketWithHeader(fh mqttproto.FixedHeader) (mqttproto.ControlPack
 		return &PubrelPacket{FixedHeader: fh}, nil
 	case mqttproto.PUBCOMP:
 		return &PubcompPacket{FixedHeader: fh}, nil
+	case mqttproto.SUBSCRIBE:
+		return &SubscribePacket{FixedHeader: fh}, nil
+	case mqttproto.SUBACK:
+		return &SubackPacket{FixedHeader: fh}, nil
+	case mqttproto.UNSUBSCRIBE:
+		return &UnsubscribePacket{FixedHeader: fh}, nil
+	case mqttproto.UNSUBACK:
+		return &UnsubackPacket{FixedHeader: fh}, nil
 	case mqttproto.PINGREQ:
 		return &PingreqPacket{FixedHeader: fh}, nil
 	case mqttproto.PINGRESP:
 		return &PingrespPacket{FixedHeader: fh}, nil
 	case mqttproto.DISCONNECT:
 		return &DisconnectPacket{FixedHeader: fh}, nil
+	case mqttproto.AUTH:
+		return &AuthPacket{FixedHeader: fh}, nil
 	default:
 		return nil, fmt.Errorf("unsupported packet type 0x%x", fh.MessageType)
 	}
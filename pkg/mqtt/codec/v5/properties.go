@@ -3,13 +3,142 @@ package v5
 import (
 	"bytes"
 	"fmt"
-	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 	"io"
+	"unicode/utf8"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 )
 
+// MQTT 5 - 2.2.2.2 Property identifiers
+const (
+	PropPayloadFormatIndicator          byte = 0x01
+	PropMessageExpiryInterval           byte = 0x02
+	PropContentType                     byte = 0x03
+	PropResponseTopic                   byte = 0x08
+	PropCorrelationData                 byte = 0x09
+	PropSubscriptionIdentifier          byte = 0x0B
+	PropSessionExpiryInterval           byte = 0x11
+	PropAssignedClientIdentifier        byte = 0x12
+	PropServerKeepAlive                 byte = 0x13
+	PropAuthenticationMethod            byte = 0x15
+	PropAuthenticationData              byte = 0x16
+	PropRequestProblemInformation       byte = 0x17
+	PropWillDelayInterval               byte = 0x18
+	PropRequestResponseInformation      byte = 0x19
+	PropResponseInformation             byte = 0x1A
+	PropServerReference                 byte = 0x1C
+	PropReasonString                    byte = 0x1F
+	PropReceiveMaximum                  byte = 0x21
+	PropTopicAliasMaximum               byte = 0x22
+	PropTopicAlias                      byte = 0x23
+	PropMaximumQoS                      byte = 0x24
+	PropRetainAvailable                 byte = 0x25
+	PropUserProperty                    byte = 0x26
+	PropMaximumPacketSize               byte = 0x27
+	PropWildcardSubscriptionAvailable   byte = 0x28
+	PropSubscriptionIdentifierAvailable byte = 0x29
+	PropSharedSubscriptionAvailable     byte = 0x2A
+)
+
+// WILL is a pseudo packet type used to validate the will properties of the CONNECT payload.
+const WILL byte = 0
+
+var PropertyNames = map[byte]string{
+	PropPayloadFormatIndicator:          "Payload Format Indicator",
+	PropMessageExpiryInterval:           "Message Expiry Interval",
+	PropContentType:                     "Content Type",
+	PropResponseTopic:                   "Response Topic",
+	PropCorrelationData:                 "Correlation Data",
+	PropSubscriptionIdentifier:          "Subscription Identifier",
+	PropSessionExpiryInterval:           "Session Expiry Interval",
+	PropAssignedClientIdentifier:        "Assigned Client Identifier",
+	PropServerKeepAlive:                 "Server Keep Alive",
+	PropAuthenticationMethod:            "Authentication Method",
+	PropAuthenticationData:              "Authentication Data",
+	PropRequestProblemInformation:       "Request Problem Information",
+	PropWillDelayInterval:               "Will Delay Interval",
+	PropRequestResponseInformation:      "Request Response Information",
+	PropResponseInformation:             "Response Information",
+	PropServerReference:                 "Server Reference",
+	PropReasonString:                    "Reason String",
+	PropReceiveMaximum:                  "Receive Maximum",
+	PropTopicAliasMaximum:               "Topic Alias Maximum",
+	PropTopicAlias:                      "Topic Alias",
+	PropMaximumQoS:                      "Maximum QoS",
+	PropRetainAvailable:                 "Retain Available",
+	PropUserProperty:                    "User Property",
+	PropMaximumPacketSize:               "Maximum Packet Size",
+	PropWildcardSubscriptionAvailable:   "Wildcard Subscription Available",
+	PropSubscriptionIdentifierAvailable: "Subscription Identifier Available",
+	PropSharedSubscriptionAvailable:     "Shared Subscription Available",
+}
+
+// propertyPacketTypes lists the packet types in which a property may be used.
+var propertyPacketTypes = map[byte][]byte{
+	PropPayloadFormatIndicator:          {mqttproto.PUBLISH, WILL},
+	PropMessageExpiryInterval:           {mqttproto.PUBLISH, WILL},
+	PropContentType:                     {mqttproto.PUBLISH, WILL},
+	PropResponseTopic:                   {mqttproto.PUBLISH, WILL},
+	PropCorrelationData:                 {mqttproto.PUBLISH, WILL},
+	PropSubscriptionIdentifier:          {mqttproto.PUBLISH, mqttproto.SUBSCRIBE},
+	PropSessionExpiryInterval:           {mqttproto.CONNECT, mqttproto.CONNACK, mqttproto.DISCONNECT},
+	PropAssignedClientIdentifier:        {mqttproto.CONNACK},
+	PropServerKeepAlive:                 {mqttproto.CONNACK},
+	PropAuthenticationMethod:            {mqttproto.CONNECT, mqttproto.CONNACK, mqttproto.AUTH},
+	PropAuthenticationData:              {mqttproto.CONNECT, mqttproto.CONNACK, mqttproto.AUTH},
+	PropRequestProblemInformation:       {mqttproto.CONNECT},
+	PropWillDelayInterval:               {WILL},
+	PropRequestResponseInformation:      {mqttproto.CONNECT},
+	PropResponseInformation:             {mqttproto.CONNACK},
+	PropServerReference:                 {mqttproto.CONNACK, mqttproto.DISCONNECT},
+	PropReasonString:                    {mqttproto.CONNACK, mqttproto.PUBACK, mqttproto.PUBREC, mqttproto.PUBREL, mqttproto.PUBCOMP, mqttproto.SUBACK, mqttproto.UNSUBACK, mqttproto.DISCONNECT, mqttproto.AUTH},
+	PropReceiveMaximum:                  {mqttproto.CONNECT, mqttproto.CONNACK},
+	PropTopicAliasMaximum:               {mqttproto.CONNECT, mqttproto.CONNACK},
+	PropTopicAlias:                      {mqttproto.PUBLISH},
+	PropMaximumQoS:                      {mqttproto.CONNACK},
+	PropRetainAvailable:                 {mqttproto.CONNACK},
+	PropUserProperty:                    {mqttproto.CONNECT, mqttproto.CONNACK, mqttproto.PUBLISH, WILL, mqttproto.PUBACK, mqttproto.PUBREC, mqttproto.PUBREL, mqttproto.PUBCOMP, mqttproto.SUBSCRIBE, mqttproto.SUBACK, mqttproto.UNSUBSCRIBE, mqttproto.UNSUBACK, mqttproto.DISCONNECT, mqttproto.AUTH},
+	PropMaximumPacketSize:               {mqttproto.CONNECT, mqttproto.CONNACK},
+	PropWildcardSubscriptionAvailable:   {mqttproto.CONNACK},
+	PropSubscriptionIdentifierAvailable: {mqttproto.CONNACK},
+	PropSharedSubscriptionAvailable:     {mqttproto.CONNACK},
+}
+
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// Properties holds the decoded MQTT 5 properties.
+// Absent properties are nil, so that a property present with an empty value is kept when re-encoded.
 type Properties struct {
-	// Data without property length
-	RawData []byte
+	PayloadFormatIndicator          *byte
+	MessageExpiryInterval           *uint32
+	ContentType                     *string
+	ResponseTopic                   *string
+	CorrelationData                 []byte
+	SubscriptionIdentifier          []int
+	SessionExpiryInterval           *uint32
+	AssignedClientIdentifier        *string
+	ServerKeepAlive                 *uint16
+	AuthenticationMethod            *string
+	AuthenticationData              []byte
+	RequestProblemInformation       *byte
+	WillDelayInterval               *uint32
+	RequestResponseInformation      *byte
+	ResponseInformation             *string
+	ServerReference                 *string
+	ReasonString                    *string
+	ReceiveMaximum                  *uint16
+	TopicAliasMaximum               *uint16
+	TopicAlias                      *uint16
+	MaximumQoS                      *byte
+	RetainAvailable                 *byte
+	UserProperties                  []UserProperty
+	MaximumPacketSize               *uint32
+	WildcardSubscriptionAvailable   *byte
+	SubscriptionIdentifierAvailable *byte
+	SharedSubscriptionAvailable     *byte
 }
 
 func (p *Properties) Unpack(r io.Reader) (err error) {
@@ -20,26 +149,353 @@ func (p *Properties) Unpack(r io.Reader) (err error) {
 	if totalLength < 0 {
 		return fmt.Errorf("negative property length %d", totalLength)
 	}
-	rawData := make([]byte, totalLength)
-	n, err := io.ReadFull(r, rawData)
-	if err != nil {
-		return err
+	*p = Properties{}
+	if totalLength == 0 {
+		return nil
+	}
+	lr := &io.LimitedReader{R: r, N: int64(totalLength)}
+	var seen [PropSharedSubscriptionAvailable + 1]bool
+	for lr.N > 0 {
+		identifier, err := mqttproto.DecodeUvarint(lr)
+		if err != nil {
+			return err
+		}
+		if identifier > int(PropSharedSubscriptionAvailable) || propertyPacketTypes[byte(identifier)] == nil {
+			return fmt.Errorf("unknown property identifier 0x%x", identifier)
+		}
+		id := byte(identifier)
+		if seen[id] && id != PropUserProperty && id != PropSubscriptionIdentifier {
+			return fmt.Errorf("property '%s' included more than once", PropertyNames[id])
+		}
+		seen[id] = true
+
+		err = p.unpackProperty(id, lr)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("decode property '%s': %w", PropertyNames[id], err)
+		}
 	}
-	if n != totalLength {
-		return fmt.Errorf("failed to read encoded data, read %d from %d", n, totalLength)
+	return nil
+}
+
+func (p *Properties) unpackProperty(id byte, r io.Reader) (err error) {
+	switch id {
+	case PropPayloadFormatIndicator:
+		p.PayloadFormatIndicator, err = decodeBytePtr(r)
+	case PropMessageExpiryInterval:
+		p.MessageExpiryInterval, err = decodeUint32Ptr(r)
+	case PropContentType:
+		p.ContentType, err = decodeUTF8StringPtr(r)
+	case PropResponseTopic:
+		p.ResponseTopic, err = decodeUTF8StringPtr(r)
+	case PropCorrelationData:
+		p.CorrelationData, err = mqttproto.DecodeBytes(r)
+	case PropSubscriptionIdentifier:
+		var v int
+		v, err = mqttproto.DecodeUvarint(r)
+		p.SubscriptionIdentifier = append(p.SubscriptionIdentifier, v)
+	case PropSessionExpiryInterval:
+		p.SessionExpiryInterval, err = decodeUint32Ptr(r)
+	case PropAssignedClientIdentifier:
+		p.AssignedClientIdentifier, err = decodeUTF8StringPtr(r)
+	case PropServerKeepAlive:
+		p.ServerKeepAlive, err = decodeUint16Ptr(r)
+	case PropAuthenticationMethod:
+		p.AuthenticationMethod, err = decodeUTF8StringPtr(r)
+	case PropAuthenticationData:
+		p.AuthenticationData, err = mqttproto.DecodeBytes(r)
+	case PropRequestProblemInformation:
+		p.RequestProblemInformation, err = decodeBytePtr(r)
+	case PropWillDelayInterval:
+		p.WillDelayInterval, err = decodeUint32Ptr(r)
+	case PropRequestResponseInformation:
+		p.RequestResponseInformation, err = decodeBytePtr(r)
+	case PropResponseInformation:
+		p.ResponseInformation, err = decodeUTF8StringPtr(r)
+	case PropServerReference:
+		p.ServerReference, err = decodeUTF8StringPtr(r)
+	case PropReasonString:
+		p.ReasonString, err = decodeUTF8StringPtr(r)
+	case PropReceiveMaximum:
+		p.ReceiveMaximum, err = decodeUint16Ptr(r)
+	case PropTopicAliasMaximum:
+		p.TopicAliasMaximum, err = decodeUint16Ptr(r)
+	case PropTopicAlias:
+		p.TopicAlias, err = decodeUint16Ptr(r)
+	case PropMaximumQoS:
+		p.MaximumQoS, err = decodeBytePtr(r)
+	case PropRetainAvailable:
+		p.RetainAvailable, err = decodeBytePtr(r)
+	case PropUserProperty:
+		var key, value string
+		key, err = decodeUTF8String(r)
+		if err != nil {
+			return err
+		}
+		value, err = decodeUTF8String(r)
+		p.UserProperties = append(p.UserProperties, UserProperty{Key: key, Value: value})
+	case PropMaximumPacketSize:
+		p.MaximumPacketSize, err = decodeUint32Ptr(r)
+	case PropWildcardSubscriptionAvailable:
+		p.WildcardSubscriptionAvailable, err = decodeBytePtr(r)
+	case PropSubscriptionIdentifierAvailable:
+		p.SubscriptionIdentifierAvailable, err = decodeBytePtr(r)
+	case PropSharedSubscriptionAvailable:
+		p.SharedSubscriptionAvailable, err = decodeBytePtr(r)
+	default:
+		err = fmt.Errorf("unknown property identifier 0x%x", id)
 	}
-	p.RawData = rawData
 	return err
 }
 
+// Validate checks if the properties are allowed in the packet type and if their values are in the valid range.
+func (p *Properties) Validate(packetType byte) error {
+	for _, id := range p.identifiers() {
+		if !isPropertyAllowed(id, packetType) {
+			return fmt.Errorf("property '%s' is not allowed in %s", PropertyNames[id], packetTypeName(packetType))
+		}
+	}
+	for _, v := range []struct {
+		id    byte
+		value *byte
+	}{
+		{PropPayloadFormatIndicator, p.PayloadFormatIndicator},
+		{PropRequestProblemInformation, p.RequestProblemInformation},
+		{PropRequestResponseInformation, p.RequestResponseInformation},
+		{PropMaximumQoS, p.MaximumQoS},
+		{PropRetainAvailable, p.RetainAvailable},
+		{PropWildcardSubscriptionAvailable, p.WildcardSubscriptionAvailable},
+		{PropSubscriptionIdentifierAvailable, p.SubscriptionIdentifierAvailable},
+		{PropSharedSubscriptionAvailable, p.SharedSubscriptionAvailable},
+	} {
+		if v.value != nil && *v.value > 1 {
+			return fmt.Errorf("property '%s' has invalid value %d", PropertyNames[v.id], *v.value)
+		}
+	}
+	for _, v := range []struct {
+		id    byte
+		isSet bool
+	}{
+		{PropReceiveMaximum, p.ReceiveMaximum != nil && *p.ReceiveMaximum == 0},
+		{PropTopicAlias, p.TopicAlias != nil && *p.TopicAlias == 0},
+		{PropMaximumPacketSize, p.MaximumPacketSize != nil && *p.MaximumPacketSize == 0},
+	} {
+		if v.isSet {
+			return fmt.Errorf("property '%s' must not be 0", PropertyNames[v.id])
+		}
+	}
+	for _, subscriptionIdentifier := range p.SubscriptionIdentifier {
+		if subscriptionIdentifier == 0 {
+			return fmt.Errorf("property '%s' must not be 0", PropertyNames[PropSubscriptionIdentifier])
+		}
+	}
+	if packetType == mqttproto.SUBSCRIBE && len(p.SubscriptionIdentifier) > 1 {
+		return fmt.Errorf("property '%s' included more than once", PropertyNames[PropSubscriptionIdentifier])
+	}
+	if p.AuthenticationData != nil && p.AuthenticationMethod == nil {
+		return fmt.Errorf("property '%s' without '%s'", PropertyNames[PropAuthenticationData], PropertyNames[PropAuthenticationMethod])
+	}
+	return nil
+}
+
 func (p *Properties) Write(w io.Writer) (err error) {
 	_, err = w.Write(p.Encode())
 	return err
 }
 
+// Encode returns the properties prefixed with the property length.
+// User properties are written first, followed by the remaining properties in identifier order.
 func (p *Properties) Encode() []byte {
+	body := p.encodeBody()
+	var buf bytes.Buffer
+	mqttproto.WriteUvarint(&buf, uint32(len(body)))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// StringProperty returns a string property value which is absent if s is empty.
+func StringProperty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// IsEmpty returns true if no property is set.
+func (p *Properties) IsEmpty() bool {
+	return len(p.identifiers()) == 0
+}
+
+func (p *Properties) encodeBody() []byte {
 	var buf bytes.Buffer
-	mqttproto.WriteUvarint(&buf, uint32(len(p.RawData)))
-	buf.Write(p.RawData)
+	for _, up := range p.UserProperties {
+		buf.WriteByte(PropUserProperty)
+		buf.Write(mqttproto.EncodeString(up.Key))
+		buf.Write(mqttproto.EncodeString(up.Value))
+	}
+	encodeBytePtr(&buf, PropPayloadFormatIndicator, p.PayloadFormatIndicator)
+	encodeUint32Ptr(&buf, PropMessageExpiryInterval, p.MessageExpiryInterval)
+	encodeString(&buf, PropContentType, p.ContentType)
+	encodeString(&buf, PropResponseTopic, p.ResponseTopic)
+	encodeBinary(&buf, PropCorrelationData, p.CorrelationData)
+	for _, v := range p.SubscriptionIdentifier {
+		buf.WriteByte(PropSubscriptionIdentifier)
+		mqttproto.WriteUvarint(&buf, uint32(v))
+	}
+	encodeUint32Ptr(&buf, PropSessionExpiryInterval, p.SessionExpiryInterval)
+	encodeString(&buf, PropAssignedClientIdentifier, p.AssignedClientIdentifier)
+	encodeUint16Ptr(&buf, PropServerKeepAlive, p.ServerKeepAlive)
+	encodeString(&buf, PropAuthenticationMethod, p.AuthenticationMethod)
+	encodeBinary(&buf, PropAuthenticationData, p.AuthenticationData)
+	encodeBytePtr(&buf, PropRequestProblemInformation, p.RequestProblemInformation)
+	encodeUint32Ptr(&buf, PropWillDelayInterval, p.WillDelayInterval)
+	encodeBytePtr(&buf, PropRequestResponseInformation, p.RequestResponseInformation)
+	encodeString(&buf, PropResponseInformation, p.ResponseInformation)
+	encodeString(&buf, PropServerReference, p.ServerReference)
+	encodeString(&buf, PropReasonString, p.ReasonString)
+	encodeUint16Ptr(&buf, PropReceiveMaximum, p.ReceiveMaximum)
+	encodeUint16Ptr(&buf, PropTopicAliasMaximum, p.TopicAliasMaximum)
+	encodeUint16Ptr(&buf, PropTopicAlias, p.TopicAlias)
+	encodeBytePtr(&buf, PropMaximumQoS, p.MaximumQoS)
+	encodeBytePtr(&buf, PropRetainAvailable, p.RetainAvailable)
+	encodeUint32Ptr(&buf, PropMaximumPacketSize, p.MaximumPacketSize)
+	encodeBytePtr(&buf, PropWildcardSubscriptionAvailable, p.WildcardSubscriptionAvailable)
+	encodeBytePtr(&buf, PropSubscriptionIdentifierAvailable, p.SubscriptionIdentifierAvailable)
+	encodeBytePtr(&buf, PropSharedSubscriptionAvailable, p.SharedSubscriptionAvailable)
 	return buf.Bytes()
 }
+
+// identifiers returns the identifiers of the properties which are set.
+func (p *Properties) identifiers() []byte {
+	var ids []byte
+	add := func(id byte, isSet bool) {
+		if isSet {
+			ids = append(ids, id)
+		}
+	}
+	add(PropPayloadFormatIndicator, p.PayloadFormatIndicator != nil)
+	add(PropMessageExpiryInterval, p.MessageExpiryInterval != nil)
+	add(PropContentType, p.ContentType != nil)
+	add(PropResponseTopic, p.ResponseTopic != nil)
+	add(PropCorrelationData, p.CorrelationData != nil)
+	add(PropSubscriptionIdentifier, len(p.SubscriptionIdentifier) != 0)
+	add(PropSessionExpiryInterval, p.SessionExpiryInterval != nil)
+	add(PropAssignedClientIdentifier, p.AssignedClientIdentifier != nil)
+	add(PropServerKeepAlive, p.ServerKeepAlive != nil)
+	add(PropAuthenticationMethod, p.AuthenticationMethod != nil)
+	add(PropAuthenticationData, p.AuthenticationData != nil)
+	add(PropRequestProblemInformation, p.RequestProblemInformation != nil)
+	add(PropWillDelayInterval, p.WillDelayInterval != nil)
+	add(PropRequestResponseInformation, p.RequestResponseInformation != nil)
+	add(PropResponseInformation, p.ResponseInformation != nil)
+	add(PropServerReference, p.ServerReference != nil)
+	add(PropReasonString, p.ReasonString != nil)
+	add(PropReceiveMaximum, p.ReceiveMaximum != nil)
+	add(PropTopicAliasMaximum, p.TopicAliasMaximum != nil)
+	add(PropTopicAlias, p.TopicAlias != nil)
+	add(PropMaximumQoS, p.MaximumQoS != nil)
+	add(PropRetainAvailable, p.RetainAvailable != nil)
+	add(PropUserProperty, len(p.UserProperties) != 0)
+	add(PropMaximumPacketSize, p.MaximumPacketSize != nil)
+	add(PropWildcardSubscriptionAvailable, p.WildcardSubscriptionAvailable != nil)
+	add(PropSubscriptionIdentifierAvailable, p.SubscriptionIdentifierAvailable != nil)
+	add(PropSharedSubscriptionAvailable, p.SharedSubscriptionAvailable != nil)
+	return ids
+}
+
+func isPropertyAllowed(id byte, packetType byte) bool {
+	for _, t := range propertyPacketTypes[id] {
+		if t == packetType {
+			return true
+		}
+	}
+	return false
+}
+
+func packetTypeName(packetType byte) string {
+	if packetType == WILL {
+		return "WILL"
+	}
+	return mqttproto.MqttMessageTypeNames[packetType]
+}
+
+func decodeUTF8String(r io.Reader) (string, error) {
+	s, err := mqttproto.DecodeString(r)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("invalid UTF-8 string")
+	}
+	return s, nil
+}
+
+func decodeUTF8StringPtr(r io.Reader) (*string, error) {
+	s, err := decodeUTF8String(r)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func decodeBytePtr(r io.Reader) (*byte, error) {
+	b := make([]byte, 1)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	return &b[0], nil
+}
+
+func decodeUint16Ptr(r io.Reader) (*uint16, error) {
+	v, err := mqttproto.DecodeUint16(r)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func decodeUint32Ptr(r io.Reader) (*uint32, error) {
+	v, err := mqttproto.DecodeUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func encodeBytePtr(buf *bytes.Buffer, id byte, v *byte) {
+	if v != nil {
+		buf.WriteByte(id)
+		buf.WriteByte(*v)
+	}
+}
+
+func encodeUint16Ptr(buf *bytes.Buffer, id byte, v *uint16) {
+	if v != nil {
+		buf.WriteByte(id)
+		buf.Write(mqttproto.EncodeUint16(*v))
+	}
+}
+
+func encodeUint32Ptr(buf *bytes.Buffer, id byte, v *uint32) {
+	if v != nil {
+		buf.WriteByte(id)
+		buf.Write(mqttproto.EncodeUint32(*v))
+	}
+}
+
+func encodeString(buf *bytes.Buffer, id byte, v *string) {
+	if v != nil {
+		buf.WriteByte(id)
+		buf.Write(mqttproto.EncodeString(*v))
+	}
+}
+
+func encodeBinary(buf *bytes.Buffer, id byte, v []byte) {
+	if v != nil {
+		buf.WriteByte(id)
+		buf.Write(mqttproto.EncodeBytes(v))
+	}
+}
@@ -0,0 +1,230 @@
+package v5
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+func TestPropertiesCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		encodedHex string
+		packetType byte
+		properties Properties
+	}{
+		{
+			name:       "empty",
+			encodedHex: "00",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{},
+		},
+		{
+			name:       "publish",
+			encodedHex: "3a2600036161610003626262260003616161000363636301010200000e1003000a746578742f706c61696e0800057265706c790900020102230005",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{
+				UserProperties: []UserProperty{
+					{Key: "aaa", Value: "bbb"},
+					{Key: "aaa", Value: "ccc"},
+				},
+				PayloadFormatIndicator: ptr(byte(1)),
+				MessageExpiryInterval:  ptr(uint32(3600)),
+				ContentType:            ptr("text/plain"),
+				ResponseTopic:          ptr("reply"),
+				CorrelationData:        []byte{1, 2},
+				TopicAlias:             ptr(uint16(5)),
+			},
+		},
+		{
+			name:       "will",
+			encodedHex: "070101180000003c",
+			packetType: WILL,
+			properties: Properties{
+				PayloadFormatIndicator: ptr(byte(1)),
+				WillDelayInterval:      ptr(uint32(60)),
+			},
+		},
+		{
+			name:       "connect",
+			encodedHex: "221100000078150005534352414d16000301020317011901210014220010270000ffff",
+			packetType: mqttproto.CONNECT,
+			properties: Properties{
+				SessionExpiryInterval:      ptr(uint32(120)),
+				AuthenticationMethod:       ptr("SCRAM"),
+				AuthenticationData:         []byte{1, 2, 3},
+				RequestProblemInformation:  ptr(byte(1)),
+				RequestResponseInformation: ptr(byte(1)),
+				ReceiveMaximum:             ptr(uint16(20)),
+				TopicAliasMaximum:          ptr(uint16(16)),
+				MaximumPacketSize:          ptr(uint32(65535)),
+			},
+		},
+		{
+			name:       "connack",
+			encodedHex: "3511000000001200036162631300781a0004696e666f1c00037372761f0002626521ffff220010240125012700100000280029002a00",
+			packetType: mqttproto.CONNACK,
+			properties: Properties{
+				SessionExpiryInterval:           ptr(uint32(0)),
+				AssignedClientIdentifier:        ptr("abc"),
+				ServerKeepAlive:                 ptr(uint16(120)),
+				ResponseInformation:             ptr("info"),
+				ServerReference:                 ptr("srv"),
+				ReasonString:                    ptr("be"),
+				ReceiveMaximum:                  ptr(uint16(65535)),
+				TopicAliasMaximum:               ptr(uint16(16)),
+				MaximumQoS:                      ptr(byte(1)),
+				RetainAvailable:                 ptr(byte(1)),
+				MaximumPacketSize:               ptr(uint32(1048576)),
+				WildcardSubscriptionAvailable:   ptr(byte(0)),
+				SubscriptionIdentifierAvailable: ptr(byte(0)),
+				SharedSubscriptionAvailable:     ptr(byte(0)),
+			},
+		},
+		{
+			name:       "empty string and binary",
+			encodedHex: "06030000090000",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{
+				ContentType:     ptr(""),
+				CorrelationData: []byte{},
+			},
+		},
+		{
+			name:       "subscription identifiers",
+			encodedHex: "050b010b8001",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{
+				SubscriptionIdentifier: []int{1, 128},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			// encode
+			encoded := tc.properties.Encode()
+			a.Equal(tc.encodedHex, hex.EncodeToString(encoded))
+
+			// decode
+			var decoded Properties
+			err := decoded.Unpack(bytes.NewReader(encoded))
+			a.Nil(err)
+			a.Nil(decoded.Validate(tc.packetType))
+			a.Equal(tc.properties, decoded)
+		})
+	}
+}
+
+func TestPropertiesDecodeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "duplicate property",
+			input:    "06210014210014",
+			expected: "property 'Receive Maximum' included more than once",
+		},
+		{
+			name:     "unknown property",
+			input:    "020400",
+			expected: "unknown property identifier 0x4",
+		},
+		{
+			name:     "property length exceeds data",
+			input:    "0a2100",
+			expected: "decode property 'Receive Maximum': unexpected EOF",
+		},
+		{
+			name:     "invalid UTF-8 string",
+			input:    "0503000261ff",
+			expected: "decode property 'Content Type': invalid UTF-8 string",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := hex.DecodeString(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var properties Properties
+			err = properties.Unpack(bytes.NewReader(input))
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestPropertiesValidationError(t *testing.T) {
+	tests := []struct {
+		name       string
+		packetType byte
+		properties Properties
+		expected   string
+	}{
+		{
+			name:       "topic alias in connect",
+			packetType: mqttproto.CONNECT,
+			properties: Properties{TopicAlias: ptr(uint16(1))},
+			expected:   "property 'Topic Alias' is not allowed in CONNECT",
+		},
+		{
+			name:       "will delay in publish",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{WillDelayInterval: ptr(uint32(1))},
+			expected:   "property 'Will Delay Interval' is not allowed in PUBLISH",
+		},
+		{
+			name:       "reason string in will",
+			packetType: WILL,
+			properties: Properties{ReasonString: ptr("reason")},
+			expected:   "property 'Reason String' is not allowed in WILL",
+		},
+		{
+			name:       "invalid payload format indicator",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{PayloadFormatIndicator: ptr(byte(2))},
+			expected:   "property 'Payload Format Indicator' has invalid value 2",
+		},
+		{
+			name:       "receive maximum 0",
+			packetType: mqttproto.CONNECT,
+			properties: Properties{ReceiveMaximum: ptr(uint16(0))},
+			expected:   "property 'Receive Maximum' must not be 0",
+		},
+		{
+			name:       "topic alias 0",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{TopicAlias: ptr(uint16(0))},
+			expected:   "property 'Topic Alias' must not be 0",
+		},
+		{
+			name:       "subscription identifier 0",
+			packetType: mqttproto.PUBLISH,
+			properties: Properties{SubscriptionIdentifier: []int{0}},
+			expected:   "property 'Subscription Identifier' must not be 0",
+		},
+		{
+			name:       "authentication data without method",
+			packetType: mqttproto.CONNECT,
+			properties: Properties{AuthenticationData: []byte{1}},
+			expected:   "property 'Authentication Data' without 'Authentication Method'",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.properties.Validate(tc.packetType)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
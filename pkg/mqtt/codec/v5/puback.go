@@ -32,7 +32,7 @@ func (p *PubackPacket) String() string {
 }
 
 func (p *PubackPacket) Write(w io.Writer) (err error) {
-	if p.ReasonCode == 0 && len(p.PubackProperties.RawData) == 0 {
+	if p.ReasonCode == 0 && p.PubackProperties.IsEmpty() {
 		p.FixedHeader.RemainingLength = 2
 		packet := p.FixedHeader.Pack()
 		packet.Write(mqttproto.EncodeUint16(p.MessageID))
@@ -60,16 +60,25 @@ func (p *PubackPacket) Unpack(b io.Reader) (err error) {
 	// 3.4.2.1 PUBACK Reason Code
 	if p.RemainingLength == 2 {
 		p.ReasonCode = 0
-		p.PubackProperties = Properties{RawData: []byte{}}
+		p.PubackProperties = Properties{}
 	} else {
 		p.ReasonCode, err = mqttproto.DecodeByte(b)
 		if err != nil {
 			return err
 		}
+		// 3.4.2.2 If the Remaining Length is less than 4, the Property Length is omitted
+		if p.RemainingLength < 4 {
+			p.PubackProperties = Properties{}
+			return nil
+		}
 		err = p.PubackProperties.Unpack(b)
 		if err != nil {
 			return err
 		}
+		err = p.PubackProperties.Validate(mqttproto.PUBACK)
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
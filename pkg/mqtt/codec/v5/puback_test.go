@@ -35,7 +35,7 @@ func TestPubackPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x00,
-				PubackProperties: Properties{RawData: []byte{}},
+				PubackProperties: Properties{},
 			},
 		},
 		{
@@ -48,7 +48,7 @@ func TestPubackPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubackProperties: Properties{RawData: []byte{}},
+				PubackProperties: Properties{},
 			},
 		},
 		{
@@ -61,7 +61,7 @@ func TestPubackPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubackProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262")},
+				PubackProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}},
 			},
 		},
 	}
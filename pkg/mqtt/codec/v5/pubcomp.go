@@ -32,7 +32,7 @@ func (p *PubcompPacket) String() string {
 }
 
 func (p *PubcompPacket) Write(w io.Writer) (err error) {
-	if p.ReasonCode == 0 && len(p.PubcompProperties.RawData) == 0 {
+	if p.ReasonCode == 0 && p.PubcompProperties.IsEmpty() {
 		p.FixedHeader.RemainingLength = 2
 		packet := p.FixedHeader.Pack()
 		packet.Write(mqttproto.EncodeUint16(p.MessageID))
@@ -60,16 +60,25 @@ func (p *PubcompPacket) Unpack(b io.Reader) (err error) {
 	// 3.7.2.1 PUBCOMP Reason Code
 	if p.RemainingLength == 2 {
 		p.ReasonCode = 0
-		p.PubcompProperties = Properties{RawData: []byte{}}
+		p.PubcompProperties = Properties{}
 	} else {
 		p.ReasonCode, err = mqttproto.DecodeByte(b)
 		if err != nil {
 			return err
 		}
+		// 3.7.2.2 If the Remaining Length is less than 4, the Property Length is omitted
+		if p.RemainingLength < 4 {
+			p.PubcompProperties = Properties{}
+			return nil
+		}
 		err = p.PubcompProperties.Unpack(b)
 		if err != nil {
 			return err
 		}
+		err = p.PubcompProperties.Validate(mqttproto.PUBCOMP)
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
@@ -34,7 +34,7 @@ func TestPubcompPacketCodec(t *testing.T) {
 					RemainingLength: 2,
 				},
 				MessageID:         1024,
-				PubcompProperties: Properties{RawData: []byte{}},
+				PubcompProperties: Properties{},
 			},
 		},
 		{
@@ -47,7 +47,7 @@ func TestPubcompPacketCodec(t *testing.T) {
 				},
 				MessageID:         1024,
 				ReasonCode:        0x80,
-				PubcompProperties: Properties{RawData: []byte{}},
+				PubcompProperties: Properties{},
 			},
 		},
 		{
@@ -60,7 +60,7 @@ func TestPubcompPacketCodec(t *testing.T) {
 				},
 				MessageID:         1024,
 				ReasonCode:        0x80,
-				PubcompProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262")},
+				PubcompProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}},
 			},
 		},
 	}
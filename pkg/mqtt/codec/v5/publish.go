@@ -14,6 +14,8 @@ type PublishPacket struct {
 	MessageID         uint16
 	PublishProperties Properties
 	Message           []byte
+
+	buffer *mqttproto.PacketBuffer // pooled buffer referenced by Message
 }
 
 func (p *PublishPacket) Type() byte {
@@ -67,11 +69,35 @@ func (p *PublishPacket) Unpack(r io.Reader) (err error) {
 	if err != nil {
 		return err
 	}
+	err = p.PublishProperties.Validate(mqttproto.PUBLISH)
+	if err != nil {
+		return err
+	}
 	payloadLength -= cr.BytesRead
 	if payloadLength < 0 {
 		return fmt.Errorf("error unpacking publish, payload length < 0")
 	}
+	if pb, ok := r.(*mqttproto.PacketBuffer); ok {
+		// the message references the packet body instead of copying it
+		p.Message, err = pb.Next(payloadLength)
+		if err != nil {
+			return err
+		}
+		if pb.Pooled() {
+			p.buffer = pb
+		}
+		return nil
+	}
 	p.Message = make([]byte, payloadLength)
 	_, err = io.ReadFull(cr, p.Message)
 	return err
 }
+
+// Release returns the buffer holding the message to the pool, the message must not be used afterwards.
+func (p *PublishPacket) Release() {
+	if p.buffer != nil {
+		p.buffer.Release()
+		p.buffer = nil
+		p.Message = nil
+	}
+}
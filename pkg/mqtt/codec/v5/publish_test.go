@@ -36,7 +36,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				},
 				TopicName:         "dummy",
 				Message:           []byte("Hello world qos 0"),
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 		{
@@ -50,7 +50,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				},
 				TopicName:         "dummy",
 				Message:           []byte("on"),
-				PublishProperties: Properties{RawData: MustHexDecodeString("2600056d796b657900076d7976616c7565")},
+				PublishProperties: Properties{UserProperties: []UserProperty{{Key: "mykey", Value: "myvalue"}}},
 			},
 		},
 		{
@@ -64,7 +64,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				},
 				TopicName:         "dummy",
 				Message:           []byte{},
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 		{
@@ -79,7 +79,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				TopicName:         "dummy",
 				MessageID:         1,
 				Message:           []byte("on"),
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 		{
@@ -94,7 +94,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				TopicName:         "dummy",
 				MessageID:         1,
 				Message:           []byte("on"),
-				PublishProperties: Properties{RawData: MustHexDecodeString("2600056d796b657900076d7976616c7565")},
+				PublishProperties: Properties{UserProperties: []UserProperty{{Key: "mykey", Value: "myvalue"}}},
 			},
 		},
 		{
@@ -109,7 +109,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				TopicName:         "dummy",
 				MessageID:         1,
 				Message:           []byte{},
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 		{
@@ -124,7 +124,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				TopicName:         "dummy",
 				MessageID:         1,
 				Message:           []byte("on"),
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 
@@ -140,7 +140,7 @@ func TestPublishPacketCodec(t *testing.T) {
 				TopicName:         "dummy",
 				MessageID:         1,
 				Message:           []byte{},
-				PublishProperties: Properties{RawData: []byte{}},
+				PublishProperties: Properties{},
 			},
 		},
 	}
@@ -32,7 +32,7 @@ func (p *PubrecPacket) String() string {
 }
 
 func (p *PubrecPacket) Write(w io.Writer) (err error) {
-	if p.ReasonCode == 0 && len(p.PubrecProperties.RawData) == 0 {
+	if p.ReasonCode == 0 && p.PubrecProperties.IsEmpty() {
 		p.FixedHeader.RemainingLength = 2
 		packet := p.FixedHeader.Pack()
 		packet.Write(mqttproto.EncodeUint16(p.MessageID))
@@ -60,16 +60,25 @@ func (p *PubrecPacket) Unpack(b io.Reader) (err error) {
 	// 3.5.2.1 PUBREC Reason Code
 	if p.RemainingLength == 2 {
 		p.ReasonCode = 0
-		p.PubrecProperties = Properties{RawData: []byte{}}
+		p.PubrecProperties = Properties{}
 	} else {
 		p.ReasonCode, err = mqttproto.DecodeByte(b)
 		if err != nil {
 			return err
 		}
+		// 3.5.2.2 If the Remaining Length is less than 4, the Property Length is omitted
+		if p.RemainingLength < 4 {
+			p.PubrecProperties = Properties{}
+			return nil
+		}
 		err = p.PubrecProperties.Unpack(b)
 		if err != nil {
 			return err
 		}
+		err = p.PubrecProperties.Validate(mqttproto.PUBREC)
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
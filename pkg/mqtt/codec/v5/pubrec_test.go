@@ -34,7 +34,7 @@ func TestPubrecPacketCodec(t *testing.T) {
 					RemainingLength: 2,
 				},
 				MessageID:        1024,
-				PubrecProperties: Properties{RawData: []byte{}},
+				PubrecProperties: Properties{},
 			},
 		},
 		{
@@ -47,7 +47,7 @@ func TestPubrecPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubrecProperties: Properties{RawData: []byte{}},
+				PubrecProperties: Properties{},
 			},
 		},
 		{
@@ -60,7 +60,7 @@ func TestPubrecPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubrecProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262")},
+				PubrecProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}},
 			},
 		},
 	}
@@ -32,7 +32,7 @@ func (p *PubrelPacket) String() string {
 }
 
 func (p *PubrelPacket) Write(w io.Writer) (err error) {
-	if p.ReasonCode == 0 && len(p.PubrelProperties.RawData) == 0 {
+	if p.ReasonCode == 0 && p.PubrelProperties.IsEmpty() {
 		p.FixedHeader.RemainingLength = 2
 		packet := p.FixedHeader.Pack()
 		packet.Write(mqttproto.EncodeUint16(p.MessageID))
@@ -60,16 +60,25 @@ func (p *PubrelPacket) Unpack(b io.Reader) (err error) {
 	// 3.6.2.1 PUBREL Reason Code
 	if p.RemainingLength == 2 {
 		p.ReasonCode = 0
-		p.PubrelProperties = Properties{RawData: []byte{}}
+		p.PubrelProperties = Properties{}
 	} else {
 		p.ReasonCode, err = mqttproto.DecodeByte(b)
 		if err != nil {
 			return err
 		}
+		// 3.6.2.2 If the Remaining Length is less than 4, the Property Length is omitted
+		if p.RemainingLength < 4 {
+			p.PubrelProperties = Properties{}
+			return nil
+		}
 		err = p.PubrelProperties.Unpack(b)
 		if err != nil {
 			return err
 		}
+		err = p.PubrelProperties.Validate(mqttproto.PUBREL)
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
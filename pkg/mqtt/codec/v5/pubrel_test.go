@@ -35,7 +35,7 @@ func TestPubrelPacketCodec(t *testing.T) {
 					RemainingLength: 2,
 				},
 				MessageID:        1024,
-				PubrelProperties: Properties{RawData: []byte{}},
+				PubrelProperties: Properties{},
 			},
 		},
 		{
@@ -48,7 +48,7 @@ func TestPubrelPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubrelProperties: Properties{RawData: []byte{}},
+				PubrelProperties: Properties{},
 			},
 		},
 		{
@@ -61,7 +61,7 @@ func TestPubrelPacketCodec(t *testing.T) {
 				},
 				MessageID:        1024,
 				ReasonCode:       0x80,
-				PubrelProperties: Properties{RawData: MustHexDecodeString("2600036161610003626262")},
+				PubrelProperties: Properties{UserProperties: []UserProperty{{Key: "aaa", Value: "bbb"}}},
 			},
 		},
 	}
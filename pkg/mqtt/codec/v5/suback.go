@@ -0,0 +1,69 @@
+package v5
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+type SubackPacket struct {
+	mqttproto.FixedHeader
+	MessageID        uint16
+	SubackProperties Properties
+	ReasonCodes      []byte
+}
+
+func (p *SubackPacket) Type() byte {
+	return p.MessageType
+}
+
+func (p *SubackPacket) Version() byte {
+	return mqttproto.MQTT_5
+}
+
+func (p *SubackPacket) Name() string {
+	return "SUBACK"
+}
+
+func (p *SubackPacket) String() string {
+	return fmt.Sprintf("%v MessageID: %d ReasonCodes %v", p.FixedHeader, p.MessageID, p.ReasonCodes)
+}
+
+func (p *SubackPacket) Write(w io.Writer) (err error) {
+	var body bytes.Buffer
+
+	body.Write(mqttproto.EncodeUint16(p.MessageID))
+	body.Write(p.SubackProperties.Encode())
+	body.Write(p.ReasonCodes)
+
+	p.FixedHeader.RemainingLength = body.Len()
+	packet := p.FixedHeader.Pack()
+	packet.Write(body.Bytes())
+	_, err = packet.WriteTo(w)
+	return err
+}
+
+func (p *SubackPacket) Unpack(r io.Reader) (err error) {
+	cr := &mqttproto.CountingReader{Reader: r}
+	p.MessageID, err = mqttproto.DecodeUint16(cr)
+	if err != nil {
+		return err
+	}
+	err = p.SubackProperties.Unpack(cr)
+	if err != nil {
+		return err
+	}
+	err = p.SubackProperties.Validate(mqttproto.SUBACK)
+	if err != nil {
+		return err
+	}
+	payloadLength := p.FixedHeader.RemainingLength - cr.BytesRead
+	if payloadLength > 0 {
+		p.ReasonCodes = make([]byte, payloadLength)
+		_, err = io.ReadFull(r, p.ReasonCodes)
+		return err
+	}
+	return nil
+}
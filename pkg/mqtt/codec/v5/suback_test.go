@@ -0,0 +1,85 @@
+package v5
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+func TestNewSubackPacket(t *testing.T) {
+	a := assert.New(t)
+	packet := NewControlPacket(mqttproto.SUBACK).(*SubackPacket)
+	a.Equal(mqttproto.SUBACK, packet.MessageType)
+	a.Equal(mqttproto.MqttMessageTypeNames[packet.MessageType], packet.Name())
+	a.Equal(mqttproto.MQTT_5, packet.Version())
+	t.Log(packet)
+}
+
+func TestSubackPacketCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		encodedHex string
+		packet     *SubackPacket
+	}{
+		{
+			name:       "granted qos 1",
+			encodedHex: "900400010001",
+			packet: &SubackPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.SUBACK,
+					RemainingLength: 4,
+				},
+				MessageID:        1,
+				SubackProperties: Properties{},
+				ReasonCodes:      []byte{GrantedQoS1},
+			},
+		},
+		{
+			name:       "granted qos 0 and failure, with reason string",
+			encodedHex: "900a0001051f00026f6b0080",
+			packet: &SubackPacket{
+				FixedHeader: mqttproto.FixedHeader{
+					MessageType:     mqttproto.SUBACK,
+					RemainingLength: 10,
+				},
+				MessageID:        1,
+				SubackProperties: Properties{ReasonString: ptr("ok")},
+				ReasonCodes:      []byte{GrantedQoS0, UnspecifiedError},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			t.Log(tc.packet)
+
+			// decode
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(encodedBytes)
+			decoded, err := ReadPacket(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet := decoded.(*SubackPacket)
+			a.Equal(*tc.packet, *packet)
+			a.Equal(mqttproto.MQTT_5, packet.Version())
+
+			// encode
+			var output bytes.Buffer
+			err = packet.Write(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Equal(tc.packet.RemainingLength, packet.RemainingLength)
+			encodedBytes = output.Bytes()
+			a.Equal(tc.encodedHex, hex.EncodeToString(encodedBytes))
+		})
+	}
+}
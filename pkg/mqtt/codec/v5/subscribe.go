@@ -0,0 +1,115 @@
+package v5
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+type TopicSubscription struct {
+	TopicFilter       string
+	Qos               byte
+	NoLocal           bool
+	RetainAsPublished bool
+	RetainHandling    byte
+	ReservedBits      byte
+}
+
+func (ts *TopicSubscription) String() string {
+	return fmt.Sprintf("TopicFilter: %s Qos: %d NoLocal: %t RetainAsPublished: %t RetainHandling: %d", ts.TopicFilter, ts.Qos, ts.NoLocal, ts.RetainAsPublished, ts.RetainHandling)
+}
+
+func (ts *TopicSubscription) getSubscriptionOptions() byte {
+	var options byte
+	options |= ts.Qos & 0x03
+	if ts.NoLocal {
+		options |= 0x04
+	}
+	if ts.RetainAsPublished {
+		options |= 0x08
+	}
+	options |= (ts.RetainHandling & 0x03) << 4
+	options |= (ts.ReservedBits & 0x03) << 6
+	return options
+}
+
+func (ts *TopicSubscription) setSubscriptionOptions(options byte) {
+	ts.Qos = options & 0x03
+	ts.NoLocal = (options & 0x04) == 0x04
+	ts.RetainAsPublished = (options & 0x08) == 0x08
+	ts.RetainHandling = (options & 0x30) >> 4
+	ts.ReservedBits = (options & 0xC0) >> 6
+}
+
+type SubscribePacket struct {
+	mqttproto.FixedHeader
+	MessageID           uint16
+	SubscribeProperties Properties
+	TopicSubscriptions  []TopicSubscription
+}
+
+func (p *SubscribePacket) Type() byte {
+	return p.MessageType
+}
+
+func (p *SubscribePacket) Version() byte {
+	return mqttproto.MQTT_5
+}
+
+func (p *SubscribePacket) Name() string {
+	return "SUBSCRIBE"
+}
+
+func (p *SubscribePacket) String() string {
+	return fmt.Sprintf("%v MessageID: %d %+v", p.FixedHeader, p.MessageID, p.TopicSubscriptions)
+}
+
+func (p *SubscribePacket) Write(w io.Writer) (err error) {
+	var body bytes.Buffer
+
+	body.Write(mqttproto.EncodeUint16(p.MessageID))
+	body.Write(p.SubscribeProperties.Encode())
+	for _, ts := range p.TopicSubscriptions {
+		body.Write(mqttproto.EncodeString(ts.TopicFilter))
+		body.WriteByte(ts.getSubscriptionOptions())
+	}
+	p.FixedHeader.RemainingLength = body.Len()
+	packet := p.FixedHeader.Pack()
+	packet.Write(body.Bytes())
+	_, err = packet.WriteTo(w)
+	return err
+}
+
+func (p *SubscribePacket) Unpack(r io.Reader) (err error) {
+	cr := &mqttproto.CountingReader{Reader: r}
+	p.MessageID, err = mqttproto.DecodeUint16(cr)
+	if err != nil {
+		return err
+	}
+	err = p.SubscribeProperties.Unpack(cr)
+	if err != nil {
+		return err
+	}
+	err = p.SubscribeProperties.Validate(mqttproto.SUBSCRIBE)
+	if err != nil {
+		return err
+	}
+	payloadLength := p.FixedHeader.RemainingLength - cr.BytesRead
+	for payloadLength > 0 {
+		topicFilter, err := mqttproto.DecodeString(r)
+		if err != nil {
+			return err
+		}
+		options, err := mqttproto.DecodeByte(r)
+		if err != nil {
+			return err
+		}
+		ts := TopicSubscription{TopicFilter: topicFilter}
+		ts.setSubscriptionOptions(options)
+		p.TopicSubscriptions = append(p.TopicSubscriptions, ts)
+		payloadLength -= 3 + len(topicFilter)
+	}
+	return nil
+}
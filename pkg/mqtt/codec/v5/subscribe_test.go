@@ -0,0 +1,105 @@
+package v5
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+func TestNewSubscribePacket(t *testing.T) {
+	a := assert.New(t)
+	packet := NewControlPacket(mqttproto.SUBSCRIBE).(*SubscribePacket)
+	a.Equal(mqttproto.SUBSCRIBE, packet.MessageType)
+	a.Equal(mqttproto.MqttMessageTypeNames[packet.MessageType], packet.Name())
+	a.Equal(mqttproto.MQTT_5, packet.Version())
+	t.Log(packet)
+}
+
+func TestSubscribePacketCodec(t *testing.T) {
+	newPacket := func(msgLen int, messageID uint16, properties Properties, topicSubscriptions ...TopicSubscription) *SubscribePacket {
+		return &SubscribePacket{
+			FixedHeader: mqttproto.FixedHeader{
+				MessageType:     mqttproto.SUBSCRIBE,
+				Qos:             mqttproto.AT_LEAST_ONCE,
+				RemainingLength: msgLen,
+			},
+			MessageID:           messageID,
+			SubscribeProperties: properties,
+			TopicSubscriptions:  topicSubscriptions,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		encodedHex string
+		packet     *SubscribePacket
+	}{
+		{
+			name: "subscribe qos 1",
+			packet: newPacket(9, 1, Properties{}, TopicSubscription{
+				TopicFilter: "a/b",
+				Qos:         mqttproto.AT_LEAST_ONCE,
+			}),
+			encodedHex: "82090001000003612f6201",
+		},
+		{
+			name: "subscription options and identifier",
+			packet: newPacket(11, 1, Properties{SubscriptionIdentifier: []int{10}}, TopicSubscription{
+				TopicFilter:       "a/b",
+				Qos:               mqttproto.EXACTLY_ONCE,
+				NoLocal:           true,
+				RetainAsPublished: true,
+				RetainHandling:    2,
+			}),
+			encodedHex: "820b0001020b0a0003612f622e",
+		},
+		{
+			name: "multiple subscriptions",
+			packet: newPacket(15, 1, Properties{},
+				TopicSubscription{
+					TopicFilter: "a/b",
+					Qos:         mqttproto.AT_LEAST_ONCE,
+				},
+				TopicSubscription{
+					TopicFilter:    "c/d",
+					Qos:            mqttproto.AT_MOST_ONCE,
+					RetainHandling: 1,
+				}),
+			encodedHex: "820f0001000003612f62010003632f6410",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			t.Log(tc.packet)
+
+			// decode
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(encodedBytes)
+			decoded, err := ReadPacket(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet := decoded.(*SubscribePacket)
+			a.Equal(*tc.packet, *packet)
+			a.Equal(mqttproto.MQTT_5, packet.Version())
+
+			// encode
+			var output bytes.Buffer
+			err = packet.Write(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Equal(tc.packet.RemainingLength, packet.RemainingLength)
+			encodedBytes = output.Bytes()
+			a.Equal(tc.encodedHex, hex.EncodeToString(encodedBytes))
+		})
+	}
+}
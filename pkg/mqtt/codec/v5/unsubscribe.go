@@ -0,0 +1,73 @@
+package v5
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+type UnsubscribePacket struct {
+	mqttproto.FixedHeader
+	MessageID             uint16
+	UnsubscribeProperties Properties
+	TopicFilters          []string
+}
+
+func (p *UnsubscribePacket) Type() byte {
+	return p.MessageType
+}
+
+func (p *UnsubscribePacket) Version() byte {
+	return mqttproto.MQTT_5
+}
+
+func (p *UnsubscribePacket) Name() string {
+	return "UNSUBSCRIBE"
+}
+
+func (p *UnsubscribePacket) String() string {
+	return fmt.Sprintf("%v MessageID: %d %+v", p.FixedHeader, p.MessageID, p.TopicFilters)
+}
+
+func (p *UnsubscribePacket) Write(w io.Writer) (err error) {
+	var body bytes.Buffer
+
+	body.Write(mqttproto.EncodeUint16(p.MessageID))
+	body.Write(p.UnsubscribeProperties.Encode())
+	for _, topicFilter := range p.TopicFilters {
+		body.Write(mqttproto.EncodeString(topicFilter))
+	}
+	p.FixedHeader.RemainingLength = body.Len()
+	packet := p.FixedHeader.Pack()
+	packet.Write(body.Bytes())
+	_, err = packet.WriteTo(w)
+	return err
+}
+
+func (p *UnsubscribePacket) Unpack(r io.Reader) (err error) {
+	cr := &mqttproto.CountingReader{Reader: r}
+	p.MessageID, err = mqttproto.DecodeUint16(cr)
+	if err != nil {
+		return err
+	}
+	err = p.UnsubscribeProperties.Unpack(cr)
+	if err != nil {
+		return err
+	}
+	err = p.UnsubscribeProperties.Validate(mqttproto.UNSUBSCRIBE)
+	if err != nil {
+		return err
+	}
+	payloadLength := p.FixedHeader.RemainingLength - cr.BytesRead
+	for payloadLength > 0 {
+		topicFilter, err := mqttproto.DecodeString(r)
+		if err != nil {
+			return err
+		}
+		p.TopicFilters = append(p.TopicFilters, topicFilter)
+		payloadLength -= 2 + len(topicFilter)
+	}
+	return nil
+}
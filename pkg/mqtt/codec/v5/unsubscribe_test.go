@@ -0,0 +1,82 @@
+package v5
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+)
+
+func TestNewUnsubscribePacket(t *testing.T) {
+	a := assert.New(t)
+	packet := NewControlPacket(mqttproto.UNSUBSCRIBE).(*UnsubscribePacket)
+	a.Equal(mqttproto.UNSUBSCRIBE, packet.MessageType)
+	a.Equal(mqttproto.MqttMessageTypeNames[packet.MessageType], packet.Name())
+	a.Equal(mqttproto.MQTT_5, packet.Version())
+	t.Log(packet)
+}
+
+func TestUnsubscribePacketCodec(t *testing.T) {
+	newPacket := func(msgLen int, messageID uint16, properties Properties, topicFilters ...string) *UnsubscribePacket {
+		return &UnsubscribePacket{
+			FixedHeader: mqttproto.FixedHeader{
+				MessageType:     mqttproto.UNSUBSCRIBE,
+				Qos:             mqttproto.AT_LEAST_ONCE,
+				RemainingLength: msgLen,
+			},
+			MessageID:             messageID,
+			UnsubscribeProperties: properties,
+			TopicFilters:          topicFilters,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		encodedHex string
+		packet     *UnsubscribePacket
+	}{
+		{
+			name:       "unsubscribe",
+			packet:     newPacket(8, 1, Properties{}, "a/b"),
+			encodedHex: "a2080001000003612f62",
+		},
+		{
+			name:       "multiple topics, with user property",
+			packet:     newPacket(20, 1, Properties{UserProperties: []UserProperty{{Key: "k", Value: "v"}}}, "a/b", "c/d"),
+			encodedHex: "a2140001072600016b0001760003612f620003632f64",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			t.Log(tc.packet)
+
+			// decode
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(encodedBytes)
+			decoded, err := ReadPacket(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet := decoded.(*UnsubscribePacket)
+			a.Equal(*tc.packet, *packet)
+			a.Equal(mqttproto.MQTT_5, packet.Version())
+
+			// encode
+			var output bytes.Buffer
+			err = packet.Write(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Equal(tc.packet.RemainingLength, packet.RemainingLength)
+			encodedBytes = output.Bytes()
+			a.Equal(tc.encodedHex, hex.EncodeToString(encodedBytes))
+		})
+	}
+}
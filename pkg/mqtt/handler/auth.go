@@ -0,0 +1,163 @@
+package mqtthandler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+func (h *MQTTHandler) getEnhancedAuthenticator(method string) apis.EnhancedAuthenticator {
+	for _, a := range h.opts.enhancedAuthenticators {
+		if a.Method() == method {
+			return a
+		}
+	}
+	return nil
+}
+
+// handleEnhancedAuthConnect starts the MQTT 5 enhanced authentication (4.12) of a CONNECT with Authentication Method.
+func (h *MQTTHandler) handleEnhancedAuthConnect(conn mqttserver.Conn, req *mqtt5.ConnectPacket) {
+	method := *req.ConnectProperties.AuthenticationMethod
+	conn.Properties().SetAuthenticated(false)
+	conn.Properties().SetAuthMethod(method)
+
+	authenticator := h.getEnhancedAuthenticator(method)
+	if authenticator == nil {
+		h.logger.Warnf("Unsupported authentication method '%s' from /%v", method, conn.RemoteAddr())
+		h.completeEnhancedAuth(conn, nil, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.BadAuthenticationMethod}, false)
+		return
+	}
+	session, resp, err := authenticator.Start(context.Background(), &apis.EnhancedAuthRequest{
+		ClientIdentifier: req.ClientIdentifier,
+		Username:         req.Username,
+		AuthMethod:       method,
+		AuthData:         req.ConnectProperties.AuthenticationData,
+	})
+	if err != nil {
+		h.logger.WithError(err).Warnf("Authentication from /%v failed", conn.RemoteAddr())
+		_ = conn.Close()
+		return
+	}
+	h.completeEnhancedAuth(conn, session, resp, false)
+}
+
+func (h *MQTTHandler) handleAuth(conn mqttserver.Conn, packet mqttproto.ControlPacket) {
+	req, ok := packet.(*mqtt5.AuthPacket)
+	if !ok {
+		h.logger.Warnf("Unsupported auth packet type %v", reflect.TypeOf(packet))
+		_ = conn.Close()
+		return
+	}
+	h.logger.Debugf("Handling MQTT message '%s' from /%v", packet.Name(), conn.RemoteAddr())
+
+	properties := conn.Properties()
+	reAuth := properties.Authenticated()
+	var method string
+	if req.AuthProperties.AuthenticationMethod != nil {
+		method = *req.AuthProperties.AuthenticationMethod
+	}
+	if method == "" || method != properties.AuthMethod() {
+		h.logger.Warnf("'AUTH' with authentication method '%s' from /%v, expected '%s'", method, conn.RemoteAddr(), properties.AuthMethod())
+		h.completeEnhancedAuth(conn, nil, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.ProtocolError}, reAuth)
+		return
+	}
+	authRequest := &apis.EnhancedAuthRequest{
+		ClientIdentifier: properties.ClientIdentifier(),
+		AuthMethod:       method,
+		AuthData:         req.AuthProperties.AuthenticationData,
+		ReAuth:           reAuth,
+	}
+	session, resp, err := h.nextEnhancedAuthStep(properties, req.ReasonCode, authRequest)
+	if err != nil {
+		h.logger.WithError(err).Warnf("Authentication from /%v failed", conn.RemoteAddr())
+		h.completeEnhancedAuth(conn, nil, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.ProtocolError}, reAuth)
+		return
+	}
+	h.completeEnhancedAuth(conn, session, resp, reAuth)
+}
+
+func (h *MQTTHandler) nextEnhancedAuthStep(properties mqttserver.Properties, reasonCode byte, req *apis.EnhancedAuthRequest) (apis.EnhancedAuthSession, *apis.EnhancedAuthResponse, error) {
+	switch reasonCode {
+	case mqtt5.ContinueAuthentication:
+		session, ok := properties.AuthSession().(apis.EnhancedAuthSession)
+		if !ok {
+			return nil, nil, fmt.Errorf("no authentication in progress")
+		}
+		resp, err := session.Continue(context.Background(), req)
+		return session, resp, err
+	case mqtt5.ReAuthenticate:
+		if !req.ReAuth || properties.AuthSession() != nil {
+			return nil, nil, fmt.Errorf("re-authentication is not allowed")
+		}
+		authenticator := h.getEnhancedAuthenticator(req.AuthMethod)
+		if authenticator == nil {
+			return nil, nil, fmt.Errorf("unsupported authentication method '%s'", req.AuthMethod)
+		}
+		return authenticator.Start(context.Background(), req)
+	default:
+		return nil, nil, fmt.Errorf("unexpected auth reason code 0x%x", reasonCode)
+	}
+}
+
+// completeEnhancedAuth sends the result of an authentication step.
+// During CONNECT the final result is the CONNACK, during re-authentication an AUTH or a DISCONNECT.
+func (h *MQTTHandler) completeEnhancedAuth(conn mqttserver.Conn, session apis.EnhancedAuthSession, resp *apis.EnhancedAuthResponse, reAuth bool) {
+	properties := conn.Properties()
+	if resp.ReasonCode == mqtt5.Success && !reAuth && !conn.ClaimClientID(properties.ClientIdentifier()) {
+		h.logger.Infof("Reject client identifier '%s' in use from /%v", properties.ClientIdentifier(), conn.RemoteAddr())
+		resp = &apis.EnhancedAuthResponse{ReasonCode: mqtt5.ClientIdentifierNotValid, ReasonString: "client identifier in use"}
+	}
+	responseProperties := mqtt5.Properties{
+		ReasonString: mqtt5.StringProperty(resp.ReasonString),
+	}
+	if resp.ReasonCode < mqtt5.UnspecifiedError {
+		responseProperties.AuthenticationMethod = mqtt5.StringProperty(properties.AuthMethod())
+		responseProperties.AuthenticationData = resp.AuthData
+	}
+
+	switch resp.ReasonCode {
+	case mqtt5.ContinueAuthentication:
+		properties.SetAuthSession(session)
+		res := mqtt5.NewControlPacket(mqttproto.AUTH).(*mqtt5.AuthPacket)
+		res.ReasonCode = mqtt5.ContinueAuthentication
+		res.AuthProperties = responseProperties
+		h.writeResponse(conn, res)
+	case mqtt5.Success:
+		properties.SetAuthSession(nil)
+		properties.SetAuthenticated(true)
+		if reAuth {
+			res := mqtt5.NewControlPacket(mqttproto.AUTH).(*mqtt5.AuthPacket)
+			res.ReasonCode = mqtt5.Success
+			res.AuthProperties = responseProperties
+			h.writeResponse(conn, res)
+		} else {
+			res := mqtt5.NewControlPacket(mqttproto.CONNACK).(*mqtt5.ConnackPacket)
+			res.ReturnCode = mqtt5.Success
+			res.ConnackProperties = responseProperties
+			h.setConnackProperties(conn, &res.ConnackProperties)
+			h.writeResponse(conn, res)
+			h.cancelWill(properties.ClientIdentifier())
+		}
+	default:
+		properties.SetAuthSession(nil)
+		properties.SetAuthenticated(false)
+		if reAuth {
+			res := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+			res.ReasonCode = resp.ReasonCode
+			res.DisconnectProperties = responseProperties
+			h.writeResponse(conn, res)
+		} else {
+			res := mqtt5.NewControlPacket(mqttproto.CONNACK).(*mqtt5.ConnackPacket)
+			res.ReturnCode = resp.ReasonCode
+			res.ConnackProperties = responseProperties
+			h.writeResponse(conn, res)
+		}
+		h.logger.Infof("Disconnect unauthenticated client '%s' from /%v", properties.ClientIdentifier(), conn.RemoteAddr())
+		_ = conn.Close()
+	}
+}
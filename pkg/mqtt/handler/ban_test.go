@@ -0,0 +1,42 @@
+package mqtthandler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func TestBannedConnect(t *testing.T) {
+	list, err := ban.Open("")
+	require.NoError(t, err)
+	require.NoError(t, list.Add(ban.Entry{Kind: ban.KindClientID, Value: "banned"}))
+	addr := newTestServer(t, WithBanList(list))
+
+	t.Run("v5 banned", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("banned", mqtt5.Properties{}))
+		assert.Equal(t, mqtt5.Banned, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ReturnCode)
+		_, err := mqtt5.ReadPacket(conn)
+		assert.Error(t, err)
+	})
+	t.Run("v311 banned", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+		connect.ProtocolName = mqttproto.MQTT
+		connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+		connect.ClientIdentifier = "banned"
+		writePacket(t, conn, connect)
+		assert.Equal(t, mqttproto.RefusedNotAuthorized, readV311Packet(t, conn).(*mqtt311.ConnackPacket).ReturnCode)
+	})
+	t.Run("v5 not banned", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("allowed", mqtt5.Properties{}))
+		assert.Equal(t, mqttproto.Accepted, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ReturnCode)
+	})
+}
@@ -0,0 +1,87 @@
+package mqtthandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+func newV311Connect(clientIdentifier string) *mqtt311.ConnectPacket {
+	packet := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+	packet.ProtocolName = mqttproto.MQTT
+	packet.ProtocolLevel = mqttproto.MQTT_3_1_1
+	packet.ClientIdentifier = clientIdentifier
+	return packet
+}
+
+func TestClientIDTakeover(t *testing.T) {
+	a := assert.New(t)
+	srv := &mqttserver.Server{}
+	addr := serveTestServer(t, srv)
+
+	first := dialTestServer(t, addr)
+	writePacket(t, first, newV5Connect("c1", mqtt5.Properties{}))
+	a.Equal(mqtt5.Success, readV5Packet(t, first).(*mqtt5.ConnackPacket).ReturnCode)
+
+	second := dialTestServer(t, addr)
+	writePacket(t, second, newV5Connect("c1", mqtt5.Properties{}))
+	a.Equal(mqtt5.Success, readV5Packet(t, second).(*mqtt5.ConnackPacket).ReturnCode)
+	a.Equal(mqtt5.SessionTakenOver, readV5Packet(t, first).(*mqtt5.DisconnectPacket).ReasonCode)
+	_, err := mqtt5.ReadPacket(first)
+	a.Error(err)
+
+	// MQTT 3.1.1 clients are disconnected without DISCONNECT
+	third := dialTestServer(t, addr)
+	writePacket(t, third, newV311Connect("c1"))
+	a.Equal(mqttproto.Accepted, readV311Packet(t, third).(*mqtt311.ConnackPacket).ReturnCode)
+	a.Equal(mqtt5.SessionTakenOver, readV5Packet(t, second).(*mqtt5.DisconnectPacket).ReasonCode)
+
+	fourth := dialTestServer(t, addr)
+	writePacket(t, fourth, newV311Connect("c1"))
+	a.Equal(mqttproto.Accepted, readV311Packet(t, fourth).(*mqtt311.ConnackPacket).ReturnCode)
+	_, err = mqtt311.ReadPacket(third)
+	a.Error(err)
+
+	a.Equal(int64(3), srv.NumClientIDConflicts())
+}
+
+func TestClientIDRejectNew(t *testing.T) {
+	a := assert.New(t)
+	srv := &mqttserver.Server{ClientIDPolicy: mqttserver.ClientIDPolicyRejectNew}
+	addr := serveTestServer(t, srv)
+
+	first := dialTestServer(t, addr)
+	writePacket(t, first, newV5Connect("c1", mqtt5.Properties{}))
+	a.Equal(mqtt5.Success, readV5Packet(t, first).(*mqtt5.ConnackPacket).ReturnCode)
+
+	second := dialTestServer(t, addr)
+	writePacket(t, second, newV5Connect("c1", mqtt5.Properties{}))
+	a.Equal(mqtt5.ClientIdentifierNotValid, readV5Packet(t, second).(*mqtt5.ConnackPacket).ReturnCode)
+
+	third := dialTestServer(t, addr)
+	writePacket(t, third, newV311Connect("c1"))
+	a.Equal(mqttproto.RefusedIdentifierRejected, readV311Packet(t, third).(*mqtt311.ConnackPacket).ReturnCode)
+	a.Equal(int64(2), srv.NumClientIDConflicts())
+
+	// empty client identifiers are not registered
+	for i := 0; i < 2; i++ {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV311Connect(""))
+		a.Equal(mqttproto.Accepted, readV311Packet(t, conn).(*mqtt311.ConnackPacket).ReturnCode)
+	}
+
+	// the client identifier is released when the connection is closed
+	writePacket(t, first, mqtt5.NewControlPacket(mqttproto.DISCONNECT))
+	require.Eventually(t, func() bool {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		return readV5Packet(t, conn).(*mqtt5.ConnackPacket).ReturnCode == mqtt5.Success
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,81 @@
+package mqtthandler
+
+import (
+	"errors"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// policies applied when a QoS 1 or QoS 2 message cannot be published
+const (
+	PublishFailurePolicyDrop       = "drop"       // no acknowledgement is sent, the client waits for PUBACK/PUBREC until its timeout
+	PublishFailurePolicyNack       = "nack"       // MQTT 5 clients receive PUBACK/PUBREC with a failure reason code, MQTT 3.1.1 clients are disconnected
+	PublishFailurePolicyDisconnect = "disconnect" // close the connection, MQTT 5 clients receive DISCONNECT with a failure reason code
+)
+
+// publishFailureReasonCode maps the publish error to the MQTT 5 reason code valid in PUBACK, PUBREC and DISCONNECT.
+func publishFailureReasonCode(err error) byte {
+	switch {
+	case errors.Is(err, apis.ErrNoRoute):
+		return mqtt5.TopicNameInvalid
+	case errors.Is(err, apis.ErrQuotaExceeded):
+		return mqtt5.QuotaExceeded
+	case errors.Is(err, apis.ErrMessageRejected):
+		return mqtt5.ImplementationSpecificError
+	default:
+		return mqtt5.UnspecifiedError
+	}
+}
+
+// publishFailed applies the failure policy to the QoS 1 or QoS 2 message, which was not published.
+// The requests refused by the publisher close the connection unless the policy is nack.
+func (h *MQTTHandler) publishFailed(conn mqttserver.Conn, packet mqttproto.ControlPacket, publishRequest *apis.PublishRequest, err error, refused bool) {
+	_, isV5 := packet.(*mqtt5.PublishPacket)
+
+	action := h.opts.publishFailurePolicy
+	if action == "" {
+		action = PublishFailurePolicyDrop
+	}
+	switch {
+	case action == PublishFailurePolicyDrop && refused:
+		action = PublishFailurePolicyDisconnect
+	case action == PublishFailurePolicyNack && !isV5:
+		// MQTT 3.1.1 has no negative acknowledgement, the client retries the unacknowledged message after reconnecting
+		action = PublishFailurePolicyDisconnect
+	}
+	h.metrics.publishFailuresTotal.WithLabelValues(action).Inc()
+
+	reasonCode := publishFailureReasonCode(err)
+	switch action {
+	case PublishFailurePolicyDrop:
+		h.logger.WithError(err).Warnf("Publish of message %d from /%v failed, no acknowledgement is sent", publishRequest.MessageID, conn.RemoteAddr())
+	case PublishFailurePolicyNack:
+		h.logger.WithError(err).Warnf("Publish of message %d from /%v failed, sending reason code 0x%02X", publishRequest.MessageID, conn.RemoteAddr(), reasonCode)
+		h.writeResponse(conn, getPublishNack(publishRequest, reasonCode))
+	default:
+		if isV5 {
+			disconnect := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+			disconnect.ReasonCode = reasonCode
+			h.writeResponse(conn, disconnect)
+		}
+		h.logger.WithError(err).Errorf("Publish of message %d from /%v failed, closing the connection ...", publishRequest.MessageID, conn.RemoteAddr())
+		_ = conn.Close()
+	}
+}
+
+// getPublishNack returns the MQTT 5 PUBACK or PUBREC with the failure reason code.
+func getPublishNack(publishRequest *apis.PublishRequest, reasonCode byte) mqttproto.ControlPacket {
+	if publishRequest.Qos == mqttproto.AT_LEAST_ONCE {
+		puback := mqtt5.NewControlPacket(mqttproto.PUBACK).(*mqtt5.PubackPacket)
+		puback.MessageID = publishRequest.MessageID
+		puback.ReasonCode = reasonCode
+		return puback
+	}
+	pubrec := mqtt5.NewControlPacket(mqttproto.PUBREC).(*mqtt5.PubrecPacket)
+	pubrec.MessageID = publishRequest.MessageID
+	pubrec.ReasonCode = reasonCode
+	return pubrec
+}
@@ -0,0 +1,123 @@
+package mqtthandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+// failingPublisher does not deliver the messages, refused requests are not accepted by the publisher at all
+type failingPublisher struct {
+	*noop.Publisher
+	err     error
+	refused bool
+}
+
+func (p *failingPublisher) Publish(_ context.Context, _ *apis.PublishRequest) (*apis.PublishResponse, error) {
+	if p.refused {
+		return nil, p.err
+	}
+	return &apis.PublishResponse{Error: p.err}, nil
+}
+
+func TestPublishFailureReasonCode(t *testing.T) {
+	tests := []struct {
+		err        error
+		reasonCode byte
+	}{
+		{err: fmt.Errorf("kafka topic not found for MQTT topic t: %w", apis.ErrNoRoute), reasonCode: mqtt5.TopicNameInvalid},
+		{err: fmt.Errorf("%w: queue full", apis.ErrQuotaExceeded), reasonCode: mqtt5.QuotaExceeded},
+		{err: fmt.Errorf("%w: too large", apis.ErrMessageRejected), reasonCode: mqtt5.ImplementationSpecificError},
+		{err: errors.New("broker down"), reasonCode: mqtt5.UnspecifiedError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tc.reasonCode, publishFailureReasonCode(tc.err))
+		})
+	}
+}
+
+func TestPublishFailurePolicy(t *testing.T) {
+	noRoute := fmt.Errorf("kafka topic not found for MQTT topic t: %w", apis.ErrNoRoute)
+	tests := []struct {
+		name       string
+		policy     string
+		version    byte
+		qos        byte
+		refused    bool
+		response   mqttproto.ControlPacket // expected response, nil if the connection is kept without response
+		reasonCode byte
+		closed     bool
+	}{
+		{name: "default drops", version: mqttproto.MQTT_5, qos: mqttproto.AT_LEAST_ONCE},
+		{name: "drop", policy: PublishFailurePolicyDrop, version: mqttproto.MQTT_5, qos: mqttproto.EXACTLY_ONCE},
+		{name: "drop refused", policy: PublishFailurePolicyDrop, version: mqttproto.MQTT_5, qos: mqttproto.AT_LEAST_ONCE, refused: true,
+			response: &mqtt5.DisconnectPacket{}, reasonCode: mqtt5.TopicNameInvalid, closed: true},
+		{name: "drop refused v311", policy: PublishFailurePolicyDrop, version: mqttproto.MQTT_3_1_1, qos: mqttproto.AT_LEAST_ONCE, refused: true, closed: true},
+		{name: "nack puback", policy: PublishFailurePolicyNack, version: mqttproto.MQTT_5, qos: mqttproto.AT_LEAST_ONCE,
+			response: &mqtt5.PubackPacket{}, reasonCode: mqtt5.TopicNameInvalid},
+		{name: "nack pubrec", policy: PublishFailurePolicyNack, version: mqttproto.MQTT_5, qos: mqttproto.EXACTLY_ONCE,
+			response: &mqtt5.PubrecPacket{}, reasonCode: mqtt5.TopicNameInvalid},
+		{name: "nack refused", policy: PublishFailurePolicyNack, version: mqttproto.MQTT_5, qos: mqttproto.AT_LEAST_ONCE, refused: true,
+			response: &mqtt5.PubackPacket{}, reasonCode: mqtt5.TopicNameInvalid},
+		{name: "nack v311 disconnects", policy: PublishFailurePolicyNack, version: mqttproto.MQTT_3_1_1, qos: mqttproto.AT_LEAST_ONCE, closed: true},
+		{name: "disconnect", policy: PublishFailurePolicyDisconnect, version: mqttproto.MQTT_5, qos: mqttproto.EXACTLY_ONCE,
+			response: &mqtt5.DisconnectPacket{}, reasonCode: mqtt5.TopicNameInvalid, closed: true},
+		{name: "disconnect v311", policy: PublishFailurePolicyDisconnect, version: mqttproto.MQTT_3_1_1, qos: mqttproto.AT_LEAST_ONCE, closed: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			publisher := &failingPublisher{Publisher: noop.New(log.NewDefaultLogger(), nil), err: noRoute, refused: tc.refused}
+			conn := dialTestServer(t, newPublisherTestServer(t, publisher, WithPublishFailurePolicy(tc.policy)))
+
+			readPacket := readV5Packet
+			if tc.version == mqttproto.MQTT_5 {
+				writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+			} else {
+				writePacket(t, conn, newV311Connect("c1"))
+				readPacket = readV311Packet
+			}
+			readPacket(t, conn)
+			writePacket(t, conn, newTestPublish(tc.version, tc.qos, 1))
+
+			if tc.response != nil {
+				res := readPacket(t, conn)
+				require.IsType(t, tc.response, res)
+				switch res := res.(type) {
+				case *mqtt5.PubackPacket:
+					a.Equal(uint16(1), res.MessageID)
+					a.Equal(tc.reasonCode, res.ReasonCode)
+				case *mqtt5.PubrecPacket:
+					a.Equal(uint16(1), res.MessageID)
+					a.Equal(tc.reasonCode, res.ReasonCode)
+				case *mqtt5.DisconnectPacket:
+					a.Equal(tc.reasonCode, res.ReasonCode)
+				}
+			}
+			if tc.closed {
+				_, err := mqtt5.ReadPacket(conn)
+				a.Error(err)
+				return
+			}
+			// the connection is kept
+			if tc.version == mqttproto.MQTT_5 {
+				writePacket(t, conn, mqtt5.NewControlPacket(mqttproto.PINGREQ))
+			} else {
+				writePacket(t, conn, mqtt311.NewControlPacket(mqttproto.PINGREQ))
+			}
+			a.Equal(mqttproto.PINGRESP, readPacket(t, conn).Type())
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package mqtthandler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+// pendingPublisher keeps the async publishes until the test completes them
+type pendingPublisher struct {
+	*noop.Publisher
+	completions chan func()
+}
+
+func (p *pendingPublisher) PublishAsync(_ context.Context, request *apis.PublishRequest, callback apis.PublishCallbackFunc) error {
+	p.completions <- func() {
+		callback(request, &apis.PublishResponse{})
+	}
+	return nil
+}
+
+func (p *pendingPublisher) next(timeout time.Duration) func() {
+	select {
+	case complete := <-p.completions:
+		return complete
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestReceiveMaximum(t *testing.T) {
+	conn := dialTestServer(t, serveTestServer(t, &mqttserver.Server{ReceiveMaximum: 20}))
+	writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+	connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+	require.NotNil(t, connack.ConnackProperties.ReceiveMaximum)
+	assert.Equal(t, uint16(20), *connack.ConnackProperties.ReceiveMaximum)
+
+	conn = dialTestServer(t, newTestServer(t))
+	writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+	assert.Nil(t, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ConnackProperties.ReceiveMaximum)
+}
+
+func TestReceiveMaximumAsyncPublish(t *testing.T) {
+	a := assert.New(t)
+	logger := log.NewDefaultLogger()
+	publisher := &pendingPublisher{Publisher: noop.New(logger, nil), completions: make(chan func(), 10)}
+	srv := &mqttserver.Server{
+		Handler:        New(logger, prometheus.NewRegistry(), publisher, WithPublishAsyncAtMostOnce(true), WithPublishAsyncAtLeastOnce(true)),
+		ErrorLog:       logger,
+		ReceiveMaximum: 2,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	// the receive maximum applies to MQTT 3.1.1 clients as well
+	conn := dialTestServer(t, l.Addr())
+	writePacket(t, conn, newV311Connect("c1"))
+	readV311Packet(t, conn)
+
+	// QoS 0 publishes are not counted
+	writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.AT_MOST_ONCE, 0))
+	for id := uint16(1); id <= 3; id++ {
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.AT_LEAST_ONCE, id))
+	}
+	completions := make([]func(), 0, 3)
+	for i := 0; i < 3; i++ {
+		complete := publisher.next(time.Second)
+		require.NotNil(t, complete)
+		completions = append(completions, complete)
+	}
+	// the third QoS 1 publish is not read while two are inflight
+	a.Nil(publisher.next(100 * time.Millisecond))
+
+	completions[1]()
+	a.Equal(uint16(1), readV311Packet(t, conn).(*mqtt311.PubackPacket).MessageID)
+	complete := publisher.next(time.Second)
+	require.NotNil(t, complete)
+
+	completions[0]()
+	completions[2]()
+	complete()
+	for id := uint16(2); id <= 3; id++ {
+		a.Equal(id, readV311Packet(t, conn).(*mqtt311.PubackPacket).MessageID)
+	}
+}
@@ -3,7 +3,9 @@ package mqtthandler
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,13 +24,20 @@ type MQTTHandler struct {
 	logger    log.Logger
 	metrics   *mqttMetrics
 	publisher apis.Publisher
+	limiter   *publishLimiter // or nil when the publish rate is not limited
+	wills     pendingWills    // delayed will messages
 
 	opts options
 }
 
 type mqttMetrics struct {
-	requestsTotal  *prometheus.CounterVec
-	responsesTotal *prometheus.CounterVec
+	requestsTotal         *prometheus.CounterVec
+	responsesTotal        *prometheus.CounterVec
+	publishRateLimitTotal *prometheus.CounterVec
+
+	publishDuplicatesTotal prometheus.Counter
+	publishFailuresTotal   *prometheus.CounterVec
+	willMessagesTotal      *prometheus.CounterVec
 }
 
 func (h *MQTTHandler) ServeMQTT(c mqttserver.Conn, p mqttproto.ControlPacket) {
@@ -63,20 +72,46 @@ func (h *MQTTHandler) handleConnect(conn mqttserver.Conn, packet mqttproto.Contr
 	}
 	h.logger.Infof("Handling MQTT message '%s' from /%v", packet.Name(), conn.RemoteAddr())
 
-	returnCode, err := h.loginUser(username, password)
+	_, isV5 := packet.(*mqtt5.ConnectPacket)
+	if keepAlive := h.keepAlive(keepAliveSeconds, isV5); keepAlive > 0 {
+		if keepAlive != keepAliveSeconds {
+			conn.Properties().SetServerKeepAlive(keepAlive)
+		}
+		conn.Properties().SetIdleTimeout(time.Duration(keepAlive) * 1500 * time.Millisecond)
+	}
+	conn.Properties().SetClientIdentifier(clientIdentifier)
+	conn.Properties().SetUsername(username)
+	if w := getWill(packet); w != nil {
+		conn.Properties().SetWill(w)
+	}
+
+	if h.opts.banList != nil && h.rejectBanned(conn, packet, clientIdentifier, username) {
+		return
+	}
+
+	if req, ok := packet.(*mqtt5.ConnectPacket); ok && req.ConnectProperties.AuthenticationMethod != nil {
+		h.handleEnhancedAuthConnect(conn, req)
+		return
+	}
+
+	returnCode, err := h.loginUser(conn, username, password)
 	if err != nil {
 		h.logger.WithError(err).Warnf("Login failed from /%v failed", conn.RemoteAddr())
 		_ = conn.Close()
 		return
 	}
-	if keepAliveSeconds > 0 {
-		conn.Properties().SetIdleTimeout(time.Duration(float64(keepAliveSeconds)*1.5) * time.Second)
+	if returnCode == mqttproto.Accepted && packet.Version() == mqttproto.MQTT_3_1 && clientIdentifier == "" {
+		// MQTT 3.1 requires a client identifier of at least one character
+		returnCode = mqttproto.RefusedIdentifierRejected
+	}
+	if returnCode == mqttproto.Accepted && !conn.ClaimClientID(clientIdentifier) {
+		h.logger.Infof("Reject client identifier '%s' in use from /%v", clientIdentifier, conn.RemoteAddr())
+		returnCode = mqttproto.RefusedIdentifierRejected
 	}
 	authenticated := returnCode == mqttproto.Accepted
 	conn.Properties().SetAuthenticated(authenticated)
-	conn.Properties().SetClientIdentifier(clientIdentifier)
 
-	res, err := h.getConnectAck(packet, returnCode)
+	res, err := h.getConnectAck(conn, packet, returnCode)
 	if err != nil {
 		h.logger.Error(err.Error())
 		_ = conn.Close()
@@ -93,6 +128,35 @@ func (h *MQTTHandler) handleConnect(conn mqttserver.Conn, packet mqttproto.Contr
 		_ = conn.Close()
 		return
 	}
+	h.cancelWill(clientIdentifier)
+}
+
+// rejectBanned answers CONNACK "Banned" to a banned client and reports whether the client was rejected.
+// MQTT 3.1.1 clients receive "Not authorized".
+func (h *MQTTHandler) rejectBanned(conn mqttserver.Conn, packet mqttproto.ControlPacket, clientIdentifier string, username string) bool {
+	var ip net.IP
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP
+	}
+	entry, banned := h.opts.banList.Banned(clientIdentifier, username, ip)
+	if !banned {
+		return false
+	}
+	h.logger.Infof("Reject banned %s '%s' from /%v", entry.Kind, entry.Value, conn.RemoteAddr())
+
+	var res mqttproto.ControlPacket
+	if _, ok := packet.(*mqtt5.ConnectPacket); ok {
+		connack := mqtt5.NewControlPacket(mqttproto.CONNACK).(*mqtt5.ConnackPacket)
+		connack.ReturnCode = mqtt5.Banned
+		res = connack
+	} else {
+		connack := mqtt311.NewControlPacket(mqttproto.CONNACK).(*mqtt311.ConnackPacket)
+		connack.ReturnCode = mqttproto.RefusedNotAuthorized
+		res = connack
+	}
+	h.writeResponse(conn, res)
+	_ = conn.Close()
+	return true
 }
 
 func (h *MQTTHandler) getConnectData(packet mqttproto.ControlPacket) (username string, password string, clientIdentifier string, keepAliveSeconds uint16, err error) {
@@ -106,7 +170,7 @@ func (h *MQTTHandler) getConnectData(packet mqttproto.ControlPacket) (username s
 	}
 }
 
-func (h *MQTTHandler) getConnectAck(packet mqttproto.ControlPacket, returnCode byte) (mqttproto.ControlPacket, error) {
+func (h *MQTTHandler) getConnectAck(conn mqttserver.Conn, packet mqttproto.ControlPacket, returnCode byte) (mqttproto.ControlPacket, error) {
 	switch packet.(type) {
 	case *mqtt311.ConnectPacket:
 		res := mqtt311.NewControlPacket(mqttproto.CONNACK).(*mqtt311.ConnackPacket)
@@ -116,8 +180,12 @@ func (h *MQTTHandler) getConnectAck(packet mqttproto.ControlPacket, returnCode b
 		res := mqtt5.NewControlPacket(mqttproto.CONNACK).(*mqtt5.ConnackPacket)
 		res.ReturnCode = returnCode
 		switch returnCode {
+		case mqttproto.Accepted:
+			h.setConnackProperties(conn, &res.ConnackProperties)
 		case mqttproto.RefusedBadUserNameOrPassword:
 			res.ReturnCode = mqttproto.RefusedV5BadUserNameOrPassword
+		case mqttproto.RefusedIdentifierRejected:
+			res.ReturnCode = mqtt5.ClientIdentifierNotValid
 		}
 		return res, nil
 	default:
@@ -125,9 +193,50 @@ func (h *MQTTHandler) getConnectAck(packet mqttproto.ControlPacket, returnCode b
 	}
 }
 
-func (h *MQTTHandler) loginUser(username, password string) (byte, error) {
-	if h.opts.authenticator != nil {
-		authResp, err := h.opts.authenticator.Login(context.Background(), &apis.UserPasswordAuthRequest{
+// setConnackProperties sets the server limits announced to a MQTT 5 client in a successful CONNACK.
+func (h *MQTTHandler) setConnackProperties(conn mqttserver.Conn, properties *mqtt5.Properties) {
+	if maxPacketSize := conn.Properties().MaxPacketSize(); maxPacketSize > 0 {
+		properties.MaximumPacketSize = &maxPacketSize
+	}
+	if serverKeepAlive := conn.Properties().ServerKeepAlive(); serverKeepAlive > 0 {
+		properties.ServerKeepAlive = &serverKeepAlive
+	}
+	if topicAliasMaximum := h.opts.topicAliasMaximum; topicAliasMaximum > 0 {
+		properties.TopicAliasMaximum = &topicAliasMaximum
+	}
+	if receiveMaximum := conn.Properties().ReceiveMaximum(); receiveMaximum > 0 {
+		properties.ReceiveMaximum = &receiveMaximum
+	}
+}
+
+// keepAlive applies the keep alive policy to the keep alive requested by the client, 0 means no keep alive.
+// The maximum is not applied to a non-zero keep alive of MQTT 3.1.1 clients, as they cannot be informed
+// about the Server Keep Alive and would be disconnected before their next PINGREQ.
+func (h *MQTTHandler) keepAlive(requested uint16, serverKeepAlive bool) uint16 {
+	keepAlive := requested
+	if keepAlive == 0 {
+		keepAlive = h.opts.keepAliveDefault
+	}
+	if keepAlive < h.opts.keepAliveMin {
+		keepAlive = h.opts.keepAliveMin
+	}
+	if h.opts.keepAliveMax > 0 && (keepAlive == 0 || keepAlive > h.opts.keepAliveMax) && (serverKeepAlive || requested == 0) {
+		keepAlive = h.opts.keepAliveMax
+	}
+	return keepAlive
+}
+
+// getAuthenticator returns the authenticator of the listener which accepted the connection or the default one.
+func (h *MQTTHandler) getAuthenticator(conn mqttserver.Conn) apis.UserPasswordAuthenticator {
+	if authenticator, ok := h.opts.listenerAuthenticators[mqttserver.ListenerName(conn.Context())]; ok {
+		return authenticator
+	}
+	return h.opts.authenticator
+}
+
+func (h *MQTTHandler) loginUser(conn mqttserver.Conn, username, password string) (byte, error) {
+	if authenticator := h.getAuthenticator(conn); authenticator != nil {
+		authResp, err := authenticator.Login(context.Background(), &apis.UserPasswordAuthRequest{
 			Username: username,
 			Password: password,
 		})
@@ -140,17 +249,46 @@ func (h *MQTTHandler) loginUser(username, password string) (byte, error) {
 }
 
 func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.ControlPacket) {
+	// the message is released when the publisher is done with the request
+	release := releaseOnce(packet)
+
 	publishRequest, err := h.getPublishRequest(conn, packet)
 	if err != nil {
+		release()
 		h.logger.Error(err.Error())
 		_ = conn.Close()
 		return
 	}
 	if h.disconnectUnauthenticated(conn, packet.Name()) {
+		release()
 		return
 	}
 	h.logger.Debugf("Handling MQTT message '%s' from /%v", packet.Name(), conn.RemoteAddr())
 
+	if !h.resolveTopicAlias(conn, packet, publishRequest) {
+		release()
+		return
+	}
+	if publishRequest.Qos == mqttproto.EXACTLY_ONCE && h.isDuplicatePublish(conn, packet, publishRequest) {
+		release()
+		return
+	}
+	if h.limiter != nil && !h.limitPublish(conn, packet, publishRequest) {
+		if publishRequest.Qos == mqttproto.EXACTLY_ONCE {
+			conn.Properties().ReleasePacketID(publishRequest.MessageID)
+		}
+		release()
+		return
+	}
+	// the connection is drained on shutdown after the inflight publishes are done
+	conn.Properties().AddInflight(1)
+	release = releaseInflight(conn, release)
+	if publishRequest.Qos != mqttproto.AT_MOST_ONCE {
+		// the connection is not read while the receive maximum of QoS 1 and 2 publishes is inflight
+		conn.Properties().AddReceiving(1)
+		release = releaseReceiving(conn, release)
+	}
+
 	var publishCallback apis.PublishCallbackFunc
 
 	switch publishRequest.Qos {
@@ -161,7 +299,7 @@ func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.Contr
 	case mqttproto.AT_LEAST_ONCE:
 		publishCallback = func(request *apis.PublishRequest, response *apis.PublishResponse) {
 			if response.Error != nil {
-				//TODO: property if close connection unable to deliver ?
+				h.publishFailed(conn, packet, request, response.Error, false)
 				return
 			}
 			res, err := h.getPublishAck(packet, request.MessageID)
@@ -180,7 +318,9 @@ func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.Contr
 	case mqttproto.EXACTLY_ONCE:
 		publishCallback = func(request *apis.PublishRequest, response *apis.PublishResponse) {
 			if response.Error != nil {
-				//TODO: property if close connection unable to deliver ?
+				// the retransmission of the message is published again
+				conn.Properties().ReleasePacketID(request.MessageID)
+				h.publishFailed(conn, packet, request, response.Error, false)
 				return
 			}
 			res, err := h.getPublishRec(packet, request.MessageID)
@@ -189,6 +329,8 @@ func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.Contr
 				_ = conn.Close()
 				return
 			}
+			// the PUBREL can arrive as soon as the PUBREC is sent
+			conn.Properties().MarkPacketIDReceived(request.MessageID)
 			err = res.Write(conn)
 			if err != nil {
 				h.logger.WithError(err).Errorf("Write 'PUBREC' failed")
@@ -197,9 +339,11 @@ func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.Contr
 			}
 		}
 	default:
+		release()
 		h.logger.Warnf("'PUBLISH' with invalid QoS '%d'. Ignoring", publishRequest.Qos)
 		return
 	}
+	publishCallback = releaseAfter(publishCallback, release)
 
 	ctx := context.Background()
 	if h.opts.publishTimeout > 0 {
@@ -209,12 +353,120 @@ func (h *MQTTHandler) handlePublish(conn mqttserver.Conn, packet mqttproto.Contr
 	}
 	err = h.doPublish(ctx, h.publisher, publishRequest, publishCallback)
 	if err != nil {
+		release()
+		if publishRequest.Qos == mqttproto.EXACTLY_ONCE {
+			conn.Properties().ReleasePacketID(publishRequest.MessageID)
+		}
 		if publishRequest.Qos == mqttproto.AT_MOST_ONCE {
 			h.logger.WithError(err).Warnf("Write 'PUBLISH' failed, ignoring ...")
 		} else {
-			h.logger.WithError(err).Errorf("Write 'PUBLISH' failed, closing the connection ...")
+			h.publishFailed(conn, packet, publishRequest, err, true)
+		}
+	}
+}
+
+// isDuplicatePublish stores the packet identifier of the QoS 2 message and reports whether the message
+// was already received. The message is published once, a retransmission awaiting PUBREL is answered with
+// PUBREC again, a retransmission being published is answered when the publish is done.
+func (h *MQTTHandler) isDuplicatePublish(conn mqttserver.Conn, packet mqttproto.ControlPacket, publishRequest *apis.PublishRequest) bool {
+	state, stored := conn.Properties().StorePacketID(publishRequest.MessageID)
+	if !stored {
+		return false
+	}
+	h.metrics.publishDuplicatesTotal.Inc()
+	h.logger.Debugf("Duplicate 'PUBLISH' with packet identifier %d from /%v", publishRequest.MessageID, conn.RemoteAddr())
+
+	if state == mqttserver.PacketIDReceived {
+		res, err := h.getPublishRec(packet, publishRequest.MessageID)
+		if err != nil {
+			h.logger.Error(err.Error())
 			_ = conn.Close()
+			return true
+		}
+		h.writeResponse(conn, res)
+	}
+	return true
+}
+
+// limitPublish applies the publish rate limit and reports whether the message can be published.
+// Throttling pauses the handler and so the reading of the next packets of the connection. The message is dropped
+// when the connection is closed or drained while throttled.
+func (h *MQTTHandler) limitPublish(conn mqttserver.Conn, packet mqttproto.ControlPacket, publishRequest *apis.PublishRequest) bool {
+	key := h.limiter.limitKey(conn)
+	allowed, wait := h.limiter.allow(key, len(publishRequest.Message), time.Now())
+	if wait > 0 {
+		h.metrics.publishRateLimitTotal.WithLabelValues(RateLimitActionThrottle).Inc()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-conn.Context().Done():
+			timer.Stop()
+			return false
+		}
+	}
+	if allowed {
+		return true
+	}
+	h.metrics.publishRateLimitTotal.WithLabelValues(h.limiter.action).Inc()
+	h.logger.Debugf("Publish rate limit of '%s' exceeded from /%v", key, conn.RemoteAddr())
+
+	_, isV5 := packet.(*mqtt5.PublishPacket)
+	switch {
+	case h.limiter.action == RateLimitActionQuotaExceeded && publishRequest.Qos == mqttproto.AT_MOST_ONCE:
+		// there is no response to a dropped QoS 0 message
+	case h.limiter.action == RateLimitActionQuotaExceeded && isV5:
+		h.writeResponse(conn, getPublishNack(publishRequest, mqtt5.QuotaExceeded))
+	default:
+		// MQTT 3.1.1 has no negative acknowledgement, the client retries the unacknowledged message after reconnecting
+		if isV5 {
+			disconnect := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+			disconnect.ReasonCode = mqtt5.QuotaExceeded
+			h.writeResponse(conn, disconnect)
 		}
+		h.logger.Infof("Disconnect '%s' exceeding the publish rate limit from /%v", key, conn.RemoteAddr())
+		_ = conn.Close()
+	}
+	return false
+}
+
+// releaseOnce returns a function releasing the pooled buffer of the packet, which can be called more than once.
+func releaseOnce(packet mqttproto.ControlPacket) func() {
+	releaser, ok := packet.(mqttproto.Releaser)
+	if !ok {
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(releaser.Release)
+	}
+}
+
+// releaseInflight returns a function releasing the packet and the inflight publish, which can be called more than once.
+func releaseInflight(conn mqttserver.Conn, release func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			conn.Properties().AddInflight(-1)
+		})
+	}
+}
+
+// releaseReceiving returns a function releasing the packet and the inflight QoS 1 or 2 publish, which can be called more than once.
+func releaseReceiving(conn mqttserver.Conn, release func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			conn.Properties().AddReceiving(-1)
+		})
+	}
+}
+
+func releaseAfter(callback apis.PublishCallbackFunc, release func()) apis.PublishCallbackFunc {
+	return func(request *apis.PublishRequest, response *apis.PublishResponse) {
+		defer release()
+		callback(request, response)
 	}
 }
 
@@ -310,7 +562,7 @@ func (h *MQTTHandler) handlePublishRelease(conn mqttserver.Conn, packet mqttprot
 		return
 	}
 	h.logger.Debugf("Handling MQTT message '%s' from /%v", packet.Name(), conn.RemoteAddr())
-	res, err := h.getPublishComp(packet)
+	res, err := h.getPublishComp(conn, packet)
 	if err != nil {
 		h.logger.Error(err.Error())
 		_ = conn.Close()
@@ -322,9 +574,13 @@ func (h *MQTTHandler) handlePublishRelease(conn mqttserver.Conn, packet mqttprot
 	}
 }
 
-func (h *MQTTHandler) getPublishComp(packet mqttproto.ControlPacket) (mqttproto.ControlPacket, error) {
+// getPublishComp releases the packet identifier, MQTT 5 clients are notified when the identifier is unknown.
+func (h *MQTTHandler) getPublishComp(conn mqttserver.Conn, packet mqttproto.ControlPacket) (mqttproto.ControlPacket, error) {
 	switch req := packet.(type) {
 	case *mqtt311.PubrelPacket:
+		if !conn.Properties().ReleasePacketID(req.MessageID) {
+			h.logger.Debugf("'PUBREL' with unknown packet identifier %d from /%v", req.MessageID, conn.RemoteAddr())
+		}
 		res := mqtt311.NewControlPacket(mqttproto.PUBCOMP).(*mqtt311.PubcompPacket)
 		res.MessageID = req.MessageID
 		return res, nil
@@ -332,6 +588,10 @@ func (h *MQTTHandler) getPublishComp(packet mqttproto.ControlPacket) (mqttproto.
 		res := mqtt5.NewControlPacket(mqttproto.PUBCOMP).(*mqtt5.PubcompPacket)
 		res.MessageID = req.MessageID
 		res.ReasonCode = 0
+		if !conn.Properties().ReleasePacketID(req.MessageID) {
+			h.logger.Debugf("'PUBREL' with unknown packet identifier %d from /%v", req.MessageID, conn.RemoteAddr())
+			res.ReasonCode = mqtt5.PacketIdentifierNotFound
+		}
 		return res, nil
 	default:
 		return nil, fmt.Errorf("unsupported pubrel packet type %v", reflect.TypeOf(packet))
@@ -360,9 +620,14 @@ func (h *MQTTHandler) handlePing(conn mqttserver.Conn, packet mqttproto.ControlP
 }
 
 func (h *MQTTHandler) handleDisconnect(conn mqttserver.Conn, packet mqttproto.ControlPacket) {
-	switch packet.(type) {
+	switch req := packet.(type) {
 	case *mqtt311.DisconnectPacket:
+		conn.Properties().SetWill(nil)
 	case *mqtt5.DisconnectPacket:
+		// the will is published unless the client disconnects normally
+		if req.ReasonCode == mqtt5.NormalDisconnection {
+			conn.Properties().SetWill(nil)
+		}
 	default:
 		h.logger.Warnf("Unsupported disconnect packet type %v", reflect.TypeOf(packet))
 	}
@@ -373,6 +638,15 @@ func (h *MQTTHandler) handleDisconnect(conn mqttserver.Conn, packet mqttproto.Co
 	}
 }
 
+func (h *MQTTHandler) writeResponse(conn mqttserver.Conn, res mqttproto.ControlPacket) {
+	err := res.Write(conn)
+	if err != nil {
+		h.logger.WithError(err).Errorf("Write '%s' failed", res.Name())
+	} else {
+		h.metrics.responsesTotal.WithLabelValues(res.Name(), mqttproto.MqttProtocolVersionName(res.Version())).Inc()
+	}
+}
+
 func (h *MQTTHandler) ignore(conn mqttserver.Conn, packet mqttproto.ControlPacket) {
 	h.logger.Debugf("No handler available for MQTT message '%s' from /%v. Ignoring", packet.Name(), conn.RemoteAddr())
 }
@@ -388,12 +662,14 @@ func New(logger log.Logger, registry *prometheus.Registry, publisher apis.Publis
 		opts:      options,
 		metrics:   newMQTTMetrics(registry),
 		publisher: publisher,
+		limiter:   newPublishLimiter(options.publishRateLimitKey, options.publishRateLimitAction, options.publishRateLimit, options.publishRateLimits),
 	}
 	h.HandleFunc(mqttproto.CONNECT, h.handleConnect)
 	h.HandleFunc(mqttproto.PUBLISH, h.handlePublish)
 	h.HandleFunc(mqttproto.DISCONNECT, h.handleDisconnect)
 	h.HandleFunc(mqttproto.PUBREL, h.handlePublishRelease)
 	h.HandleFunc(mqttproto.PINGREQ, h.handlePing)
+	h.HandleFunc(mqttproto.AUTH, h.handleAuth)
 
 	for _, name := range options.ignoreUnsupported {
 		for t, n := range mqttproto.MqttMessageTypeNames {
@@ -438,8 +714,33 @@ func newMQTTMetrics(registry *prometheus.Registry) *mqttMetrics {
 	responsesTotal.WithLabelValues(mqttproto.MqttMessageTypeNames[mqttproto.UNSUBACK], mqttproto.MqttProtocolVersionName(mqttproto.MQTT_DEFAULT_PROTOCOL_VERSION))
 	responsesTotal.WithLabelValues(mqttproto.MqttMessageTypeNames[mqttproto.PINGRESP], mqttproto.MqttProtocolVersionName(mqttproto.MQTT_DEFAULT_PROTOCOL_VERSION))
 
+	publishRateLimitTotal := promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_proxy_handler_publish_rate_limited_total",
+		Help: "Total number of MQTT publish requests exceeding the publish rate limit.",
+	}, []string{"action"})
+
+	publishDuplicatesTotal := promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_proxy_handler_publish_duplicates_total",
+		Help: "Total number of retransmitted QoS 2 MQTT publish requests, which are not published again.",
+	})
+
+	publishFailuresTotal := promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_proxy_handler_publish_failures_total",
+		Help: "Total number of QoS 1 and QoS 2 MQTT publish requests which could not be published.",
+	}, []string{"action"})
+
+	willMessagesTotal := promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_proxy_handler_will_messages_total",
+		Help: "Total number of MQTT will messages.",
+	}, []string{"result"})
+
 	return &mqttMetrics{
-		requestsTotal:  requestsTotal,
-		responsesTotal: responsesTotal,
+		requestsTotal:         requestsTotal,
+		responsesTotal:        responsesTotal,
+		publishRateLimitTotal: publishRateLimitTotal,
+
+		publishDuplicatesTotal: publishDuplicatesTotal,
+		publishFailuresTotal:   publishFailuresTotal,
+		willMessagesTotal:      willMessagesTotal,
 	}
 }
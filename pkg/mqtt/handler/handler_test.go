@@ -0,0 +1,441 @@
+package mqtthandler
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	authnoop "github.com/grepplabs/mqtt-proxy/pkg/auth/noop"
+	authplain "github.com/grepplabs/mqtt-proxy/pkg/auth/plain"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+func newTestServer(t *testing.T, opts ...Option) net.Addr {
+	return serveTestServer(t, &mqttserver.Server{}, opts...)
+}
+
+func serveTestServer(t *testing.T, srv *mqttserver.Server, opts ...Option) net.Addr {
+	logger := log.NewDefaultLogger()
+	registry := prometheus.NewRegistry()
+	srv.Handler = New(logger, registry, noop.New(logger, registry), opts...)
+	srv.ErrorLog = logger
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr()
+}
+
+func dialTestServer(t *testing.T, addr net.Addr) net.Conn {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func writePacket(t *testing.T, conn net.Conn, packet mqttproto.ControlPacket) {
+	require.NoError(t, packet.Write(conn))
+}
+
+func readV311Packet(t *testing.T, conn net.Conn) mqttproto.ControlPacket {
+	packet, err := mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+	return packet
+}
+
+func readV5Packet(t *testing.T, conn net.Conn) mqttproto.ControlPacket {
+	packet, err := mqtt5.ReadPacket(conn)
+	require.NoError(t, err)
+	return packet
+}
+
+func newV5Connect(clientIdentifier string, properties mqtt5.Properties) *mqtt5.ConnectPacket {
+	packet := mqtt5.NewControlPacket(mqttproto.CONNECT).(*mqtt5.ConnectPacket)
+	packet.ProtocolName = mqttproto.MQTT
+	packet.ProtocolLevel = mqttproto.MQTT_5
+	packet.CleanStart = true
+	packet.ClientIdentifier = clientIdentifier
+	packet.ConnectProperties = properties
+	return packet
+}
+
+func newV5Auth(reasonCode byte, method string, data string) *mqtt5.AuthPacket {
+	packet := mqtt5.NewControlPacket(mqttproto.AUTH).(*mqtt5.AuthPacket)
+	packet.ReasonCode = reasonCode
+	packet.AuthProperties = mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty(method), AuthenticationData: []byte(data)}
+	return packet
+}
+
+// tokenAuthenticator accepts "secret" at once or "response" after the "nonce" challenge
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Name() string   { return "token" }
+func (tokenAuthenticator) Method() string { return "TOKEN" }
+func (tokenAuthenticator) Close() error   { return nil }
+
+func (a tokenAuthenticator) Start(ctx context.Context, req *apis.EnhancedAuthRequest) (apis.EnhancedAuthSession, *apis.EnhancedAuthResponse, error) {
+	switch string(req.AuthData) {
+	case "challenge":
+		return a, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.ContinueAuthentication, AuthData: []byte("nonce")}, nil
+	case "secret":
+		return a, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.Success}, nil
+	default:
+		return a, &apis.EnhancedAuthResponse{ReasonCode: mqtt5.NotAuthorized}, nil
+	}
+}
+
+func (tokenAuthenticator) Continue(ctx context.Context, req *apis.EnhancedAuthRequest) (*apis.EnhancedAuthResponse, error) {
+	if string(req.AuthData) == "response" {
+		return &apis.EnhancedAuthResponse{ReasonCode: mqtt5.Success}, nil
+	}
+	return &apis.EnhancedAuthResponse{ReasonCode: mqtt5.NotAuthorized, ReasonString: "invalid response"}, nil
+}
+
+func TestEnhancedAuth(t *testing.T) {
+	addr := newTestServer(t, WithEnhancedAuthenticators([]apis.EnhancedAuthenticator{tokenAuthenticator{}}))
+
+	t.Run("single step", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty("TOKEN"), AuthenticationData: []byte("secret")}))
+
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.Success, connack.ReturnCode)
+		a.Equal("TOKEN", *connack.ConnackProperties.AuthenticationMethod)
+	})
+	t.Run("challenge and re-authentication", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c2", mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty("TOKEN"), AuthenticationData: []byte("challenge")}))
+
+		auth := readV5Packet(t, conn).(*mqtt5.AuthPacket)
+		a.Equal(mqtt5.ContinueAuthentication, auth.ReasonCode)
+		a.Equal("TOKEN", *auth.AuthProperties.AuthenticationMethod)
+		a.Equal([]byte("nonce"), auth.AuthProperties.AuthenticationData)
+
+		writePacket(t, conn, newV5Auth(mqtt5.ContinueAuthentication, "TOKEN", "response"))
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.Success, connack.ReturnCode)
+
+		writePacket(t, conn, newV5Auth(mqtt5.ReAuthenticate, "TOKEN", "secret"))
+		auth = readV5Packet(t, conn).(*mqtt5.AuthPacket)
+		a.Equal(mqtt5.Success, auth.ReasonCode)
+
+		writePacket(t, conn, newV5Auth(mqtt5.ReAuthenticate, "TOKEN", "invalid"))
+		disconnect := readV5Packet(t, conn).(*mqtt5.DisconnectPacket)
+		a.Equal(mqtt5.NotAuthorized, disconnect.ReasonCode)
+	})
+	t.Run("invalid response", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c3", mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty("TOKEN"), AuthenticationData: []byte("challenge")}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newV5Auth(mqtt5.ContinueAuthentication, "TOKEN", "guess"))
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.NotAuthorized, connack.ReturnCode)
+		a.Equal("invalid response", *connack.ConnackProperties.ReasonString)
+	})
+	t.Run("authentication method mismatch", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c4", mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty("TOKEN"), AuthenticationData: []byte("challenge")}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newV5Auth(mqtt5.ContinueAuthentication, "OTHER", "response"))
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.ProtocolError, connack.ReturnCode)
+	})
+	t.Run("unsupported method", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c5", mqtt5.Properties{AuthenticationMethod: mqtt5.StringProperty("SCRAM-SHA-1")}))
+
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.BadAuthenticationMethod, connack.ReturnCode)
+		_, err := mqtt5.ReadPacket(conn)
+		a.Error(err)
+	})
+}
+
+func TestMQTT31(t *testing.T) {
+	addr := newTestServer(t)
+
+	newConnect := func(clientIdentifier string) *mqtt311.ConnectPacket {
+		packet := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+		packet.ProtocolName = mqttproto.MQIsdp
+		packet.ProtocolLevel = mqttproto.MQTT_3_1
+		packet.CleanSession = true
+		packet.ClientIdentifier = clientIdentifier
+		return packet
+	}
+
+	t.Run("publish", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newConnect("device-1"))
+
+		connack := readV311Packet(t, conn).(*mqtt311.ConnackPacket)
+		a.Equal(mqttproto.Accepted, connack.ReturnCode)
+
+		publish := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+		publish.Qos = mqttproto.AT_LEAST_ONCE
+		publish.TopicName = "dummy"
+		publish.MessageID = 1
+		publish.Message = []byte("test")
+		writePacket(t, conn, publish)
+
+		puback := readV311Packet(t, conn).(*mqtt311.PubackPacket)
+		a.Equal(uint16(1), puback.MessageID)
+	})
+	t.Run("empty client identifier", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newConnect(""))
+
+		connack := readV311Packet(t, conn).(*mqtt311.ConnackPacket)
+		a.Equal(mqttproto.RefusedIdentifierRejected, connack.ReturnCode)
+	})
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	addr := serveTestServer(t, &mqttserver.Server{
+		MaxPacketSize:       256,
+		MaxPacketSizeByType: map[byte]uint32{mqttproto.CONNECT: 64},
+	})
+
+	newPublish := func(size int) *mqtt5.PublishPacket {
+		packet := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		packet.TopicName = "dummy"
+		packet.Message = make([]byte, size)
+		return packet
+	}
+
+	t.Run("v5 publish too large", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.Success, connack.ReturnCode)
+		a.Equal(uint32(256), *connack.ConnackProperties.MaximumPacketSize)
+
+		writePacket(t, conn, newPublish(512))
+		disconnect := readV5Packet(t, conn).(*mqtt5.DisconnectPacket)
+		a.Equal(mqtt5.PacketTooLarge, disconnect.ReasonCode)
+	})
+	t.Run("v5 connect too large", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect(strings.Repeat("c", 64), mqtt5.Properties{}))
+
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.PacketTooLarge, connack.ReturnCode)
+	})
+	t.Run("v311 publish too large", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+		connect.ProtocolName = mqttproto.MQTT
+		connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+		connect.ClientIdentifier = "c3"
+		writePacket(t, conn, connect)
+		readV311Packet(t, conn)
+
+		publish := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+		publish.TopicName = "dummy"
+		publish.Message = make([]byte, 512)
+		writePacket(t, conn, publish)
+
+		_, err := mqtt311.ReadPacket(conn)
+		a.Error(err)
+	})
+}
+
+func TestStrict(t *testing.T) {
+	addr := serveTestServer(t, &mqttserver.Server{Strict: true})
+
+	t.Run("v5 publish topic with wildcard", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		publish := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		publish.TopicName = "a/+"
+		writePacket(t, conn, publish)
+
+		disconnect := readV5Packet(t, conn).(*mqtt5.DisconnectPacket)
+		a.Equal(mqtt5.TopicNameInvalid, disconnect.ReasonCode)
+	})
+	t.Run("v5 connect will qos without will flag", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		connect := newV5Connect("c2", mqtt5.Properties{})
+		connect.WillQos = mqttproto.AT_LEAST_ONCE
+		writePacket(t, conn, connect)
+
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		a.Equal(mqtt5.MalformedPacket, connack.ReturnCode)
+	})
+	t.Run("v311 invalid client identifier", func(t *testing.T) {
+		a := assert.New(t)
+		conn := dialTestServer(t, addr)
+		connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+		connect.ProtocolName = mqttproto.MQTT
+		connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+		connect.ClientIdentifier = "c\x00"
+		writePacket(t, conn, connect)
+
+		connack := readV311Packet(t, conn).(*mqtt311.ConnackPacket)
+		a.Equal(mqttproto.RefusedIdentifierRejected, connack.ReturnCode)
+	})
+}
+
+func TestConnectResponseErrors(t *testing.T) {
+	addr := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		encodedHex string
+		code       byte
+	}{
+		{
+			name:       "unsupported protocol version",
+			encodedHex: "100c00044d5154540602003c0000",
+			code:       mqtt5.UnsupportedProtocolVersion,
+		},
+		{
+			name:       "malformed properties",
+			encodedHex: "100b00044d5154540502003c05",
+			code:       mqtt5.MalformedPacket,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			encodedBytes, err := hex.DecodeString(tc.encodedHex)
+			require.NoError(t, err)
+			conn := dialTestServer(t, addr)
+			_, err = conn.Write(encodedBytes)
+			require.NoError(t, err)
+
+			connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+			a.Equal(tc.code, connack.ReturnCode)
+			a.NotEmpty(connack.ConnackProperties.ReasonString)
+		})
+	}
+}
+
+func TestListenerMaxPacketSize(t *testing.T) {
+	logger := log.NewDefaultLogger()
+	registry := prometheus.NewRegistry()
+	srv := &mqttserver.Server{
+		ErrorLog:                logger,
+		MaxPacketSize:           256,
+		MaxPacketSizeByListener: map[string]uint32{"internal": 1024},
+	}
+	srv.Handler = New(logger, registry, noop.New(logger, registry))
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	internal, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(public) }()
+	go func() { _ = srv.ServeNamed("internal", internal) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	tests := []struct {
+		name          string
+		addr          net.Addr
+		maxPacketSize uint32
+		tooLarge      bool
+	}{
+		{name: "default listener", addr: public.Addr(), maxPacketSize: 256, tooLarge: true},
+		{name: "named listener", addr: internal.Addr(), maxPacketSize: 1024, tooLarge: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			conn := dialTestServer(t, tc.addr)
+			writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+
+			connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+			a.Equal(mqtt5.Success, connack.ReturnCode)
+			a.Equal(tc.maxPacketSize, *connack.ConnackProperties.MaximumPacketSize)
+
+			publish := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+			publish.TopicName = "dummy"
+			publish.Message = make([]byte, 512)
+			writePacket(t, conn, publish)
+
+			if tc.tooLarge {
+				disconnect := readV5Packet(t, conn).(*mqtt5.DisconnectPacket)
+				a.Equal(mqtt5.PacketTooLarge, disconnect.ReasonCode)
+				return
+			}
+			writePacket(t, conn, mqtt5.NewControlPacket(mqttproto.PINGREQ))
+			a.Equal(mqttproto.PINGRESP, readV5Packet(t, conn).Type())
+		})
+	}
+}
+
+func TestListenerAuthenticators(t *testing.T) {
+	logger := log.NewDefaultLogger()
+	registry := prometheus.NewRegistry()
+	plain, err := authplain.New(logger, registry, authplain.WithCredentials(map[string]string{"alice": "secret"}))
+	require.NoError(t, err)
+
+	srv := &mqttserver.Server{ErrorLog: logger}
+	srv.Handler = New(logger, registry, noop.New(logger, registry),
+		WithAuthenticator(plain),
+		WithListenerAuthenticators(map[string]apis.UserPasswordAuthenticator{"internal": authnoop.New(logger, registry)}),
+	)
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	internal, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(public) }()
+	go func() { _ = srv.ServeNamed("internal", internal) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	tests := []struct {
+		name       string
+		addr       net.Addr
+		returnCode byte
+	}{
+		{name: "default listener", addr: public.Addr(), returnCode: mqttproto.RefusedBadUserNameOrPassword},
+		{name: "named listener", addr: internal.Addr(), returnCode: mqttproto.Accepted},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dialTestServer(t, tc.addr)
+			connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+			connect.ProtocolName = mqttproto.MQTT
+			connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+			connect.ClientIdentifier = "c1"
+			connect.HasUsername = true
+			connect.Username = "bob"
+			connect.HasPassword = true
+			connect.Password = []byte("wrong")
+			writePacket(t, conn, connect)
+
+			connack := readV311Packet(t, conn).(*mqtt311.ConnackPacket)
+			require.Equal(t, tc.returnCode, connack.ReturnCode)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package mqtthandler
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func TestKeepAlivePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		v5        bool
+		requested uint16
+		keepAlive uint16
+	}{
+		{name: "no policy", requested: 0, keepAlive: 0},
+		{name: "client keep alive", requested: 30, keepAlive: 30},
+		{name: "default", opts: []Option{WithKeepAliveDefault(time.Minute)}, requested: 0, keepAlive: 60},
+		{name: "default is not applied", opts: []Option{WithKeepAliveDefault(time.Minute)}, requested: 30, keepAlive: 30},
+		{name: "min", opts: []Option{WithKeepAliveMin(10 * time.Second)}, requested: 5, keepAlive: 10},
+		{name: "min without default", opts: []Option{WithKeepAliveMin(10 * time.Second)}, requested: 0, keepAlive: 10},
+		{name: "max is not applied to v311", opts: []Option{WithKeepAliveMax(5 * time.Minute)}, requested: 3600, keepAlive: 3600},
+		{name: "default over max", opts: []Option{WithKeepAliveDefault(time.Hour), WithKeepAliveMax(5 * time.Minute)}, requested: 0, keepAlive: 300},
+		{name: "max without default", opts: []Option{WithKeepAliveMax(5 * time.Minute)}, requested: 0, keepAlive: 300},
+		{name: "v5 max", opts: []Option{WithKeepAliveMax(5 * time.Minute)}, v5: true, requested: 3600, keepAlive: 300},
+		{name: "v5 max without default", opts: []Option{WithKeepAliveMax(5 * time.Minute)}, v5: true, requested: 0, keepAlive: 300},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			options := options{}
+			for _, o := range tc.opts {
+				o.apply(&options)
+			}
+			h := &MQTTHandler{opts: options}
+			assert.Equal(t, tc.keepAlive, h.keepAlive(tc.requested, tc.v5))
+		})
+	}
+}
+
+func TestKeepAliveSeconds(t *testing.T) {
+	assert.Equal(t, uint16(0), keepAliveSeconds(0))
+	assert.Equal(t, uint16(1), keepAliveSeconds(100*time.Millisecond))
+	assert.Equal(t, uint16(90), keepAliveSeconds(90*time.Second))
+	assert.Equal(t, uint16(math.MaxUint16), keepAliveSeconds(24*time.Hour))
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	addr := newTestServer(t, WithKeepAliveDefault(time.Second), WithKeepAliveMax(time.Minute))
+
+	t.Run("v5 keep alive imposed", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		connect := newV5Connect("c1", mqtt5.Properties{})
+		connect.KeepAliveSeconds = 3600
+		writePacket(t, conn, connect)
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		require.NotNil(t, connack.ConnackProperties.ServerKeepAlive)
+		assert.Equal(t, uint16(60), *connack.ConnackProperties.ServerKeepAlive)
+	})
+	t.Run("v5 keep alive accepted", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		connect := newV5Connect("c2", mqtt5.Properties{})
+		connect.KeepAliveSeconds = 30
+		writePacket(t, conn, connect)
+		assert.Nil(t, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ConnackProperties.ServerKeepAlive)
+	})
+	t.Run("v311 keep alive 0 times out", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV311Connect("c3"))
+		readV311Packet(t, conn)
+		start := time.Now()
+		_, err := mqtt311.ReadPacket(conn)
+		assert.Error(t, err)
+		// the connection is closed after 1.5 times the keep alive
+		assert.Greater(t, time.Since(start), time.Second)
+		assert.Less(t, time.Since(start), 4*time.Second)
+	})
+	t.Run("v311 keep alive above max kept", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		connect := newV311Connect("c4")
+		connect.KeepAliveSeconds = 3600
+		writePacket(t, conn, connect)
+		readV311Packet(t, conn)
+		// the connection is not closed after 1.5 times the maximum
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, err := mqtt311.ReadPacket(conn)
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	})
+}
+
+func TestServerKeepAliveMaxWithoutDefault(t *testing.T) {
+	addr := newTestServer(t, WithKeepAliveMax(time.Second))
+
+	t.Run("v311 keep alive 0 times out", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV311Connect("c1"))
+		readV311Packet(t, conn)
+		start := time.Now()
+		_, err := mqtt311.ReadPacket(conn)
+		assert.Error(t, err)
+		assert.Greater(t, time.Since(start), time.Second)
+		assert.Less(t, time.Since(start), 4*time.Second)
+	})
+	t.Run("v5 keep alive 0 times out", func(t *testing.T) {
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c2", mqtt5.Properties{}))
+		connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+		require.NotNil(t, connack.ConnackProperties.ServerKeepAlive)
+		assert.Equal(t, uint16(1), *connack.ConnackProperties.ServerKeepAlive)
+		start := time.Now()
+		_, err := mqtt5.ReadPacket(conn)
+		assert.Error(t, err)
+		assert.Greater(t, time.Since(start), time.Second)
+		assert.Less(t, time.Since(start), 4*time.Second)
+	})
+}
@@ -2,6 +2,8 @@ package mqtthandler
 
 import (
 	"github.com/grepplabs/mqtt-proxy/apis"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	"math"
 	"time"
 )
 
@@ -13,6 +15,18 @@ type options struct {
 	publishAsyncAtLeastOnce bool
 	publishAsyncExactlyOnce bool
 	authenticator           apis.UserPasswordAuthenticator
+	enhancedAuthenticators  []apis.EnhancedAuthenticator
+	listenerAuthenticators  map[string]apis.UserPasswordAuthenticator
+	publishRateLimit        RateLimit
+	publishRateLimitKey     string
+	publishRateLimitAction  string
+	publishRateLimits       map[string]RateLimit
+	publishFailurePolicy    string
+	banList                 *ban.List
+	keepAliveMin            uint16
+	keepAliveMax            uint16
+	keepAliveDefault        uint16
+	topicAliasMaximum       uint16
 }
 
 type Option interface {
@@ -66,3 +80,100 @@ func WithAuthenticator(a apis.UserPasswordAuthenticator) Option {
 		o.authenticator = a
 	})
 }
+
+// WithEnhancedAuthenticators sets the MQTT 5 enhanced authenticators by Authentication Method.
+// The server command does not register any, so the AUTH exchange is available only to library users.
+func WithEnhancedAuthenticators(a []apis.EnhancedAuthenticator) Option {
+	return optionFunc(func(o *options) {
+		o.enhancedAuthenticators = a
+	})
+}
+
+// WithListenerAuthenticators sets the authenticators by listener name, overriding the authenticator of WithAuthenticator.
+func WithListenerAuthenticators(m map[string]apis.UserPasswordAuthenticator) Option {
+	return optionFunc(func(o *options) {
+		o.listenerAuthenticators = m
+	})
+}
+
+// WithPublishRateLimit sets the default publish rate limit of a client.
+func WithPublishRateLimit(limit RateLimit) Option {
+	return optionFunc(func(o *options) {
+		o.publishRateLimit = limit
+	})
+}
+
+// WithPublishRateLimitKey sets whether the publish rate is limited by client ID or by username.
+func WithPublishRateLimitKey(key string) Option {
+	return optionFunc(func(o *options) {
+		o.publishRateLimitKey = key
+	})
+}
+
+// WithPublishRateLimitAction sets the action taken when a client exceeds the publish rate limit.
+func WithPublishRateLimitAction(action string) Option {
+	return optionFunc(func(o *options) {
+		o.publishRateLimitAction = action
+	})
+}
+
+// WithPublishRateLimits overrides the default publish rate limit by client ID or username.
+func WithPublishRateLimits(limits map[string]RateLimit) Option {
+	return optionFunc(func(o *options) {
+		o.publishRateLimits = limits
+	})
+}
+
+// WithPublishFailurePolicy sets the policy applied when a QoS 1 or QoS 2 message cannot be published.
+func WithPublishFailurePolicy(policy string) Option {
+	return optionFunc(func(o *options) {
+		o.publishFailurePolicy = policy
+	})
+}
+
+// WithBanList rejects the CONNECT of banned clients before the authentication.
+func WithBanList(list *ban.List) Option {
+	return optionFunc(func(o *options) {
+		o.banList = list
+	})
+}
+
+// WithKeepAliveMin sets the minimum keep alive, lower keep alive requested by the clients is increased.
+func WithKeepAliveMin(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.keepAliveMin = keepAliveSeconds(d)
+	})
+}
+
+// WithKeepAliveMax sets the maximum keep alive, higher keep alive requested by the clients is decreased.
+func WithKeepAliveMax(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.keepAliveMax = keepAliveSeconds(d)
+	})
+}
+
+// WithKeepAliveDefault sets the keep alive of the clients which disabled the keep alive.
+func WithKeepAliveDefault(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.keepAliveDefault = keepAliveSeconds(d)
+	})
+}
+
+// keepAliveSeconds converts the duration to the keep alive in seconds, rounded up and limited to the MQTT maximum.
+func keepAliveSeconds(d time.Duration) uint16 {
+	seconds := (d + time.Second - 1) / time.Second
+	if seconds > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return uint16(seconds)
+}
+
+// WithTopicAliasMaximum sets the highest topic alias accepted from MQTT 5 clients, 0 means the topic aliases are not accepted.
+func WithTopicAliasMaximum(n uint16) Option {
+	return optionFunc(func(o *options) {
+		o.topicAliasMaximum = n
+	})
+}
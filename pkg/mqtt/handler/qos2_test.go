@@ -0,0 +1,139 @@
+package mqtthandler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+// countingPublisher counts the published messages, the first messages are not delivered until failures drops to 0
+type countingPublisher struct {
+	*noop.Publisher
+	published atomic.Int32
+	failures  atomic.Int32
+}
+
+func (p *countingPublisher) Publish(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
+	if p.failures.Dec() >= 0 {
+		return &apis.PublishResponse{Error: errors.New("not delivered")}, nil
+	}
+	p.published.Inc()
+	return p.Publisher.Publish(ctx, request)
+}
+
+func newPublisherTestServer(t *testing.T, publisher apis.Publisher, opts ...Option) net.Addr {
+	logger := log.NewDefaultLogger()
+	srv := &mqttserver.Server{
+		Handler:  New(logger, prometheus.NewRegistry(), publisher, opts...),
+		ErrorLog: logger,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr()
+}
+
+func newTestPubrel(version byte, messageID uint16) mqttproto.ControlPacket {
+	if version == mqttproto.MQTT_5 {
+		packet := mqtt5.NewControlPacket(mqttproto.PUBREL).(*mqtt5.PubrelPacket)
+		packet.MessageID = messageID
+		return packet
+	}
+	packet := mqtt311.NewControlPacket(mqttproto.PUBREL).(*mqtt311.PubrelPacket)
+	packet.MessageID = messageID
+	return packet
+}
+
+func TestExactlyOnce(t *testing.T) {
+	t.Run("v5", func(t *testing.T) {
+		a := assert.New(t)
+		logger := log.NewDefaultLogger()
+		publisher := &countingPublisher{Publisher: noop.New(logger, nil)}
+		conn := dialTestServer(t, newPublisherTestServer(t, publisher))
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 1))
+		pubrec := readV5Packet(t, conn).(*mqtt5.PubrecPacket)
+		a.Equal(uint16(1), pubrec.MessageID)
+		a.Equal(mqtt5.Success, pubrec.ReasonCode)
+
+		// the retransmission is acknowledged again but not published
+		duplicate := newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 1).(*mqtt5.PublishPacket)
+		duplicate.Dup = true
+		writePacket(t, conn, duplicate)
+		pubrec = readV5Packet(t, conn).(*mqtt5.PubrecPacket)
+		a.Equal(uint16(1), pubrec.MessageID)
+		a.Equal(mqtt5.Success, pubrec.ReasonCode)
+		a.Equal(int32(1), publisher.published.Load())
+
+		writePacket(t, conn, newTestPubrel(mqttproto.MQTT_5, 1))
+		pubcomp := readV5Packet(t, conn).(*mqtt5.PubcompPacket)
+		a.Equal(uint16(1), pubcomp.MessageID)
+		a.Equal(mqtt5.Success, pubcomp.ReasonCode)
+
+		// the packet identifier is released
+		writePacket(t, conn, newTestPubrel(mqttproto.MQTT_5, 1))
+		pubcomp = readV5Packet(t, conn).(*mqtt5.PubcompPacket)
+		a.Equal(uint16(1), pubcomp.MessageID)
+		a.Equal(mqtt5.PacketIdentifierNotFound, pubcomp.ReasonCode)
+
+		// the packet identifier can be reused
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 1))
+		a.Equal(uint16(1), readV5Packet(t, conn).(*mqtt5.PubrecPacket).MessageID)
+		a.Equal(int32(2), publisher.published.Load())
+	})
+	t.Run("v311", func(t *testing.T) {
+		a := assert.New(t)
+		logger := log.NewDefaultLogger()
+		publisher := &countingPublisher{Publisher: noop.New(logger, nil)}
+		conn := dialTestServer(t, newPublisherTestServer(t, publisher))
+		writePacket(t, conn, newV311Connect("c1"))
+		readV311Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.EXACTLY_ONCE, 7))
+		a.Equal(uint16(7), readV311Packet(t, conn).(*mqtt311.PubrecPacket).MessageID)
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.EXACTLY_ONCE, 7))
+		a.Equal(uint16(7), readV311Packet(t, conn).(*mqtt311.PubrecPacket).MessageID)
+		a.Equal(int32(1), publisher.published.Load())
+
+		writePacket(t, conn, newTestPubrel(mqttproto.MQTT_3_1_1, 7))
+		a.Equal(uint16(7), readV311Packet(t, conn).(*mqtt311.PubcompPacket).MessageID)
+		// MQTT 3.1.1 has no reason codes, the unknown packet identifier is completed
+		writePacket(t, conn, newTestPubrel(mqttproto.MQTT_3_1_1, 8))
+		a.Equal(uint16(8), readV311Packet(t, conn).(*mqtt311.PubcompPacket).MessageID)
+	})
+	t.Run("retransmission of undelivered message", func(t *testing.T) {
+		a := assert.New(t)
+		logger := log.NewDefaultLogger()
+		publisher := &countingPublisher{Publisher: noop.New(logger, nil)}
+		publisher.failures.Store(1)
+		conn := dialTestServer(t, newPublisherTestServer(t, publisher))
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 1))
+		writePacket(t, conn, newTestPubrel(mqttproto.MQTT_5, 1))
+		a.Equal(mqtt5.PacketIdentifierNotFound, readV5Packet(t, conn).(*mqtt5.PubcompPacket).ReasonCode)
+		a.Equal(int32(0), publisher.published.Load())
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 1))
+		a.Equal(mqtt5.Success, readV5Packet(t, conn).(*mqtt5.PubrecPacket).ReasonCode)
+		a.Equal(int32(1), publisher.published.Load())
+	})
+}
@@ -0,0 +1,150 @@
+package mqtthandler
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/util"
+)
+
+// publish rate limit keys
+const (
+	RateLimitKeyClientID = "client-id"
+	RateLimitKeyUsername = "username"
+)
+
+// actions taken when a client exceeds the publish rate limit
+const (
+	RateLimitActionThrottle      = "throttle"       // pause reading from the connection
+	RateLimitActionQuotaExceeded = "quota-exceeded" // drop the message, MQTT 5 clients receive PUBACK/PUBREC "Quota exceeded"
+	RateLimitActionDisconnect    = "disconnect"     // close the connection, MQTT 5 clients receive DISCONNECT "Quota exceeded"
+)
+
+// idle buckets are removed after this interval
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is the maximum publish rate of a client.
+type RateLimit struct {
+	Messages float64 // messages per second, 0 means no limit
+	Bytes    float64 // payload bytes per second, 0 means no limit
+}
+
+func (l RateLimit) unlimited() bool {
+	return l.Messages <= 0 && l.Bytes <= 0
+}
+
+// publishLimiter keeps the token buckets by client ID or username, so that reconnecting does not reset the limits.
+type publishLimiter struct {
+	key       string
+	action    string
+	limit     RateLimit
+	overrides map[string]RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*publishBuckets
+	lastSweep time.Time
+}
+
+type publishBuckets struct {
+	messages *util.TokenBucket // or nil when not limited
+	bytes    *util.TokenBucket // or nil when not limited
+}
+
+func newPublishLimiter(key string, action string, limit RateLimit, overrides map[string]RateLimit) *publishLimiter {
+	if limit.unlimited() && len(overrides) == 0 {
+		return nil
+	}
+	if key == "" {
+		key = RateLimitKeyClientID
+	}
+	if action == "" {
+		action = RateLimitActionThrottle
+	}
+	return &publishLimiter{
+		key:       key,
+		action:    action,
+		limit:     limit,
+		overrides: overrides,
+		buckets:   make(map[string]*publishBuckets),
+		lastSweep: time.Now(),
+	}
+}
+
+// limitKey returns the client ID or username of the connection, the remote address if it is empty.
+func (l *publishLimiter) limitKey(conn mqttserver.Conn) string {
+	var key string
+	if l.key == RateLimitKeyUsername {
+		key = conn.Properties().Username()
+	} else {
+		key = conn.Properties().ClientIdentifier()
+	}
+	if key == "" {
+		key = conn.RemoteAddr().String()
+	}
+	return key
+}
+
+// allow reports whether a message of the size can be published. With the throttle action the message is always
+// allowed and the returned duration is the time to wait before the message is published.
+func (l *publishLimiter) allow(key string, size int, now time.Time) (bool, time.Duration) {
+	limit, ok := l.overrides[key]
+	if !ok {
+		limit = l.limit
+	}
+	if limit.unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b := l.buckets[key]
+	if b == nil {
+		b = &publishBuckets{}
+		if limit.Messages > 0 {
+			b.messages = util.NewTokenBucket(limit.Messages, math.Max(1, limit.Messages), now)
+		}
+		if limit.Bytes > 0 {
+			b.bytes = util.NewTokenBucket(limit.Bytes, limit.Bytes, now)
+		}
+		l.buckets[key] = b
+	}
+	if l.action == RateLimitActionThrottle {
+		var wait time.Duration
+		if b.messages != nil {
+			wait = b.messages.Take(now, 1)
+		}
+		if b.bytes != nil {
+			if d := b.bytes.Take(now, float64(size)); d > wait {
+				wait = d
+			}
+		}
+		return true, wait
+	}
+	if b.messages != nil && !b.messages.Available(now, 1) || b.bytes != nil && !b.bytes.Available(now, float64(size)) {
+		return false, 0
+	}
+	if b.messages != nil {
+		b.messages.Take(now, 1)
+	}
+	if b.bytes != nil {
+		b.bytes.Take(now, float64(size))
+	}
+	return true, 0
+}
+
+// sweep removes the full buckets, they are equivalent to new ones.
+func (l *publishLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if (b.messages == nil || b.messages.Full(now)) && (b.bytes == nil || b.bytes.Full(now)) {
+			delete(l.buckets, key)
+		}
+	}
+}
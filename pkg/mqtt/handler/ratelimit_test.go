@@ -0,0 +1,212 @@
+package mqtthandler
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+func TestPublishLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		limit   RateLimit
+		key     string
+		sizes   []int
+		allowed []bool
+		waits   []time.Duration
+	}{
+		{
+			name:    "messages",
+			action:  RateLimitActionQuotaExceeded,
+			limit:   RateLimit{Messages: 2},
+			key:     "c1",
+			sizes:   []int{10, 10, 10},
+			allowed: []bool{true, true, false},
+			waits:   []time.Duration{0, 0, 0},
+		},
+		{
+			name:    "bytes",
+			action:  RateLimitActionDisconnect,
+			limit:   RateLimit{Bytes: 100},
+			key:     "c1",
+			sizes:   []int{60, 40, 1},
+			allowed: []bool{true, true, false},
+			waits:   []time.Duration{0, 0, 0},
+		},
+		{
+			name:    "throttle",
+			action:  RateLimitActionThrottle,
+			limit:   RateLimit{Messages: 10, Bytes: 100},
+			key:     "c1",
+			sizes:   []int{100, 50, 0},
+			allowed: []bool{true, true, true},
+			waits:   []time.Duration{0, 500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:    "override",
+			action:  RateLimitActionQuotaExceeded,
+			limit:   RateLimit{Messages: 2},
+			key:     "unlimited",
+			sizes:   []int{10, 10, 10},
+			allowed: []bool{true, true, true},
+			waits:   []time.Duration{0, 0, 0},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			l := newPublishLimiter(RateLimitKeyClientID, tc.action, tc.limit, map[string]RateLimit{"unlimited": {}})
+			now := time.Now()
+			var allowed []bool
+			var waits []time.Duration
+			for _, size := range tc.sizes {
+				ok, wait := l.allow(tc.key, size, now)
+				allowed = append(allowed, ok)
+				waits = append(waits, wait)
+			}
+			a.Equal(tc.allowed, allowed)
+			a.Equal(tc.waits, waits)
+		})
+	}
+}
+
+func TestPublishLimiterSweep(t *testing.T) {
+	a := assert.New(t)
+	l := newPublishLimiter(RateLimitKeyClientID, RateLimitActionQuotaExceeded, RateLimit{Messages: 1}, nil)
+	now := time.Now()
+	l.allow("c1", 0, now)
+	l.allow("c2", 0, now)
+	a.Len(l.buckets, 2)
+
+	now = now.Add(rateLimitSweepInterval)
+	l.allow("c1", 0, now)
+	a.Len(l.buckets, 1)
+	a.Nil(newPublishLimiter(RateLimitKeyClientID, RateLimitActionThrottle, RateLimit{}, nil))
+}
+
+func newTestPublish(version byte, qos byte, messageID uint16) mqttproto.ControlPacket {
+	if version == mqttproto.MQTT_5 {
+		packet := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		packet.TopicName = "t"
+		packet.Qos = qos
+		packet.MessageID = messageID
+		packet.Message = []byte("hello")
+		return packet
+	}
+	packet := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+	packet.TopicName = "t"
+	packet.Qos = qos
+	packet.MessageID = messageID
+	packet.Message = []byte("hello")
+	return packet
+}
+
+func TestPublishRateLimit(t *testing.T) {
+	t.Run("v5 quota exceeded", func(t *testing.T) {
+		a := assert.New(t)
+		addr := newTestServer(t,
+			WithPublishRateLimit(RateLimit{Messages: 0.001}),
+			WithPublishRateLimitAction(RateLimitActionQuotaExceeded),
+		)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_LEAST_ONCE, 1))
+		a.Equal(mqtt5.Success, readV5Packet(t, conn).(*mqtt5.PubackPacket).ReasonCode)
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_LEAST_ONCE, 2))
+		puback := readV5Packet(t, conn).(*mqtt5.PubackPacket)
+		a.Equal(uint16(2), puback.MessageID)
+		a.Equal(mqtt5.QuotaExceeded, puback.ReasonCode)
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.EXACTLY_ONCE, 3))
+		a.Equal(mqtt5.QuotaExceeded, readV5Packet(t, conn).(*mqtt5.PubrecPacket).ReasonCode)
+	})
+
+	t.Run("v5 disconnect", func(t *testing.T) {
+		a := assert.New(t)
+		addr := newTestServer(t,
+			WithPublishRateLimit(RateLimit{Messages: 0.001}),
+			WithPublishRateLimitAction(RateLimitActionDisconnect),
+		)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_MOST_ONCE, 0))
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_MOST_ONCE, 0))
+		a.Equal(mqtt5.QuotaExceeded, readV5Packet(t, conn).(*mqtt5.DisconnectPacket).ReasonCode)
+		_, err := mqtt5.ReadPacket(conn)
+		a.Equal(io.EOF, err)
+	})
+
+	t.Run("v5 throttle interrupted by shutdown", func(t *testing.T) {
+		a := assert.New(t)
+		srv := &mqttserver.Server{}
+		addr := serveTestServer(t, srv,
+			WithPublishRateLimit(RateLimit{Messages: 0.001}),
+			WithPublishRateLimitAction(RateLimitActionThrottle),
+		)
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_LEAST_ONCE, 1))
+		a.Equal(uint16(1), readV5Packet(t, conn).(*mqtt5.PubackPacket).MessageID)
+		// the second publish waits for a token for 1000 seconds
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_5, mqttproto.AT_LEAST_ONCE, 2))
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		a.NoError(srv.Shutdown(ctx))
+		// the throttled message is dropped, the client publishes it again after reconnecting
+		a.Equal(mqtt5.ServerShuttingDown, readV5Packet(t, conn).(*mqtt5.DisconnectPacket).ReasonCode)
+	})
+
+	t.Run("v311 quota exceeded by username", func(t *testing.T) {
+		a := assert.New(t)
+		addr := newTestServer(t,
+			WithPublishRateLimit(RateLimit{Messages: 0.001}),
+			WithPublishRateLimitKey(RateLimitKeyUsername),
+			WithPublishRateLimitAction(RateLimitActionQuotaExceeded),
+			WithPublishRateLimits(map[string]RateLimit{"admin": {}}),
+		)
+		connect := func(username string) *mqtt311.ConnectPacket {
+			packet := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+			packet.ProtocolName = mqttproto.MQTT
+			packet.ProtocolLevel = mqttproto.MQTT_3_1_1
+			packet.ClientIdentifier = username
+			packet.HasUsername = true
+			packet.Username = username
+			return packet
+		}
+
+		admin := dialTestServer(t, addr)
+		writePacket(t, admin, connect("admin"))
+		readV311Packet(t, admin)
+		for i := uint16(1); i <= 3; i++ {
+			writePacket(t, admin, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.AT_LEAST_ONCE, i))
+			a.Equal(i, readV311Packet(t, admin).(*mqtt311.PubackPacket).MessageID)
+		}
+
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, connect("device"))
+		readV311Packet(t, conn)
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.AT_LEAST_ONCE, 1))
+		readV311Packet(t, conn)
+		// there is no negative acknowledgement in MQTT 3.1.1
+		writePacket(t, conn, newTestPublish(mqttproto.MQTT_3_1_1, mqttproto.AT_LEAST_ONCE, 2))
+		_, err := mqtt311.ReadPacket(conn)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,43 @@
+package mqtthandler
+
+import (
+	"github.com/grepplabs/mqtt-proxy/apis"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// resolveTopicAlias sets the topic name of the MQTT 5 PUBLISH sent with a topic alias and reports whether the alias is valid.
+// A topic name sent with the alias maps the alias for the following messages of the connection, an empty topic name
+// is replaced with the mapped one. The connection is closed with DISCONNECT "Topic Alias invalid" when the alias
+// is out of range or not mapped.
+func (h *MQTTHandler) resolveTopicAlias(conn mqttserver.Conn, packet mqttproto.ControlPacket, publishRequest *apis.PublishRequest) bool {
+	req, ok := packet.(*mqtt5.PublishPacket)
+	if !ok || req.PublishProperties.TopicAlias == nil {
+		return true
+	}
+	alias := *req.PublishProperties.TopicAlias
+	if alias == 0 || alias > h.opts.topicAliasMaximum {
+		h.disconnectTopicAliasInvalid(conn, alias, "out of range")
+		return false
+	}
+	if publishRequest.TopicName != "" {
+		conn.Properties().SetTopicAlias(alias, publishRequest.TopicName)
+		return true
+	}
+	topicName, ok := conn.Properties().TopicAlias(alias)
+	if !ok {
+		h.disconnectTopicAliasInvalid(conn, alias, "not mapped")
+		return false
+	}
+	publishRequest.TopicName = topicName
+	return true
+}
+
+func (h *MQTTHandler) disconnectTopicAliasInvalid(conn mqttserver.Conn, alias uint16, reason string) {
+	h.logger.Infof("Disconnect client sending topic alias %d %s from /%v", alias, reason, conn.RemoteAddr())
+	disconnect := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+	disconnect.ReasonCode = mqtt5.TopicAliasInvalid
+	h.writeResponse(conn, disconnect)
+	_ = conn.Close()
+}
@@ -0,0 +1,92 @@
+package mqtthandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func newAliasPublish(topicName string, alias uint16) *mqtt5.PublishPacket {
+	packet := newTestPublish(mqttproto.MQTT_5, mqttproto.AT_MOST_ONCE, 0).(*mqtt5.PublishPacket)
+	packet.TopicName = topicName
+	packet.PublishProperties.TopicAlias = &alias
+	return packet
+}
+
+func TestTopicAliasMaximum(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t, WithTopicAliasMaximum(5)))
+	writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+	connack := readV5Packet(t, conn).(*mqtt5.ConnackPacket)
+	require.NotNil(t, connack.ConnackProperties.TopicAliasMaximum)
+	assert.Equal(t, uint16(5), *connack.ConnackProperties.TopicAliasMaximum)
+
+	conn = dialTestServer(t, newTestServer(t))
+	writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+	assert.Nil(t, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ConnackProperties.TopicAliasMaximum)
+}
+
+func TestTopicAlias(t *testing.T) {
+	publisher := newRecordingPublisher()
+	addr := newPublisherTestServer(t, publisher, WithTopicAliasMaximum(5))
+
+	conn := dialTestServer(t, addr)
+	writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+	readV5Packet(t, conn)
+
+	for _, tc := range []struct {
+		topicName string
+		alias     uint16
+		expected  string
+	}{
+		{topicName: "sensors/1/temperature", alias: 1, expected: "sensors/1/temperature"},
+		{topicName: "", alias: 1, expected: "sensors/1/temperature"},
+		{topicName: "sensors/1/humidity", alias: 5, expected: "sensors/1/humidity"},
+		{topicName: "", alias: 5, expected: "sensors/1/humidity"},
+		{topicName: "sensors/2/temperature", alias: 1, expected: "sensors/2/temperature"},
+		{topicName: "", alias: 1, expected: "sensors/2/temperature"},
+	} {
+		writePacket(t, conn, newAliasPublish(tc.topicName, tc.alias))
+		request := publisher.next(time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, tc.expected, request.TopicName)
+	}
+
+	// the aliases are mapped per connection
+	conn = dialTestServer(t, addr)
+	writePacket(t, conn, newV5Connect("c2", mqtt5.Properties{}))
+	readV5Packet(t, conn)
+	writePacket(t, conn, newAliasPublish("", 1))
+	assert.Equal(t, mqtt5.TopicAliasInvalid, readV5Packet(t, conn).(*mqtt5.DisconnectPacket).ReasonCode)
+}
+
+func TestTopicAliasInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		topicName string
+		alias     uint16
+	}{
+		{name: "above maximum", opts: []Option{WithTopicAliasMaximum(5)}, topicName: "t", alias: 6},
+		{name: "not accepted", topicName: "t", alias: 1},
+		{name: "not mapped", opts: []Option{WithTopicAliasMaximum(5)}, topicName: "", alias: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			publisher := newRecordingPublisher()
+			conn := dialTestServer(t, newPublisherTestServer(t, publisher, tc.opts...))
+			writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+			readV5Packet(t, conn)
+
+			writePacket(t, conn, newAliasPublish(tc.topicName, tc.alias))
+			assert.Equal(t, mqtt5.TopicAliasInvalid, readV5Packet(t, conn).(*mqtt5.DisconnectPacket).ReasonCode)
+			_, err := mqtt5.ReadPacket(conn)
+			assert.Error(t, err)
+			assert.Nil(t, publisher.next(50*time.Millisecond))
+		})
+	}
+}
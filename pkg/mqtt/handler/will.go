@@ -0,0 +1,162 @@
+package mqtthandler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// will message results
+const (
+	willPublished = "published"
+	willFailed    = "failed"
+	willCancelled = "cancelled"
+)
+
+// will is the message published when the connection of the client is closed without DISCONNECT.
+type will struct {
+	request *apis.PublishRequest
+	delay   time.Duration
+}
+
+// getWill returns the will message sent in the CONNECT packet or nil.
+func getWill(packet mqttproto.ControlPacket) *will {
+	switch req := packet.(type) {
+	case *mqtt311.ConnectPacket:
+		if !req.WillFlag {
+			return nil
+		}
+		return &will{
+			request: &apis.PublishRequest{
+				Qos:       req.WillQos,
+				Retain:    req.WillRetain,
+				TopicName: req.WillTopic,
+				Message:   req.WillMessage,
+				ClientID:  req.ClientIdentifier,
+			},
+		}
+	case *mqtt5.ConnectPacket:
+		if !req.WillFlag {
+			return nil
+		}
+		w := &will{
+			request: &apis.PublishRequest{
+				Qos:       req.WillQos,
+				Retain:    req.WillRetain,
+				TopicName: req.WillTopic,
+				Message:   req.WillPayload,
+				ClientID:  req.ClientIdentifier,
+			},
+		}
+		// the will is published after the will delay interval or when the session ends, whichever happens first
+		if delay, expiry := req.WillProperties.WillDelayInterval, req.ConnectProperties.SessionExpiryInterval; delay != nil && expiry != nil {
+			seconds := *delay
+			if *expiry < seconds {
+				seconds = *expiry
+			}
+			w.delay = time.Duration(seconds) * time.Second
+		}
+		return w
+	default:
+		return nil
+	}
+}
+
+// pendingWills keeps the delayed will messages by client identifier.
+type pendingWills struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// schedule calls publish after the delay unless the will is cancelled, a pending will of the client is replaced.
+func (p *pendingWills) schedule(clientID string, delay time.Duration, publish func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timers == nil {
+		p.timers = make(map[string]*time.Timer)
+	}
+	if timer := p.timers[clientID]; timer != nil {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		if p.timers[clientID] == timer {
+			delete(p.timers, clientID)
+		}
+		p.mu.Unlock()
+		publish()
+	})
+	p.timers[clientID] = timer
+}
+
+// cancel stops the pending will of the client and reports whether there was one.
+func (p *pendingWills) cancel(clientID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timer := p.timers[clientID]
+	if timer == nil {
+		return false
+	}
+	delete(p.timers, clientID)
+	return timer.Stop()
+}
+
+// ServeClose publishes the will message of an authenticated client, unless the client sent DISCONNECT.
+// The will messages with a delay are cancelled when the client connects again, they are not scheduled
+// when the connection was taken over by the reconnected client.
+func (h *MQTTHandler) ServeClose(conn mqttserver.Conn) {
+	w, _ := conn.Properties().Will().(*will)
+	if w == nil || !conn.Properties().Authenticated() {
+		return
+	}
+	conn.Properties().SetWill(nil)
+
+	if w.delay > 0 && w.request.ClientID != "" {
+		if conn.ClientIDTakenOver() {
+			h.metrics.willMessagesTotal.WithLabelValues(willCancelled).Inc()
+			h.logger.Debugf("Cancelled will message of '%s' taken over", w.request.ClientID)
+			return
+		}
+		h.logger.Debugf("Delaying will message of '%s' by %v", w.request.ClientID, w.delay)
+		h.wills.schedule(w.request.ClientID, w.delay, func() {
+			h.publishWill(w)
+		})
+		return
+	}
+	h.publishWill(w)
+}
+
+// cancelWill cancels the pending will message of the client connected again.
+func (h *MQTTHandler) cancelWill(clientID string) {
+	if clientID != "" && h.wills.cancel(clientID) {
+		h.metrics.willMessagesTotal.WithLabelValues(willCancelled).Inc()
+		h.logger.Debugf("Cancelled will message of '%s'", clientID)
+	}
+}
+
+func (h *MQTTHandler) publishWill(w *will) {
+	ctx := context.Background()
+	if h.opts.publishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.publishTimeout)
+		defer cancel()
+	}
+	response, err := h.publisher.Publish(ctx, w.request)
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+	if err != nil {
+		h.metrics.willMessagesTotal.WithLabelValues(willFailed).Inc()
+		h.logger.WithError(err).Warnf("Publish of will message of '%s' to '%s' failed", w.request.ClientID, w.request.TopicName)
+		return
+	}
+	h.metrics.willMessagesTotal.WithLabelValues(willPublished).Inc()
+	h.logger.Debugf("Published will message of '%s' to '%s'", w.request.ClientID, w.request.TopicName)
+}
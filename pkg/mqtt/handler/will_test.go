@@ -0,0 +1,230 @@
+package mqtthandler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/apis"
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	"github.com/grepplabs/mqtt-proxy/pkg/publisher/noop"
+)
+
+// recordingPublisher passes the published requests to the channel
+type recordingPublisher struct {
+	*noop.Publisher
+	requests chan *apis.PublishRequest
+}
+
+func newRecordingPublisher() *recordingPublisher {
+	return &recordingPublisher{
+		Publisher: noop.New(log.NewDefaultLogger(), nil),
+		requests:  make(chan *apis.PublishRequest, 10),
+	}
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
+	p.requests <- request
+	return p.Publisher.Publish(ctx, request)
+}
+
+func (p *recordingPublisher) next(timeout time.Duration) *apis.PublishRequest {
+	select {
+	case request := <-p.requests:
+		return request
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func newV5WillConnect(clientIdentifier string, willDelay *uint32, sessionExpiry *uint32) *mqtt5.ConnectPacket {
+	packet := newV5Connect(clientIdentifier, mqtt5.Properties{SessionExpiryInterval: sessionExpiry})
+	packet.WillFlag = true
+	packet.WillQos = mqttproto.AT_LEAST_ONCE
+	packet.WillRetain = true
+	packet.WillTopic = "presence/" + clientIdentifier
+	packet.WillPayload = []byte("offline")
+	packet.WillProperties.WillDelayInterval = willDelay
+	return packet
+}
+
+func closeWrite(t *testing.T, conn net.Conn) {
+	// the client is gone without DISCONNECT
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	_, err := mqtt5.ReadPacket(conn)
+	require.Error(t, err)
+}
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
+
+func TestGetWill(t *testing.T) {
+	tests := []struct {
+		name          string
+		willDelay     *uint32
+		sessionExpiry *uint32
+		delay         time.Duration
+	}{
+		{name: "no delay"},
+		{name: "session ends at once", willDelay: uint32Ptr(30)},
+		{name: "will delay", willDelay: uint32Ptr(30), sessionExpiry: uint32Ptr(3600), delay: 30 * time.Second},
+		{name: "session expiry", willDelay: uint32Ptr(30), sessionExpiry: uint32Ptr(10), delay: 10 * time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := getWill(newV5WillConnect("c1", tc.willDelay, tc.sessionExpiry))
+			require.NotNil(t, w)
+			assert.Equal(t, tc.delay, w.delay)
+			assert.Equal(t, &apis.PublishRequest{Qos: mqttproto.AT_LEAST_ONCE, Retain: true, TopicName: "presence/c1", Message: []byte("offline"), ClientID: "c1"}, w.request)
+		})
+	}
+	assert.Nil(t, getWill(newV5Connect("c1", mqtt5.Properties{})))
+	assert.Nil(t, getWill(newV311Connect("c1")))
+}
+
+func TestWill(t *testing.T) {
+	t.Run("v311 connection lost", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		conn := dialTestServer(t, newPublisherTestServer(t, publisher))
+		connect := newV311Connect("c1")
+		connect.WillFlag = true
+		connect.WillTopic = "presence/c1"
+		connect.WillMessage = []byte("offline")
+		writePacket(t, conn, connect)
+		readV311Packet(t, conn)
+
+		closeWrite(t, conn)
+		request := publisher.next(time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, "presence/c1", request.TopicName)
+		assert.Equal(t, []byte("offline"), request.Message)
+		assert.Equal(t, "c1", request.ClientID)
+	})
+	t.Run("v311 disconnect", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		conn := dialTestServer(t, newPublisherTestServer(t, publisher))
+		connect := newV311Connect("c1")
+		connect.WillFlag = true
+		connect.WillTopic = "presence/c1"
+		writePacket(t, conn, connect)
+		readV311Packet(t, conn)
+
+		writePacket(t, conn, mqtt311.NewControlPacket(mqttproto.DISCONNECT))
+		_, err := mqtt311.ReadPacket(conn)
+		require.Error(t, err)
+		assert.Nil(t, publisher.next(100*time.Millisecond))
+	})
+	t.Run("v5 disconnect", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		addr := newPublisherTestServer(t, publisher)
+
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5WillConnect("c1", nil, nil))
+		readV5Packet(t, conn)
+		writePacket(t, conn, mqtt5.NewControlPacket(mqttproto.DISCONNECT))
+		_, err := mqtt5.ReadPacket(conn)
+		require.Error(t, err)
+		assert.Nil(t, publisher.next(100*time.Millisecond))
+
+		// the client requests the will message
+		conn = dialTestServer(t, addr)
+		writePacket(t, conn, newV5WillConnect("c2", nil, nil))
+		readV5Packet(t, conn)
+		disconnect := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+		disconnect.ReasonCode = mqtt5.DisconnectWithWillMessage
+		writePacket(t, conn, disconnect)
+		request := publisher.next(time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, "presence/c2", request.TopicName)
+	})
+	t.Run("v5 session taken over", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		addr := newPublisherTestServer(t, publisher)
+
+		first := dialTestServer(t, addr)
+		writePacket(t, first, newV5WillConnect("c1", nil, nil))
+		readV5Packet(t, first)
+
+		second := dialTestServer(t, addr)
+		writePacket(t, second, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, second)
+		request := publisher.next(time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, "presence/c1", request.TopicName)
+	})
+	t.Run("v5 will delay", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		addr := newPublisherTestServer(t, publisher)
+
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5WillConnect("c1", uint32Ptr(1), uint32Ptr(60)))
+		readV5Packet(t, conn)
+		start := time.Now()
+		closeWrite(t, conn)
+
+		request := publisher.next(3 * time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, "presence/c1", request.TopicName)
+		assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+	})
+	t.Run("v5 will delay cancelled by reconnect", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		addr := newPublisherTestServer(t, publisher)
+
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5WillConnect("c1", uint32Ptr(1), uint32Ptr(60)))
+		readV5Packet(t, conn)
+		closeWrite(t, conn)
+		// the will is scheduled after the connection is closed
+		time.Sleep(100 * time.Millisecond)
+
+		conn = dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+		assert.Nil(t, publisher.next(1500*time.Millisecond))
+	})
+	t.Run("v5 will delay cancelled by takeover", func(t *testing.T) {
+		// the publishes block until they are taken from the channel
+		publisher := &recordingPublisher{Publisher: noop.New(log.NewDefaultLogger(), nil), requests: make(chan *apis.PublishRequest)}
+		addr := newPublisherTestServer(t, publisher)
+
+		old := dialTestServer(t, addr)
+		writePacket(t, old, newV5WillConnect("c1", uint32Ptr(1), uint32Ptr(60)))
+		readV5Packet(t, old)
+		publish := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+		publish.TopicName = "dummy"
+		writePacket(t, old, publish)
+
+		// the taken over connection is closed after the new connection is accepted
+		conn := dialTestServer(t, addr)
+		writePacket(t, conn, newV5Connect("c1", mqtt5.Properties{}))
+		readV5Packet(t, conn)
+		assert.Equal(t, mqtt5.SessionTakenOver, readV5Packet(t, old).(*mqtt5.DisconnectPacket).ReasonCode)
+		time.Sleep(100 * time.Millisecond)
+
+		request := publisher.next(time.Second)
+		require.NotNil(t, request)
+		assert.Equal(t, "dummy", request.TopicName)
+		assert.Nil(t, publisher.next(1500*time.Millisecond))
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		publisher := newRecordingPublisher()
+		addr := newPublisherTestServer(t, publisher, WithEnhancedAuthenticators([]apis.EnhancedAuthenticator{tokenAuthenticator{}}))
+
+		conn := dialTestServer(t, addr)
+		connect := newV5WillConnect("c1", nil, nil)
+		connect.ConnectProperties.AuthenticationMethod = mqtt5.StringProperty("TOKEN")
+		connect.ConnectProperties.AuthenticationData = []byte("invalid")
+		writePacket(t, conn, connect)
+		assert.Equal(t, mqtt5.NotAuthorized, readV5Packet(t, conn).(*mqtt5.ConnackPacket).ReturnCode)
+		assert.Nil(t, publisher.next(100*time.Millisecond))
+	})
+}
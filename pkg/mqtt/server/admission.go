@@ -0,0 +1,164 @@
+package mqttserver
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+	"github.com/grepplabs/mqtt-proxy/pkg/util"
+)
+
+// RejectReason is the reason why a connection was not admitted.
+type RejectReason int
+
+const (
+	RejectNone RejectReason = iota
+	RejectAcceptRate
+	RejectMaxConns
+	RejectMaxConnsPerCIDR
+	RejectMaxConnsPerIP
+)
+
+// RejectReasons lists the reasons of rejected connections.
+var RejectReasons = []RejectReason{RejectAcceptRate, RejectMaxConns, RejectMaxConnsPerCIDR, RejectMaxConnsPerIP}
+
+var rejectReasonName = map[RejectReason]string{
+	RejectNone:            "none",
+	RejectAcceptRate:      "accept_rate",
+	RejectMaxConns:        "max_connections",
+	RejectMaxConnsPerCIDR: "max_connections_per_cidr",
+	RejectMaxConnsPerIP:   "max_connections_per_ip",
+}
+
+func (r RejectReason) String() string {
+	return rejectReasonName[r]
+}
+
+// connAckError returns the CONNACK error sent to the rejected client.
+func (r RejectReason) connAckError(protocolVersion byte) error {
+	if protocolVersion == mqttproto.MQTT_5 {
+		if r == RejectAcceptRate {
+			return mqtt5.NewConnAckError(mqtt5.ConnectionRateExceeded, "connection rate exceeded")
+		}
+		return mqtt5.NewConnAckError(mqtt5.ServerUnavailable, "connection limit exceeded")
+	}
+	return mqtt311.NewConnAckError(mqttproto.RefusedServerUnavailable, "connection limit exceeded")
+}
+
+// CIDRConnLimit is the maximum number of connections from all sources of a network.
+type CIDRConnLimit struct {
+	IPNet    *net.IPNet
+	MaxConns int
+}
+
+// AdmissionControl limits the connections accepted by the server. The connections over the limits are answered
+// with CONNACK "Server unavailable", MQTT 5 clients exceeding the accept rate get "Connection rate exceeded".
+type AdmissionControl struct {
+	MaxConns        int             // maximum number of connections, 0 means no limit
+	MaxConnsPerIP   int             // maximum number of connections from a source IP, 0 means no limit
+	MaxConnsPerCIDR []CIDRConnLimit // optional maximum number of connections from source networks
+	AcceptRate      float64         // connections accepted per second, 0 means no limit
+	AcceptBurst     int             // maximum number of connections accepted at once, the accept rate rounded up if 0
+
+	mu      sync.Mutex
+	conns   int
+	perIP   map[string]int
+	perCIDR map[int]int
+	bucket  *util.TokenBucket
+
+	rejected [5]atomic.Int64 // indexed by RejectReason
+}
+
+// admit reserves the connection from addr. The release func must be called when an admitted connection is closed.
+func (ac *AdmissionControl) admit(addr net.Addr) (release func(), reason RejectReason) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.AcceptRate > 0 && !ac.allowAccept(time.Now()) {
+		return nil, ac.reject(RejectAcceptRate)
+	}
+	if ac.MaxConns > 0 && ac.conns >= ac.MaxConns {
+		return nil, ac.reject(RejectMaxConns)
+	}
+	var ip net.IP
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip = tcpAddr.IP
+	}
+	var cidrs []int
+	if ip != nil {
+		for i, limit := range ac.MaxConnsPerCIDR {
+			if !limit.IPNet.Contains(ip) {
+				continue
+			}
+			if ac.perCIDR[i] >= limit.MaxConns {
+				return nil, ac.reject(RejectMaxConnsPerCIDR)
+			}
+			cidrs = append(cidrs, i)
+		}
+	}
+	key := ""
+	if ip != nil && ac.MaxConnsPerIP > 0 {
+		key = ip.String()
+		if ac.perIP[key] >= ac.MaxConnsPerIP {
+			return nil, ac.reject(RejectMaxConnsPerIP)
+		}
+	}
+
+	if ac.perIP == nil {
+		ac.perIP = make(map[string]int)
+		ac.perCIDR = make(map[int]int)
+	}
+	ac.conns++
+	for _, i := range cidrs {
+		ac.perCIDR[i]++
+	}
+	if key != "" {
+		ac.perIP[key]++
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ac.mu.Lock()
+			defer ac.mu.Unlock()
+			ac.conns--
+			for _, i := range cidrs {
+				ac.perCIDR[i]--
+			}
+			if key != "" {
+				if ac.perIP[key]--; ac.perIP[key] == 0 {
+					delete(ac.perIP, key)
+				}
+			}
+		})
+	}, RejectNone
+}
+
+func (ac *AdmissionControl) reject(reason RejectReason) RejectReason {
+	ac.rejected[reason].Inc()
+	return reason
+}
+
+func (ac *AdmissionControl) allowAccept(now time.Time) bool {
+	if ac.bucket == nil {
+		burst := float64(ac.AcceptBurst)
+		if burst <= 0 {
+			burst = math.Ceil(ac.AcceptRate)
+		}
+		ac.bucket = util.NewTokenBucket(ac.AcceptRate, burst, now)
+	}
+	return ac.bucket.Allow(now, 1)
+}
+
+// NumRejected provides the number of connections rejected for the reason.
+func (ac *AdmissionControl) NumRejected(reason RejectReason) int64 {
+	if reason <= RejectNone || int(reason) >= len(ac.rejected) {
+		return 0
+	}
+	return ac.rejected[reason].Load()
+}
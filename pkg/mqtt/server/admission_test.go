@@ -0,0 +1,182 @@
+package mqttserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}
+}
+
+func TestAdmissionControl(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		ac      *AdmissionControl
+		addrs   []net.Addr
+		reasons []RejectReason
+	}{
+		{
+			name:    "max connections",
+			ac:      &AdmissionControl{MaxConns: 2},
+			addrs:   []net.Addr{tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2"), tcpAddr("192.0.2.3")},
+			reasons: []RejectReason{RejectNone, RejectNone, RejectMaxConns},
+		},
+		{
+			name:    "max connections per IP",
+			ac:      &AdmissionControl{MaxConnsPerIP: 1},
+			addrs:   []net.Addr{tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2"), tcpAddr("192.0.2.1")},
+			reasons: []RejectReason{RejectNone, RejectNone, RejectMaxConnsPerIP},
+		},
+		{
+			name:    "max connections per CIDR",
+			ac:      &AdmissionControl{MaxConnsPerCIDR: []CIDRConnLimit{{IPNet: network, MaxConns: 1}}},
+			addrs:   []net.Addr{tcpAddr("10.0.0.1"), tcpAddr("10.0.0.2"), tcpAddr("192.0.2.1")},
+			reasons: []RejectReason{RejectNone, RejectMaxConnsPerCIDR, RejectNone},
+		},
+		{
+			name:    "accept rate",
+			ac:      &AdmissionControl{AcceptRate: 0.001, AcceptBurst: 2},
+			addrs:   []net.Addr{tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2"), tcpAddr("192.0.2.3")},
+			reasons: []RejectReason{RejectNone, RejectNone, RejectAcceptRate},
+		},
+		{
+			name:    "unix sockets are not limited per IP",
+			ac:      &AdmissionControl{MaxConnsPerIP: 1},
+			addrs:   []net.Addr{&net.UnixAddr{Name: "@", Net: "unix"}, &net.UnixAddr{Name: "@", Net: "unix"}},
+			reasons: []RejectReason{RejectNone, RejectNone},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			var reasons []RejectReason
+			for _, addr := range tc.addrs {
+				_, reason := tc.ac.admit(addr)
+				reasons = append(reasons, reason)
+			}
+			a.Equal(tc.reasons, reasons)
+			for _, reason := range tc.reasons {
+				if reason != RejectNone {
+					a.Equal(int64(1), tc.ac.NumRejected(reason))
+				}
+			}
+		})
+	}
+}
+
+func TestAdmissionControlRelease(t *testing.T) {
+	a := assert.New(t)
+	ac := &AdmissionControl{MaxConns: 1, MaxConnsPerIP: 1}
+
+	release, reason := ac.admit(tcpAddr("192.0.2.1"))
+	require.Equal(t, RejectNone, reason)
+	_, reason = ac.admit(tcpAddr("192.0.2.1"))
+	a.Equal(RejectMaxConns, reason)
+
+	release()
+	release()
+	a.Equal(0, ac.conns)
+	a.Empty(ac.perIP)
+	_, reason = ac.admit(tcpAddr("192.0.2.1"))
+	a.Equal(RejectNone, reason)
+}
+
+func TestAdmissionReject(t *testing.T) {
+	tests := []struct {
+		name       string
+		ac         *AdmissionControl
+		version    byte
+		returnCode byte
+	}{
+		{
+			name:       "v311 max connections",
+			ac:         &AdmissionControl{MaxConns: 1},
+			version:    mqttproto.MQTT_3_1_1,
+			returnCode: mqttproto.RefusedServerUnavailable,
+		},
+		{
+			name:       "v5 max connections",
+			ac:         &AdmissionControl{MaxConns: 1},
+			version:    mqttproto.MQTT_5,
+			returnCode: mqtt5.ServerUnavailable,
+		},
+		{
+			name:       "v311 accept rate",
+			ac:         &AdmissionControl{AcceptRate: 0.001, AcceptBurst: 1},
+			version:    mqttproto.MQTT_3_1_1,
+			returnCode: mqttproto.RefusedServerUnavailable,
+		},
+		{
+			name:       "v5 accept rate",
+			ac:         &AdmissionControl{AcceptRate: 0.001, AcceptBurst: 1},
+			version:    mqttproto.MQTT_5,
+			returnCode: mqtt5.ConnectionRateExceeded,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &Server{
+				Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+					_ = mqtt311.NewControlPacket(mqttproto.CONNACK).Write(c)
+				}),
+				Admission: tc.ac,
+			}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go func() { _ = srv.Serve(l) }()
+			t.Cleanup(func() { _ = srv.Close() })
+
+			// the first connection is admitted and stays open
+			first := dialConnect(t, l.Addr(), mqttproto.MQTT_3_1_1)
+			packet, err := mqtt311.ReadPacket(first)
+			require.NoError(t, err)
+			require.Equal(t, byte(0), packet.(*mqtt311.ConnackPacket).ReturnCode)
+
+			second := dialConnect(t, l.Addr(), tc.version)
+			packet, err = ReadMQTTMessage(second, tc.version)
+			require.NoError(t, err)
+			if tc.version == mqttproto.MQTT_5 {
+				assert.Equal(t, tc.returnCode, packet.(*mqtt5.ConnackPacket).ReturnCode)
+			} else {
+				assert.Equal(t, tc.returnCode, packet.(*mqtt311.ConnackPacket).ReturnCode)
+			}
+		})
+	}
+}
+
+func dialConnect(t *testing.T, addr net.Addr, version byte) net.Conn {
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if version == mqttproto.MQTT_5 {
+		connect := mqtt5.NewControlPacket(mqttproto.CONNECT).(*mqtt5.ConnectPacket)
+		connect.ProtocolName = mqttproto.MQTT
+		connect.ProtocolLevel = mqttproto.MQTT_5
+		connect.ClientIdentifier = "c5"
+		require.NoError(t, connect.Write(conn))
+		return conn
+	}
+	connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+	connect.ProtocolName = mqttproto.MQTT
+	if version == mqttproto.MQTT_3_1 {
+		connect.ProtocolName = mqttproto.MQIsdp
+	}
+	connect.ProtocolLevel = version
+	connect.ClientIdentifier = "c1"
+	require.NoError(t, connect.Write(conn))
+	return conn
+}
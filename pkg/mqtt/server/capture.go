@@ -0,0 +1,18 @@
+package mqttserver
+
+import (
+	"net"
+)
+
+// Capture records the packets exchanged with clients, e.g. to replay them later.
+type Capture interface {
+	NewConn(rwc net.Conn) ConnCapture // Called for every accepted connection
+}
+
+// ConnCapture records the encoded packets of a single connection.
+// The byte slices are reused by the server and must not be retained.
+type ConnCapture interface {
+	Received(b []byte, err error) // Packet read from the client, err is set when the packet could not be read
+	Sent(b []byte)                // Packet written to the client
+	Close()                       // Called when the connection is closed
+}
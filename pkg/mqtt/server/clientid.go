@@ -0,0 +1,77 @@
+package mqttserver
+
+import (
+	"sync"
+
+	"go.uber.org/atomic"
+
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+// policies resolving the conflicts of connections with the same client identifier
+const (
+	ClientIDPolicyTakeover  = "takeover"   // the new connection takes over, the existing one is disconnected
+	ClientIDPolicyRejectNew = "reject-new" // the new connection is rejected
+)
+
+// clientRegistry keeps the connections by client identifier.
+type clientRegistry struct {
+	mu    sync.Mutex
+	conns map[string]*conn
+
+	conflicts atomic.Int64
+}
+
+// claim registers the connection with the client identifier and reports whether the connection can use it.
+// With the takeover policy the connection holding the identifier is disconnected, MQTT 5 clients receive
+// DISCONNECT "Session taken over". Empty client identifiers are not registered.
+func (r *clientRegistry) claim(c *conn, clientID string, policy string) bool {
+	if clientID == "" {
+		return true
+	}
+	r.mu.Lock()
+	if r.conns == nil {
+		r.conns = make(map[string]*conn)
+	}
+	existing := r.conns[clientID]
+	if existing == c {
+		r.mu.Unlock()
+		return true
+	}
+	if existing != nil {
+		r.conflicts.Inc()
+		if policy == ClientIDPolicyRejectNew {
+			r.mu.Unlock()
+			return false
+		}
+	}
+	r.conns[clientID] = c
+	c.clientID = clientID
+	r.mu.Unlock()
+
+	if existing != nil {
+		existing.logger.WithField("remote", existing.remoteAddr.Load()).WithField("client", clientID).Infof("mqtt: session taken over")
+		existing.kick(mqtt5.SessionTakenOver)
+	}
+	return true
+}
+
+// release removes the closed connection.
+func (r *clientRegistry) release(c *conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.clientID != "" && r.conns[c.clientID] == c {
+		delete(r.conns, c.clientID)
+	}
+}
+
+// takenOver reports whether the client identifier of the connection is held by another connection.
+func (r *clientRegistry) takenOver(c *conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.clientID == "" {
+		return false
+	}
+	existing := r.conns[c.clientID]
+	return existing != nil && existing != c
+}
@@ -2,12 +2,15 @@ package mqttserver
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
@@ -15,6 +18,7 @@ import (
 
 	mqttcodec "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec"
 	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
 )
 
 const (
@@ -22,8 +26,16 @@ const (
 	defaultWriteBufferSize  = 1024
 )
 
-func ReadMQTTMessage(reader io.Reader, protocolVersion byte) (mqttproto.ControlPacket, error) {
-	return mqttcodec.ReadPacket(reader, protocolVersion)
+var errDraining = errors.New("mqtt: connection draining")
+
+func ReadMQTTMessage(reader io.Reader, protocolVersion byte, opts ...mqttproto.ReadOption) (mqttproto.ControlPacket, error) {
+	return mqttcodec.ReadPacket(reader, protocolVersion, opts...)
+}
+
+// tlsStater is implemented by connections which completed the TLS handshake before they were accepted,
+// e.g. secure WebSocket connections.
+type tlsStater interface {
+	TLS() *tls.ConnectionState
 }
 
 // conn represents the server side of a mqtt connection.
@@ -32,14 +44,35 @@ type conn struct {
 	rwc    net.Conn   // i/o connection
 	logger log.Logger // logger
 
+	cancelCtx context.CancelFunc // cancels the context of the handlers when the connection is closed or drained
+
+	id         uint64      // unique number of the connection, assigned when the connection is tracked
+	listener   string      // name of the listener which accepted the connection
+	created    time.Time   // time when the connection was accepted
+	properties *properties // properties of the mqtt session
+
+	clientID       string        // client identifier registered by the server, guarded by the client registry
+	remoteAddr     atomic.String // client address, set when the PROXY protocol header was read
+	tlsPeerSubject atomic.String // subject of the client certificate
+	stats          connStats
+
 	bufr *bufio.Reader
 	bufw *bufio.Writer
 
 	tlsState *tls.ConnectionState // or nil when not using TLS
 	writer   *response            // the mqtt.Conn exposed to handlers
 
-	curState atomic.Uint64 // packed (unixtime<<8|uint8(ConnState))
+	readOptions []mqttproto.ReadOption // options used to decode the client packets
+
+	capture    ConnCapture  // or nil when not capturing
+	captureBuf bytes.Buffer // raw bytes of the packet being read
+
+	writeMu sync.Mutex // guards bufw
 
+	drainScheduled atomic.Bool // true when the server scheduled the draining on shutdown
+	draining       atomic.Bool // true when the connection must be closed gracefully
+
+	curState atomic.Uint64 // packed (unixtime<<8|uint8(ConnState))
 }
 
 // Read next message from connection.
@@ -47,14 +80,144 @@ func (c *conn) readRequest(ctx context.Context, properties Properties) (w *respo
 	if c.server.ReadTimeout > 0 {
 		_ = c.rwc.SetReadDeadline(time.Now().Add(c.server.ReadTimeout))
 	}
-	req, err = ReadMQTTMessage(c.bufr, properties.ProtocolVersion())
+	// checked after the deadline is set, the read is interrupted by the deadline set by drain otherwise
+	if c.draining.Load() {
+		return nil, nil, errDraining
+	}
+	if c.capture != nil {
+		req, err = c.readCapturedRequest(properties)
+	} else {
+		req, err = ReadMQTTMessage(c.bufr, properties.ProtocolVersion(), c.readOptions...)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	properties.SetProtocolVersion(req.Version())
+	// the other MQTT 3.1 packets do not carry the protocol level and report 3.1.1
+	if req.Type() == mqttproto.CONNECT {
+		properties.SetProtocolVersion(req.Version())
+	}
+	c.stats.received(1, 0)
 	return &response{conn: c, ctx: ctx, properties: properties}, req, nil
 }
 
+func (c *conn) readCapturedRequest(properties Properties) (mqttproto.ControlPacket, error) {
+	c.captureBuf.Reset()
+	req, err := ReadMQTTMessage(io.TeeReader(c.bufr, &c.captureBuf), properties.ProtocolVersion(), c.readOptions...)
+	// nothing is recorded when the connection is closed between packets
+	if c.captureBuf.Len() != 0 {
+		c.capture.Received(c.captureBuf.Bytes(), err)
+	}
+	return req, err
+}
+
+// write sends the encoded packet to the client.
+func (c *conn) write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.server.WriteTimeout > 0 {
+		_ = c.rwc.SetWriteDeadline(time.Now().Add(c.server.WriteTimeout))
+	}
+	n, err := c.bufw.Write(b)
+	if err != nil {
+		return 0, err
+	}
+	if err = c.bufw.Flush(); err != nil {
+		return 0, err
+	}
+	c.stats.sent(n)
+	if c.capture != nil {
+		c.capture.Sent(b)
+	}
+	return n, nil
+}
+
+// close closes the connection and cancels the context of the handlers.
+func (c *conn) close() error {
+	c.cancelCtx()
+	return c.rwc.Close()
+}
+
+// drain interrupts the reading, the serving goroutine disconnects the client gracefully.
+// A handler waiting on the connection context stops waiting.
+func (c *conn) drain() {
+	c.draining.Store(true)
+	c.cancelCtx()
+	_ = c.rwc.SetReadDeadline(aLongTimeAgo)
+}
+
+// disconnect waits for the inflight publishes and sends MQTT 5 clients DISCONNECT "Server shutting down".
+func (c *conn) disconnect(properties Properties) {
+	for properties.Inflight() > 0 && !c.server.closed.Load() {
+		time.Sleep(drainPollInterval)
+	}
+	c.writeDisconnect(properties, mqtt5.ServerShuttingDown, c.server.ServerReference)
+}
+
+// waitReceiveWindow waits until an inflight QoS 1 or 2 publish is done if the receive maximum is reached.
+// The wait ends when the connection is drained or the server is closed.
+func (c *conn) waitReceiveWindow(properties *properties) {
+	for {
+		window := properties.receiveWindow()
+		if window == nil || c.draining.Load() || c.server.closed.Load() {
+			return
+		}
+		select {
+		case <-window:
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// kick closes the connection, MQTT 5 clients receive DISCONNECT with the reason code before.
+func (c *conn) kick(reasonCode byte) {
+	c.writeDisconnect(c.properties, reasonCode, "")
+	_ = c.close()
+}
+
+// writeDisconnect sends the DISCONNECT initiated by the server to MQTT 5 clients which completed the CONNECT.
+func (c *conn) writeDisconnect(properties Properties, reasonCode byte, serverReference string) {
+	if properties.ProtocolVersion() != mqttproto.MQTT_5 || !properties.Authenticated() {
+		return
+	}
+	packet := mqtt5.NewControlPacket(mqttproto.DISCONNECT).(*mqtt5.DisconnectPacket)
+	packet.ReasonCode = reasonCode
+	packet.DisconnectProperties.ServerReference = mqtt5.StringProperty(serverReference)
+	var buf bytes.Buffer
+	if err := packet.Write(&buf); err != nil {
+		return
+	}
+	_, _ = c.write(buf.Bytes())
+}
+
+// writeErrorResponse sends the response to a packet which could not be read.
+func (c *conn) writeErrorResponse(rp mqttproto.ResponsePacket) {
+	var buf bytes.Buffer
+	if err := rp.Response().Write(&buf); err != nil {
+		return
+	}
+	if _, err := c.rwc.Write(buf.Bytes()); err == nil && c.capture != nil {
+		c.capture.Sent(buf.Bytes())
+	}
+}
+
+// reject answers the CONNECT packet of a connection which was not admitted.
+func (c *conn) reject(ctx context.Context, properties Properties, reason RejectReason) {
+	_, req, err := c.readRequest(ctx, properties)
+	if err != nil {
+		if rp, ok := err.(mqttproto.ResponsePacket); ok {
+			c.writeErrorResponse(rp)
+		}
+		return
+	}
+	if req.Type() != mqttproto.CONNECT {
+		return
+	}
+	c.logger.WithField("remote", c.rwc.RemoteAddr().String()).WithField("reason", reason.String()).Debugf("mqtt: connection rejected")
+	if rp, ok := reason.connAckError(req.Version()).(mqttproto.ResponsePacket); ok {
+		c.writeErrorResponse(rp)
+	}
+}
+
 // Serve a new connection.
 func (c *conn) serve(ctx context.Context) {
 	defer func() {
@@ -63,7 +226,9 @@ func (c *conn) serve(ctx context.Context) {
 			buf = buf[:runtime.Stack(buf, false)]
 			c.logger.WithField("recover", fmt.Sprintf("%v", err)).WithField("stack", fmt.Sprintf("%s", buf)).Errorf("mqtt: panic serving from /%v", c.rwc.RemoteAddr())
 		}
-		_ = c.rwc.Close()
+		_ = c.close()
+		c.server.clients.release(c)
+		serverHandler{c.server}.ServeClose(&response{conn: c, ctx: ctx, properties: c.properties})
 		c.setState(StateClosed)
 	}()
 	if tlsConn, ok := c.rwc.(*tls.Conn); ok {
@@ -79,14 +244,49 @@ func (c *conn) serve(ctx context.Context) {
 		}
 		c.tlsState = &tls.ConnectionState{}
 		*c.tlsState = tlsConn.ConnectionState()
+	} else if tlsConn, ok := c.rwc.(tlsStater); ok {
+		c.tlsState = tlsConn.TLS()
+	}
+	if c.tlsState != nil && len(c.tlsState.PeerCertificates) != 0 {
+		c.tlsPeerSubject.Store(c.tlsState.PeerCertificates[0].Subject.String())
 	}
 
-	c.bufr = bufio.NewReaderSize(c.rwc, getBufferSize(c.server.ReaderBufferSize, defaultReaderBufferSize))
+	if c.server.Capture != nil {
+		c.capture = c.server.Capture.NewConn(c.rwc)
+		defer c.capture.Close()
+	}
+
+	c.bufr = bufio.NewReaderSize(&countingReader{r: c.rwc, stats: &c.stats}, getBufferSize(c.server.ReaderBufferSize, defaultReaderBufferSize))
 	c.bufw = bufio.NewWriterSize(c.rwc, getBufferSize(c.server.WriterBufferSize, defaultWriteBufferSize))
 
-	properties := &properties{}
+	maxPacketSize := c.server.MaxPacketSize
+	if n, ok := c.server.MaxPacketSizeByListener[c.listener]; ok {
+		maxPacketSize = n
+	}
+	c.readOptions = []mqttproto.ReadOption{
+		mqttproto.WithMaxPacketSize(maxPacketSize),
+		mqttproto.WithMaxPacketSizeByType(c.server.MaxPacketSizeByType),
+		mqttproto.WithStrict(c.server.Strict),
+		// handlers release the PUBLISH packets, the packets which are not released are garbage collected
+		mqttproto.WithPooledBuffers(true),
+	}
+
+	properties := c.properties
 	// default idle timeout - can be overridden be KeepAlive from the CONN packet
 	properties.SetIdleTimeout(c.server.IdleTimeout)
+	properties.SetMaxPacketSize(mqttproto.NewReadOptions(c.readOptions...).AdvertisedPacketSize())
+	properties.SetReceiveMaximum(c.server.ReceiveMaximum)
+	properties.SetProxyHeader(proxyHeader(c.rwc))
+	c.remoteAddr.Store(c.rwc.RemoteAddr().String())
+
+	if admission := c.server.Admission; admission != nil {
+		release, reason := admission.admit(c.rwc.RemoteAddr())
+		if reason != RejectNone {
+			c.reject(ctx, properties, reason)
+			return
+		}
+		defer release()
+	}
 
 	for {
 		w, req, err := c.readRequest(ctx, properties)
@@ -94,8 +294,12 @@ func (c *conn) serve(ctx context.Context) {
 		c.setState(StateActive)
 
 		if err != nil {
+			if c.draining.Load() {
+				c.disconnect(properties)
+				return
+			}
 			if rp, ok := err.(mqttproto.ResponsePacket); ok {
-				_ = rp.Response().Write(c.rwc)
+				c.writeErrorResponse(rp)
 			}
 			_ = c.rwc.Close()
 			if err != io.EOF && err != io.ErrUnexpectedEOF {
@@ -107,14 +311,21 @@ func (c *conn) serve(ctx context.Context) {
 
 		c.setState(StateIdle)
 
-		if !w.conn.server.doKeepAlives() {
-			// we're in shutdown mode
+		// a slow publisher holds back the client, the next packet is not read while the receive maximum is reached
+		c.waitReceiveWindow(properties)
+
+		if c.draining.Load() {
+			// the server is shutting down
+			c.disconnect(properties)
 			return
 		}
 		if d := w.Properties().IdleTimeout(); d != 0 {
 			_ = c.rwc.SetReadDeadline(time.Now().Add(d))
 			// 2 bytes = mqtt fixed header + length
-			if _, err := c.bufr.Peek(2); err != nil {
+			if _, err := c.bufr.Peek(2); err != nil || c.draining.Load() {
+				if c.draining.Load() {
+					c.disconnect(properties)
+				}
 				return
 			}
 		}
@@ -0,0 +1,126 @@
+package mqttserver
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"go.uber.org/atomic"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+// ConnInfo is a snapshot of a live connection.
+type ConnInfo struct {
+	ID              uint64    `json:"id"`
+	Listener        string    `json:"listener,omitempty"`
+	State           string    `json:"state"`
+	ClientID        string    `json:"client_id"`
+	Username        string    `json:"username"`
+	RemoteAddr      string    `json:"remote_addr"`
+	ProtocolVersion string    `json:"protocol_version"`
+	TLSPeerSubject  string    `json:"tls_peer_subject,omitempty"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	LastActivity    time.Time `json:"last_activity"`
+	PacketsIn       int64     `json:"packets_in"`
+	PacketsOut      int64     `json:"packets_out"`
+	BytesIn         int64     `json:"bytes_in"`
+	BytesOut        int64     `json:"bytes_out"`
+	Inflight        int       `json:"inflight"`
+}
+
+// connStats counts the traffic of a connection.
+type connStats struct {
+	lastActivity atomic.Int64 // unix nanoseconds of the last read or write
+	packetsIn    atomic.Int64
+	packetsOut   atomic.Int64
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+}
+
+func (s *connStats) received(packets int, bytes int) {
+	s.packetsIn.Add(int64(packets))
+	s.bytesIn.Add(int64(bytes))
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *connStats) sent(bytes int) {
+	s.packetsOut.Inc()
+	s.bytesOut.Add(int64(bytes))
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// countingReader counts the bytes received from the client.
+type countingReader struct {
+	r     io.Reader
+	stats *connStats
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.stats.received(0, n)
+	}
+	return n, err
+}
+
+// info provides the snapshot of the connection, the caller holds the server mutex.
+func (c *conn) info() ConnInfo {
+	state, _ := c.getState()
+	info := ConnInfo{
+		ID:              c.id,
+		Listener:        c.listener,
+		State:           state.String(),
+		ClientID:        c.properties.ClientIdentifier(),
+		Username:        c.properties.Username(),
+		RemoteAddr:      c.remoteAddr.Load(),
+		ProtocolVersion: mqttproto.MqttProtocolVersionName(c.properties.ProtocolVersion()),
+		TLSPeerSubject:  c.tlsPeerSubject.Load(),
+		ConnectedAt:     c.created,
+		PacketsIn:       c.stats.packetsIn.Load(),
+		PacketsOut:      c.stats.packetsOut.Load(),
+		BytesIn:         c.stats.bytesIn.Load(),
+		BytesOut:        c.stats.bytesOut.Load(),
+		Inflight:        c.properties.Inflight(),
+	}
+	if lastActivity := c.stats.lastActivity.Load(); lastActivity != 0 {
+		info.LastActivity = time.Unix(0, lastActivity)
+	} else {
+		info.LastActivity = c.created
+	}
+	return info
+}
+
+// Connections provides the snapshots of the active connections ordered by ID.
+func (srv *Server) Connections() []ConnInfo {
+	srv.mu.Lock()
+	infos := make([]ConnInfo, 0, len(srv.activeConn))
+	for c := range srv.activeConn {
+		infos = append(infos, c.info())
+	}
+	srv.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Disconnect closes the active connections matching the filter and returns the number of closed connections.
+// MQTT 5 clients receive DISCONNECT "Administrative action" before the connection is closed.
+func (srv *Server) Disconnect(match func(ConnInfo) bool) int {
+	srv.mu.Lock()
+	var conns []*conn
+	for c := range srv.activeConn {
+		if match(c.info()) {
+			conns = append(conns, c)
+		}
+	}
+	srv.mu.Unlock()
+
+	for _, c := range conns {
+		c.kick(mqtt5.AdministrativeAction)
+	}
+	return len(conns)
+}
@@ -12,6 +12,11 @@ type Handler interface {
 	ServeMQTT(Conn, mqttproto.ControlPacket)
 }
 
+// CloseHandler is implemented by the handlers which are notified when a connection is closed.
+type CloseHandler interface {
+	ServeClose(Conn)
+}
+
 type HandlerFunc func(Conn, mqttproto.ControlPacket)
 
 func (f HandlerFunc) ServeMQTT(c Conn, req mqttproto.ControlPacket) {
@@ -30,6 +35,12 @@ func (sh serverHandler) ServeMQTT(w Conn, req mqttproto.ControlPacket) {
 	handler.ServeMQTT(w, req)
 }
 
+func (sh serverHandler) ServeClose(w Conn) {
+	if handler, ok := sh.srv.Handler.(CloseHandler); ok {
+		handler.ServeClose(w)
+	}
+}
+
 type muxEntry struct {
 	h           Handler
 	messageType byte
@@ -0,0 +1,170 @@
+package mqttserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// address schemes handled by ListenConfig.Listen
+const (
+	UnixScheme    = "unix://"
+	SystemdScheme = "systemd://"
+)
+
+// systemd socket activation, see sd_listen_fds(3)
+const (
+	listenFdsStart = 3
+)
+
+var (
+	activation     *socketActivation
+	activationOnce sync.Once
+)
+
+// ListenConfig contains options for listening to an address.
+type ListenConfig struct {
+	UnixSocketMode os.FileMode // permissions of created unix domain sockets, the umask applies if 0
+}
+
+// Listen announces on the local network address. Besides the addresses accepted by net.Listen, the address can be
+//   - unix:///path/to/socket - a unix domain socket, a stale socket file left by a previous process is removed
+//   - systemd://name - a socket passed by systemd socket activation, selected by its FileDescriptorName= or
+//     by its index. An empty name selects the first socket which has not been taken yet.
+func (lc *ListenConfig) Listen(network string, address string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, SystemdScheme):
+		return activatedListener(strings.TrimPrefix(address, SystemdScheme))
+	case strings.HasPrefix(address, UnixScheme):
+		return lc.listenUnix(strings.TrimPrefix(address, UnixScheme))
+	case network == "unix":
+		return lc.listenUnix(address)
+	}
+	if network == "" {
+		network = "tcp"
+	}
+	return net.Listen(network, address)
+}
+
+func (lc *ListenConfig) listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("mqtt: unix socket path is required")
+	}
+	// the names of Linux abstract sockets start with @, they do not exist in the file system
+	abstract := strings.HasPrefix(path, "@")
+	if !abstract {
+		removeStaleSocket(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if lc.UnixSocketMode != 0 && !abstract {
+		if err = os.Chmod(path, lc.UnixSocketMode); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket file when no process accepts connections on it.
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
+
+// socketActivation holds the sockets passed by systemd, each of them can be taken once.
+type socketActivation struct {
+	mu    sync.Mutex
+	names []string
+	files []*os.File
+	err   error
+}
+
+// activatedListener returns the socket passed by systemd by its name or index.
+func activatedListener(name string) (net.Listener, error) {
+	activationOnce.Do(func() {
+		activation = newSocketActivation(listenFdsStart)
+		// the sockets must not be passed to child processes
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	})
+	return activation.listener(name)
+}
+
+// newSocketActivation reads the sockets passed in the environment, the first one has the descriptor start.
+func newSocketActivation(start int) *socketActivation {
+	sa := &socketActivation{}
+	if pid := os.Getenv("LISTEN_PID"); pid != strconv.Itoa(os.Getpid()) {
+		sa.err = errors.New("mqtt: no sockets passed by systemd socket activation")
+		return sa
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		sa.err = errors.New("mqtt: no sockets passed by systemd socket activation")
+		return sa
+	}
+	var names []string
+	if s := os.Getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(start+i)
+		if i < len(names) {
+			name = names[i]
+		}
+		sa.names = append(sa.names, name)
+		sa.files = append(sa.files, os.NewFile(uintptr(start+i), name))
+	}
+	return sa
+}
+
+func (sa *socketActivation) listener(name string) (net.Listener, error) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if sa.err != nil {
+		return nil, sa.err
+	}
+	index := -1
+	for i := range sa.files {
+		if name == "" && sa.files[i] != nil || name != "" && sa.names[i] == name {
+			index = i
+			break
+		}
+	}
+	if index == -1 && name != "" {
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(sa.files) {
+			index = i
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("mqtt: systemd socket %s not found", name)
+	}
+	f := sa.files[index]
+	if f == nil {
+		return nil, fmt.Errorf("mqtt: systemd socket %s already in use", sa.names[index])
+	}
+	// FileListener duplicates the descriptor, the original one is closed
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: systemd socket %s: %w", sa.names[index], err)
+	}
+	_ = f.Close()
+	sa.files[index] = nil
+	return l, nil
+}
@@ -0,0 +1,98 @@
+package mqttserver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUnix(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "mqtt.sock")
+
+	lc := &ListenConfig{UnixSocketMode: 0600}
+	l, err := lc.Listen("tcp", UnixScheme+path)
+	require.NoError(t, err)
+	a.Equal("unix", l.Addr().Network())
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	a.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	// a socket in use is not removed
+	_, err = lc.Listen("unix", path)
+	a.Error(err)
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	_ = conn.Close()
+	require.NoError(t, l.Close())
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt.sock")
+
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	// simulate a crashed process, the socket file is left behind
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	l, err = (&ListenConfig{}).Listen("unix", path)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+}
+
+func TestSocketActivation(t *testing.T) {
+	a := assert.New(t)
+
+	// raw descriptors not owned by an os.File, the socket activation takes the ownership
+	var fds []int
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(t, err)
+		fd, err := syscall.Dup(int(f.Fd()))
+		require.NoError(t, err)
+		_ = f.Close()
+		_ = l.Close()
+		fds = append(fds, fd)
+	}
+	if fds[1] != fds[0]+1 {
+		t.Skip("descriptors are not consecutive")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "mqtt:metrics")
+	sa := newSocketActivation(fds[0])
+
+	l, err := sa.listener("metrics")
+	require.NoError(t, err)
+	a.Equal("tcp", l.Addr().Network())
+	_ = l.Close()
+
+	_, err = sa.listener("metrics")
+	a.EqualError(err, "mqtt: systemd socket metrics already in use")
+	_, err = sa.listener("unknown")
+	a.EqualError(err, "mqtt: systemd socket unknown not found")
+
+	l, err = sa.listener("")
+	require.NoError(t, err)
+	_ = l.Close()
+	_, err = sa.listener("0")
+	a.EqualError(err, "mqtt: systemd socket mqtt already in use")
+
+	t.Setenv("LISTEN_PID", "1")
+	_, err = newSocketActivation(fds[0]).listener("")
+	a.EqualError(err, "mqtt: no sockets passed by systemd socket activation")
+}
@@ -0,0 +1,323 @@
+package mqttserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol, see https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+
+const (
+	ProxyTLVTypeAWS = 0xEA // AWS specific TLV, the first value byte is the subtype
+
+	proxyTLVSubtypeAWSVPCEndpointID = 0x01
+
+	defaultProxyHeaderTimeout = 5 * time.Second
+	maxProxyV1HeaderLength    = 107
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errProxyHeader        = errors.New("mqtt: invalid PROXY protocol header")
+	errMissingProxyHeader = errors.New("mqtt: missing PROXY protocol header")
+)
+
+// ProxyTLV is a type-length-value vector of the PROXY protocol v2 header.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeader is the PROXY protocol header sent by a load balancer in front of the server.
+type ProxyHeader struct {
+	Version         byte     // 1 or 2
+	Local           bool     // connection established by the load balancer itself, e.g. health checks
+	SourceAddr      net.Addr // client address or nil when unknown
+	DestinationAddr net.Addr // address the client connected to or nil when unknown
+	TLVs            []ProxyTLV
+}
+
+// TLV returns the value of the first TLV of the type.
+func (h *ProxyHeader) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// AWSVPCEndpointID returns the VPC endpoint ID sent by an AWS Network Load Balancer or an empty string.
+func (h *ProxyHeader) AWSVPCEndpointID() string {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == ProxyTLVTypeAWS && len(tlv.Value) > 0 && tlv.Value[0] == proxyTLVSubtypeAWSVPCEndpointID {
+			return string(tlv.Value[1:])
+		}
+	}
+	return ""
+}
+
+// ProxyProtocolListener reads the PROXY protocol v1 or v2 header of connections accepted from trusted sources.
+// The connections from trusted sources must start with a header and are closed otherwise, the connections from
+// other sources are served as they are. It must wrap the network listener, a TLS listener is created on top of it.
+type ProxyProtocolListener struct {
+	net.Listener
+	Trusted       []*net.IPNet  // sources required to send the header, no source is trusted if empty
+	HeaderTimeout time.Duration // maximum duration for reading the header, 5 seconds if 0
+}
+
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout == 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+	return &proxyConn{Conn: c, br: bufio.NewReader(c), timeout: timeout}, nil
+}
+
+func (l *ProxyProtocolListener) trusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range l.Trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn reads the header before the first read or when the remote address is requested.
+type proxyConn struct {
+	net.Conn
+	br      *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	header *ProxyHeader
+	err    error
+
+	mu           sync.Mutex // guards readDeadline
+	readDeadline time.Time  // deadline set by the connection user
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		headerDeadline := time.Now().Add(c.timeout)
+		if !deadline.IsZero() && deadline.Before(headerDeadline) {
+			headerDeadline = deadline
+		}
+		_ = c.Conn.SetReadDeadline(headerDeadline)
+		c.header, c.err = ReadProxyHeader(c.br)
+		if c.header == nil && c.err == nil {
+			c.err = errMissingProxyHeader
+		}
+		_ = c.Conn.SetReadDeadline(deadline)
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+// RemoteAddr returns the client address sent by the load balancer.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && !c.header.Local && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// ProxyHeader returns the header or nil if the header could not be read.
+func (c *proxyConn) ProxyHeader() *ProxyHeader {
+	c.readHeader()
+	return c.header
+}
+
+// proxyHeader returns the PROXY protocol header of the connection or of the connection wrapped by it.
+func proxyHeader(conn net.Conn) *ProxyHeader {
+	for conn != nil {
+		if pc, ok := conn.(*proxyConn); ok {
+			return pc.ProxyHeader()
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		conn = wrapper.NetConn()
+	}
+	return nil
+}
+
+// ReadProxyHeader reads the PROXY protocol v1 or v2 header. It returns nil if the data does not start with a header.
+func ReadProxyHeader(br *bufio.Reader) (*ProxyHeader, error) {
+	b, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case proxyV1Signature[0]:
+		return readProxyHeaderV1(br)
+	case proxyV2Signature[0]:
+		return readProxyHeaderV2(br)
+	default:
+		return nil, nil
+	}
+}
+
+func readProxyHeaderV1(br *bufio.Reader) (*ProxyHeader, error) {
+	var line []byte
+	for len(line) < maxProxyV1HeaderLength {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasPrefix(line, proxyV1Signature) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyHeader
+	}
+	fields := strings.Split(string(line[len(proxyV1Signature):len(line)-2]), " ")
+	header := &ProxyHeader{Version: 1}
+	switch fields[0] {
+	case "UNKNOWN":
+		return header, nil
+	case "TCP4", "TCP6":
+		if len(fields) != 5 {
+			return nil, errProxyHeader
+		}
+		src, err := parseProxyV1Addr(fields[1], fields[3])
+		if err != nil {
+			return nil, err
+		}
+		dst, err := parseProxyV1Addr(fields[2], fields[4])
+		if err != nil {
+			return nil, err
+		}
+		header.SourceAddr, header.DestinationAddr = src, dst
+		return header, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported protocol %s", errProxyHeader, fields[0])
+	}
+}
+
+func parseProxyV1Addr(host string, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: invalid address %s", errProxyHeader, host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %s", errProxyHeader, port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readProxyHeaderV2(br *bufio.Reader) (*ProxyHeader, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(br, fixed[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(fixed[:12], proxyV2Signature) || fixed[12]>>4 != 2 {
+		return nil, errProxyHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	header := &ProxyHeader{Version: 2}
+	switch fixed[12] & 0x0f {
+	case 0x0:
+		header.Local = true
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", errProxyHeader, fixed[12]&0x0f)
+	}
+
+	var addrLen int
+	switch family := fixed[13] >> 4; family {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = 2*net.IPv4len + 4
+	case 0x2: // AF_INET6
+		addrLen = 2*net.IPv6len + 4
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, fmt.Errorf("%w: unsupported address family %d", errProxyHeader, family)
+	}
+	if len(payload) < addrLen {
+		return nil, errProxyHeader
+	}
+	if family := fixed[13] >> 4; !header.Local && (family == 0x1 || family == 0x2) {
+		ipLen := (addrLen - 4) / 2
+		header.SourceAddr = &net.TCPAddr{
+			IP:   net.IP(append([]byte(nil), payload[:ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+		}
+		header.DestinationAddr = &net.TCPAddr{
+			IP:   net.IP(append([]byte(nil), payload[ipLen:2*ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+		}
+	}
+	for tlvs := payload[addrLen:]; len(tlvs) > 0; {
+		if len(tlvs) < 3 {
+			return nil, errProxyHeader
+		}
+		n := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return nil, errProxyHeader
+		}
+		header.TLVs = append(header.TLVs, ProxyTLV{Type: tlvs[0], Value: tlvs[3 : 3+n]})
+		tlvs = tlvs[3+n:]
+	}
+	return header, nil
+}
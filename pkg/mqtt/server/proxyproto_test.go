@@ -0,0 +1,207 @@
+package mqttserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []byte
+		header *ProxyHeader
+		err    string
+	}{
+		{
+			name:  "v1 TCP4",
+			input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 1883\r\n"),
+			header: &ProxyHeader{
+				Version:         1,
+				SourceAddr:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+				DestinationAddr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1883},
+			},
+		},
+		{
+			name:  "v1 TCP6",
+			input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 1883\r\n"),
+			header: &ProxyHeader{
+				Version:         1,
+				SourceAddr:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+				DestinationAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1883},
+			},
+		},
+		{
+			name:   "v1 UNKNOWN",
+			input:  []byte("PROXY UNKNOWN\r\n"),
+			header: &ProxyHeader{Version: 1},
+		},
+		{
+			name:  "v1 invalid port",
+			input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 70000 1883\r\n"),
+			err:   "mqtt: invalid PROXY protocol header: invalid port 70000",
+		},
+		{
+			name:  "v1 missing CRLF",
+			input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 1883\n"),
+			err:   "mqtt: invalid PROXY protocol header",
+		},
+		{
+			// PROXY TCP4 192.0.2.1:56324 -> 198.51.100.1:1883, AWS VPC endpoint ID vpce-08d2bf15fac5001c9
+			name: "v2 TCP4 with AWS TLV",
+			input: decodeHex(t, "0d0a0d0a000d0a515549540a"+"21"+"11"+"0026"+
+				"c0000201"+"c6336401"+"dc04"+"075b"+
+				"ea0017"+"01"+hex.EncodeToString([]byte("vpce-08d2bf15fac5001c9"))),
+			header: &ProxyHeader{
+				Version:         2,
+				SourceAddr:      &net.TCPAddr{IP: net.IP{192, 0, 2, 1}, Port: 56324},
+				DestinationAddr: &net.TCPAddr{IP: net.IP{198, 51, 100, 1}, Port: 1883},
+				TLVs:            []ProxyTLV{{Type: ProxyTLVTypeAWS, Value: append([]byte{0x01}, "vpce-08d2bf15fac5001c9"...)}},
+			},
+		},
+		{
+			name:   "v2 LOCAL",
+			input:  decodeHex(t, "0d0a0d0a000d0a515549540a"+"20"+"00"+"0000"),
+			header: &ProxyHeader{Version: 2, Local: true},
+		},
+		{
+			name:  "v2 truncated TLV",
+			input: decodeHex(t, "0d0a0d0a000d0a515549540a"+"21"+"00"+"0002"+"ea00"),
+			err:   "mqtt: invalid PROXY protocol header",
+		},
+		{
+			name:  "no header",
+			input: decodeHex(t, "100c00044d5154540402003c0000"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(tc.input)))
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.header, header)
+		})
+	}
+}
+
+func TestProxyHeaderAWSVPCEndpointID(t *testing.T) {
+	header := &ProxyHeader{TLVs: []ProxyTLV{
+		{Type: 0x01, Value: []byte("h2")},
+		{Type: ProxyTLVTypeAWS, Value: append([]byte{0x01}, "vpce-1"...)},
+	}}
+	assert.Equal(t, "vpce-1", header.AWSVPCEndpointID())
+	value, ok := header.TLV(0x01)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("h2"), value)
+	assert.Equal(t, "", (&ProxyHeader{}).AWSVPCEndpointID())
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	_, other, err := net.ParseCIDR("192.0.2.0/24")
+	require.NoError(t, err)
+
+	spoofed := "PROXY TCP4 192.0.2.1 198.51.100.1 56324 1883\r\n"
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		header  string
+		remote  string
+		closed  bool
+	}{
+		{
+			name:    "trusted source",
+			trusted: []*net.IPNet{loopback},
+			header:  spoofed,
+			remote:  "192.0.2.1:56324",
+		},
+		{
+			name:    "trusted source without header",
+			trusted: []*net.IPNet{loopback},
+			closed:  true,
+		},
+		{
+			name:    "untrusted source",
+			trusted: []*net.IPNet{other},
+		},
+		{
+			name:    "untrusted source with header",
+			trusted: []*net.IPNet{other},
+			header:  spoofed,
+			closed:  true,
+		},
+		{
+			name:   "no trusted sources",
+			header: spoofed,
+			closed: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			remotes := make(chan string, 1)
+			headers := make(chan *ProxyHeader, 1)
+			srv := &Server{
+				Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+					remotes <- c.RemoteAddr().String()
+					headers <- c.Properties().ProxyHeader()
+					_ = mqtt311.NewControlPacket(mqttproto.CONNACK).Write(c)
+				}),
+			}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go func() { _ = srv.Serve(&ProxyProtocolListener{Listener: l, Trusted: tc.trusted}) }()
+			t.Cleanup(func() { _ = srv.Close() })
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			t.Cleanup(func() { _ = conn.Close() })
+
+			connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+			connect.ProtocolName = mqttproto.MQTT
+			connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+			connect.ClientIdentifier = "c1"
+			_, err = io.WriteString(conn, tc.header)
+			require.NoError(t, err)
+			require.NoError(t, connect.Write(conn))
+
+			_, err = mqtt311.ReadPacket(conn)
+			if tc.closed {
+				// the spoofed address never reaches the handler, an untrusted header is read as an invalid CONNECT
+				a.Error(err)
+				a.Empty(remotes)
+				return
+			}
+			require.NoError(t, err)
+			if tc.remote != "" {
+				a.Equal(tc.remote, <-remotes)
+				a.NotNil(<-headers)
+			} else {
+				a.Equal(conn.LocalAddr().String(), <-remotes)
+				a.Nil(<-headers)
+			}
+		})
+	}
+}
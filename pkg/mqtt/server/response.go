@@ -23,13 +23,75 @@ type Properties interface {
 	ClientIdentifier() string   // Returns the client identifier
 	SetClientIdentifier(string) // Store the client identifier
 
+	Username() string   // Returns the user name sent in the CONNECT packet
+	SetUsername(string) // Store the user name
+
+	AuthMethod() string   // Returns the MQTT 5 authentication method
+	SetAuthMethod(string) // Store the MQTT 5 authentication method
+
+	AuthSession() interface{}   // Returns the state of an ongoing enhanced authentication
+	SetAuthSession(interface{}) // Store the state of an ongoing enhanced authentication, nil when finished
+
+	Will() interface{}   // Returns the will message published when the connection is closed without DISCONNECT
+	SetWill(interface{}) // Store the will message, nil when there is none
+
+	TopicAlias(uint16) (string, bool) // Returns the topic name mapped to the MQTT 5 topic alias by the client
+	SetTopicAlias(uint16, string)     // Store the topic name of the MQTT 5 topic alias
+
+	MaxPacketSize() uint32   // Returns the maximum packet size accepted from the client, 0 means no limit
+	SetMaxPacketSize(uint32) // Store the maximum packet size accepted from the client
+
+	ServerKeepAlive() uint16   // Returns the keep alive imposed by the server, 0 if the keep alive of the client is used
+	SetServerKeepAlive(uint16) // Store the keep alive imposed by the server
+
+	ProxyHeader() *ProxyHeader   // Returns the PROXY protocol header sent by the load balancer or nil
+	SetProxyHeader(*ProxyHeader) // Store the PROXY protocol header
+
+	Inflight() int   // Returns the number of publishes not acknowledged yet, the connection is drained after them
+	AddInflight(int) // Add the delta to the number of inflight publishes
+
+	ReceiveMaximum() uint16   // Returns the maximum number of inflight QoS 1 and 2 publishes, 0 means no limit
+	SetReceiveMaximum(uint16) // Store the receive maximum
+	Receiving() int           // Returns the number of inflight QoS 1 and 2 publishes, the reading pauses at the receive maximum
+	AddReceiving(int)         // Add the delta to the number of inflight QoS 1 and 2 publishes
+
+	StorePacketID(uint16) (PacketIDState, bool) // Store the identifier of a received QoS 2 publish, returns the state and true if it is already stored
+	MarkPacketIDReceived(uint16)                // Store that PUBREC was sent for the stored identifier
+	ReleasePacketID(uint16) bool                // Remove the identifier on PUBREL, reports whether it was stored
 }
 
+// PacketIDState is the state of a QoS 2 publish received from the client.
+type PacketIDState int
+
+const (
+	PacketIDPublishing PacketIDState = iota + 1 // the message is being published
+	PacketIDReceived                            // PUBREC was sent, the message awaits PUBREL
+)
+
 type properties struct {
 	idleTimeout      atomic.Duration
 	authenticated    atomic.Bool
 	protocolVersion  atomic.Uint32
 	clientIdentifier atomic.String
+	username         atomic.String
+	authMethod       atomic.String
+	maxPacketSize    atomic.Uint32
+	serverKeepAlive  atomic.Uint32
+	inflight         atomic.Int32
+	receiveMaximum   atomic.Uint32
+
+	mu           sync.Mutex // guards authSession, proxyHeader, will and topicAliases
+	authSession  interface{}
+	proxyHeader  *ProxyHeader
+	will         interface{}
+	topicAliases map[uint16]string
+
+	packetIDsMu sync.Mutex
+	packetIDs   map[uint16]PacketIDState // QoS 2 publishes awaiting PUBREL
+
+	receivingMu   sync.Mutex
+	receiving     int
+	receivingFree chan struct{} // closed when a publish is done while the receive maximum is reached
 }
 
 func (w *properties) IdleTimeout() time.Duration {
@@ -64,21 +126,189 @@ func (w *properties) SetClientIdentifier(s string) {
 	w.clientIdentifier.Store(s)
 }
 
+func (w *properties) Username() string {
+	return w.username.Load()
+}
+
+func (w *properties) SetUsername(s string) {
+	w.username.Store(s)
+}
+
+func (w *properties) AuthMethod() string {
+	return w.authMethod.Load()
+}
+
+func (w *properties) SetAuthMethod(s string) {
+	w.authMethod.Store(s)
+}
+
+func (w *properties) ProxyHeader() *ProxyHeader {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.proxyHeader
+}
+
+func (w *properties) SetProxyHeader(h *ProxyHeader) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.proxyHeader = h
+}
+
+func (w *properties) MaxPacketSize() uint32 {
+	return w.maxPacketSize.Load()
+}
+
+func (w *properties) SetMaxPacketSize(n uint32) {
+	w.maxPacketSize.Store(n)
+}
+
+func (w *properties) ServerKeepAlive() uint16 {
+	return uint16(w.serverKeepAlive.Load())
+}
+
+func (w *properties) SetServerKeepAlive(n uint16) {
+	w.serverKeepAlive.Store(uint32(n))
+}
+
+func (w *properties) Inflight() int {
+	return int(w.inflight.Load())
+}
+
+func (w *properties) AddInflight(delta int) {
+	w.inflight.Add(int32(delta))
+}
+
+func (w *properties) ReceiveMaximum() uint16 {
+	return uint16(w.receiveMaximum.Load())
+}
+
+func (w *properties) SetReceiveMaximum(n uint16) {
+	w.receiveMaximum.Store(uint32(n))
+}
+
+func (w *properties) Receiving() int {
+	w.receivingMu.Lock()
+	defer w.receivingMu.Unlock()
+	return w.receiving
+}
+
+func (w *properties) AddReceiving(delta int) {
+	w.receivingMu.Lock()
+	defer w.receivingMu.Unlock()
+	w.receiving += delta
+	if w.receivingFree != nil && !w.receiveWindowFull() {
+		close(w.receivingFree)
+		w.receivingFree = nil
+	}
+}
+
+// receiveWindow returns a channel closed when the receive maximum is not reached anymore or nil if it is not reached.
+func (w *properties) receiveWindow() <-chan struct{} {
+	w.receivingMu.Lock()
+	defer w.receivingMu.Unlock()
+	if !w.receiveWindowFull() {
+		return nil
+	}
+	if w.receivingFree == nil {
+		w.receivingFree = make(chan struct{})
+	}
+	return w.receivingFree
+}
+
+func (w *properties) receiveWindowFull() bool {
+	receiveMaximum := w.ReceiveMaximum()
+	return receiveMaximum > 0 && w.receiving >= int(receiveMaximum)
+}
+
+func (w *properties) StorePacketID(id uint16) (PacketIDState, bool) {
+	w.packetIDsMu.Lock()
+	defer w.packetIDsMu.Unlock()
+	if state, ok := w.packetIDs[id]; ok {
+		return state, true
+	}
+	if w.packetIDs == nil {
+		w.packetIDs = make(map[uint16]PacketIDState)
+	}
+	w.packetIDs[id] = PacketIDPublishing
+	return PacketIDPublishing, false
+}
+
+func (w *properties) MarkPacketIDReceived(id uint16) {
+	w.packetIDsMu.Lock()
+	defer w.packetIDsMu.Unlock()
+	if _, ok := w.packetIDs[id]; ok {
+		w.packetIDs[id] = PacketIDReceived
+	}
+}
+
+func (w *properties) ReleasePacketID(id uint16) bool {
+	w.packetIDsMu.Lock()
+	defer w.packetIDsMu.Unlock()
+	_, ok := w.packetIDs[id]
+	delete(w.packetIDs, id)
+	return ok
+}
+
+func (w *properties) AuthSession() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.authSession
+}
+
+func (w *properties) SetAuthSession(v interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.authSession = v
+}
+
+func (w *properties) Will() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.will
+}
+
+func (w *properties) SetWill(v interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.will = v
+}
+
+func (w *properties) TopicAlias(alias uint16) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	topicName, ok := w.topicAliases[alias]
+	return topicName, ok
+}
+
+func (w *properties) SetTopicAlias(alias uint16, topicName string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.topicAliases == nil {
+		w.topicAliases = make(map[uint16]string)
+	}
+	w.topicAliases[alias] = topicName
+}
+
 // Conn interface is used by a handler to send mqtt messages.
 type Conn interface {
 	io.WriteCloser
 	LocalAddr() net.Addr       // Returns the local IP
 	RemoteAddr() net.Addr      // Returns the remote IP
 	TLS() *tls.ConnectionState // TLS or nil when not using TLS
-	Context() context.Context  // Returns the internal context
+	Context() context.Context  // Returns the internal context, done when the connection is closed or drained
 	Connection() net.Conn      // Returns network connection
 	Properties() Properties    // Data set by handler during connection duration
+
+	// ClaimClientID registers the connection with the client identifier when the CONNECT is accepted.
+	// It reports false if the connection must be rejected as the identifier is in use.
+	ClaimClientID(clientID string) bool
+	// ClientIDTakenOver reports whether the client identifier of the connection is registered to another connection.
+	ClientIDTakenOver() bool
 }
 
 // A response represents the server side of a mqtt response.
 // It implements the Conn and CloseNotifier interfaces.
 type response struct {
-	mu         sync.Mutex      // guards conn and Write
 	conn       *conn           // socket, reader and writer
 	ctx        context.Context // context for this Conn
 	properties Properties      // properties for this Conn
@@ -86,24 +316,12 @@ type response struct {
 
 // Write writes the message m to the connection.
 func (w *response) Write(b []byte) (int, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	if w.conn.server.WriteTimeout > 0 {
-		_ = w.conn.rwc.SetWriteDeadline(time.Now().Add(w.conn.server.WriteTimeout))
-	}
-	n, err := w.conn.bufw.Write(b)
-	if err != nil {
-		return 0, err
-	}
-	if err = w.conn.bufw.Flush(); err != nil {
-		return 0, err
-	}
-	return n, nil
+	return w.conn.write(b)
 }
 
 // Close closes the connection.
 func (w *response) Close() error {
-	return w.conn.rwc.Close()
+	return w.conn.close()
 }
 
 // LocalAddr returns the local address of the connection.
@@ -121,7 +339,7 @@ func (w *response) TLS() *tls.ConnectionState {
 	return w.conn.tlsState
 }
 
-// Context returns the internal context or a new context.Background.
+// Context returns the context of the connection, it is cancelled when the connection is closed or drained.
 func (w *response) Context() context.Context {
 	return w.ctx
 }
@@ -133,3 +351,11 @@ func (w *response) Connection() net.Conn {
 func (w *response) Properties() Properties {
 	return w.properties
 }
+
+func (w *response) ClaimClientID(clientID string) bool {
+	return w.conn.server.clients.claim(w.conn, clientID, w.conn.server.ClientIDPolicy)
+}
+
+func (w *response) ClientIDTakenOver() bool {
+	return w.conn.server.clients.takenOver(w.conn)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -15,26 +16,60 @@ import (
 var (
 	ErrServerClosed      = errors.New("mqtt: Server closed")
 	shutdownPollInterval = 500 * time.Millisecond
+	drainPollInterval    = 10 * time.Millisecond
+
+	// aLongTimeAgo is a read deadline interrupting the blocked reads of draining connections
+	aLongTimeAgo = time.Unix(1, 0)
 )
 
+type contextKey struct {
+	name string
+}
+
+// ListenerContextKey is a context key. It can be used in handlers with Conn.Context to access the name of the listener
+// which accepted the connection. The associated value is of type string.
+var ListenerContextKey = &contextKey{"mqtt-listener"}
+
+// ListenerName returns the name of the listener stored in the context, empty for unnamed listeners.
+func ListenerName(ctx context.Context) string {
+	name, _ := ctx.Value(ListenerContextKey).(string)
+	return name
+}
+
 // A Server defines parameters for running a mqtt server.
 type Server struct {
 	Network      string        // network of the address - empty string defaults to tcp
-	Addr         string        // address to listen on, ":1883" if empty
+	Addr         string        // address to listen on, ":1883" if empty, see ListenConfig.Listen for the supported addresses
 	Handler      Handler       // handler to invoke, DefaultServeMux if nil
 	ReadTimeout  time.Duration // maximum duration before timing out read of the request
 	WriteTimeout time.Duration // maximum duration before timing out write of the response
 	IdleTimeout  time.Duration // maximum amount of time to wait for the next request
 	TLSConfig    *tls.Config   // optional TLS config, used by ListenAndServeTLS
 
+	UnixSocketMode os.FileMode // permissions of the unix domain socket, the umask applies if 0
+
 	ReaderBufferSize int // read buffer size pro tcp connection (default 1024)
 	WriterBufferSize int // write buffer size pro tcp connection (default 1024)
 
+	MaxPacketSize       uint32          // maximum size of a packet received from a client, 0 means no limit
+	MaxPacketSizeByType map[byte]uint32 // optional maximum packet size per packet type, overrides MaxPacketSize
+	ReceiveMaximum      uint16          // maximum number of inflight QoS 1 and 2 publishes per connection, 0 means no limit
+
+	MaxPacketSizeByListener map[string]uint32 // optional maximum packet size per listener name, overrides MaxPacketSize
+
+	Strict bool // reject packets violating the MQTT specification
+
 	ErrorLog log.Logger
 
 	ConnDebug func(c net.Conn) net.Conn // optional logging wrapper for all server connections
+	Capture   Capture                   // optional recorder of the packets exchanged with clients
+	Admission *AdmissionControl         // optional limits of the accepted connections
+
+	ServerReference string // optional server sent to MQTT 5 clients disconnected on shutdown
+	ClientIDPolicy  string // resolves connections with the same client identifier, ClientIDPolicyTakeover if empty
 
 	inShutdown atomic.Bool // true when when server is in shutdown
+	closed     atomic.Bool // true when the connections were closed by Close
 
 	mu         sync.Mutex
 	listeners  map[*net.Listener]struct{}
@@ -42,9 +77,20 @@ type Server struct {
 	doneChan   chan struct{}
 
 	totalConn int64 // metric counting total number of connections
+
+	clients clientRegistry // connections by client identifier
+}
+
+func (srv *Server) Serve(l net.Listener) error {
+	return srv.serve(context.Background(), l)
+}
+
+// ServeNamed is like Serve but the connections accepted on l carry the listener name in their context.
+func (srv *Server) ServeNamed(name string, l net.Listener) error {
+	return srv.serve(context.WithValue(context.Background(), ListenerContextKey, name), l)
 }
 
-func (srv *Server) Serve(l net.Listener) (err error) {
+func (srv *Server) serve(ctx context.Context, l net.Listener) (err error) {
 	l = &onceCloseListener{Listener: l}
 	defer l.Close()
 
@@ -79,9 +125,12 @@ func (srv *Server) Serve(l net.Listener) (err error) {
 			return err
 		}
 		tempDelay = 0
+		connCtx, cancel := context.WithCancel(ctx)
 		c := srv.newConn(rw)
+		c.listener = ListenerName(ctx)
+		c.cancelCtx = cancel
 		c.setState(StateNew) // before Serve can return
-		go c.serve(context.Background())
+		go c.serve(connCtx)
 	}
 }
 
@@ -92,9 +141,11 @@ func (srv *Server) newConn(rwc net.Conn) *conn {
 		logger = log.GetInstance()
 	}
 	c := &conn{
-		server: srv,
-		rwc:    rwc,
-		logger: logger,
+		server:     srv,
+		rwc:        rwc,
+		logger:     logger,
+		created:    time.Now(),
+		properties: &properties{},
 	}
 	if connDebug := srv.ConnDebug; connDebug != nil {
 		c.rwc = connDebug(c.rwc)
@@ -118,7 +169,7 @@ func (srv *Server) ListenAndServe() (err error) {
 		addr = ":1883"
 	}
 	var conn net.Listener
-	conn, err = net.Listen(network, addr)
+	conn, err = srv.listenConfig().Listen(network, addr)
 	if err != nil {
 		return err
 	}
@@ -142,7 +193,7 @@ func (srv *Server) ListenAndServeTLS(tlsConfig *tls.Config) (err error) {
 		addr = ":8883"
 	}
 	var conn net.Listener
-	conn, err = net.Listen(network, addr)
+	conn, err = srv.listenConfig().Listen(network, addr)
 	if err != nil {
 		return err
 	}
@@ -153,6 +204,10 @@ func (srv *Server) ListenAndServeTLS(tlsConfig *tls.Config) (err error) {
 	return srv.ServeTLS(l, tlsConfig)
 }
 
+func (srv *Server) listenConfig() *ListenConfig {
+	return &ListenConfig{UnixSocketMode: srv.UnixSocketMode}
+}
+
 func (srv *Server) ServeTLS(l net.Listener, config *tls.Config) error {
 	tlsListener := tls.NewListener(l, config)
 	return srv.Serve(tlsListener)
@@ -160,18 +215,23 @@ func (srv *Server) ServeTLS(l net.Listener, config *tls.Config) error {
 
 func (srv *Server) Close() error {
 	srv.inShutdown.Store(true)
+	srv.closed.Store(true)
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
 	srv.closeDoneChanLocked()
 
 	err := srv.closeListenersLocked()
 	for c := range srv.activeConn {
-		_ = c.rwc.Close()
+		_ = c.close()
 		delete(srv.activeConn, c)
 	}
 	return err
 }
 
+// Shutdown gracefully shuts down the server. The listeners are closed and the connections are drained:
+// each connection finishes the packet being handled and waits for its inflight publishes, MQTT 5 clients receive
+// DISCONNECT "Server shutting down" before the connection is closed. The disconnects are spread over the first half
+// of the context deadline to smooth the reconnects of the clients.
 func (srv *Server) Shutdown(ctx context.Context) error {
 	srv.inShutdown.Store(true)
 
@@ -180,39 +240,55 @@ func (srv *Server) Shutdown(ctx context.Context) error {
 	srv.closeDoneChanLocked()
 	srv.mu.Unlock()
 
+	var drainPeriod time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		drainPeriod = time.Until(deadline) / 2
+	}
+	srv.drainConns(ctx, drainPeriod)
+
 	ticker := time.NewTicker(shutdownPollInterval)
 	defer ticker.Stop()
 	for {
-		if srv.closeIdleConns() && srv.numListeners() == 0 {
+		if srv.NumActiveConn() == 0 && srv.numListeners() == 0 {
 			return lnerr
 		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
+			// connections accepted while the listeners were closing
+			srv.drainConns(ctx, 0)
 		}
 	}
 }
 
-func (srv *Server) closeIdleConns() bool {
+// drainConns drains the connections which are not draining yet, spread over the period.
+func (srv *Server) drainConns(ctx context.Context, period time.Duration) {
 	srv.mu.Lock()
-	defer srv.mu.Unlock()
-	quiescent := true
+	var conns []*conn
 	for c := range srv.activeConn {
-		st, unixSec := c.getState()
-		// treat StateNew connections as if they're idle if we haven't read the first request's header in over 5 seconds.
-		if st == StateNew && unixSec < time.Now().Unix()-5 {
-			st = StateIdle
+		if c.drainScheduled.CompareAndSwap(false, true) {
+			conns = append(conns, c)
 		}
-		if st != StateIdle || unixSec == 0 {
-			// Assume unixSec == 0 means it's a very new connection, without state set yet.
-			quiescent = false
+	}
+	srv.mu.Unlock()
+
+	for i, c := range conns {
+		delay := period * time.Duration(i) / time.Duration(len(conns))
+		if delay == 0 {
+			c.drain()
 			continue
 		}
-		_ = c.rwc.Close()
-		delete(srv.activeConn, c)
+		go func(c *conn) {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+			case <-timer.C:
+				c.drain()
+			}
+		}(c)
 	}
-	return quiescent
 }
 
 func (srv *Server) closeListenersLocked() error {
@@ -287,22 +363,27 @@ func (srv *Server) trackConn(c *conn, add bool) {
 	}
 	if add {
 		srv.totalConn++
+		c.id = uint64(srv.totalConn)
 		srv.activeConn[c] = struct{}{}
 	} else {
 		delete(srv.activeConn, c)
 	}
 }
 
-func (srv *Server) doKeepAlives() bool {
-	return !srv.shuttingDown()
-}
-
 func (srv *Server) numListeners() int {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
 	return len(srv.listeners)
 }
 
+// NumRejectedConn provides number of connections rejected by the admission control
+func (srv *Server) NumRejectedConn(reason RejectReason) int64 {
+	if srv.Admission == nil {
+		return 0
+	}
+	return srv.Admission.NumRejected(reason)
+}
+
 // NumActiveConn provides number of active connections
 func (srv *Server) NumActiveConn() int {
 	srv.mu.Lock()
@@ -310,6 +391,11 @@ func (srv *Server) NumActiveConn() int {
 	return len(srv.activeConn)
 }
 
+// NumClientIDConflicts provides the number of connections using a client identifier of another connection.
+func (srv *Server) NumClientIDConflicts() int64 {
+	return srv.clients.conflicts.Load()
+}
+
 // NumTotalConn provides number of total connections
 func (srv *Server) NumTotalConn() int64 {
 	srv.mu.Lock()
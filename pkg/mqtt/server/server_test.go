@@ -0,0 +1,292 @@
+package mqttserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqtt5 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v5"
+)
+
+// newDrainTestServer acknowledges QoS 1 publishes after the delay.
+func newDrainTestServer(t *testing.T, pubackDelay time.Duration) (*Server, net.Addr) {
+	srv := &Server{
+		Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+			switch p := req.(type) {
+			case *mqtt5.ConnectPacket:
+				c.Properties().SetAuthenticated(true)
+				_ = mqtt5.NewControlPacket(mqttproto.CONNACK).Write(c)
+			case *mqtt311.ConnectPacket:
+				c.Properties().SetAuthenticated(true)
+				_ = mqtt311.NewControlPacket(mqttproto.CONNACK).Write(c)
+			case *mqtt5.PublishPacket:
+				c.Properties().AddInflight(1)
+				go func() {
+					defer c.Properties().AddInflight(-1)
+					time.Sleep(pubackDelay)
+					puback := mqtt5.NewControlPacket(mqttproto.PUBACK).(*mqtt5.PubackPacket)
+					puback.MessageID = p.MessageID
+					_ = puback.Write(c)
+				}()
+			}
+		}),
+		ServerReference: "mqtt-2.example.com:1883",
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv, l.Addr()
+}
+
+func shutdown(srv *Server, timeout time.Duration) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		errs <- srv.Shutdown(ctx)
+	}()
+	return errs
+}
+
+func TestShutdownDisconnect(t *testing.T) {
+	a := assert.New(t)
+	srv, addr := newDrainTestServer(t, 0)
+
+	conn5 := dialConnect(t, addr, mqttproto.MQTT_5)
+	_, err := mqtt5.ReadPacket(conn5)
+	require.NoError(t, err)
+	conn311 := dialConnect(t, addr, mqttproto.MQTT_3_1_1)
+	_, err = mqtt311.ReadPacket(conn311)
+	require.NoError(t, err)
+
+	errs := shutdown(srv, 5*time.Second)
+
+	packet, err := mqtt5.ReadPacket(conn5)
+	require.NoError(t, err)
+	disconnect := packet.(*mqtt5.DisconnectPacket)
+	a.Equal(mqtt5.ServerShuttingDown, disconnect.ReasonCode)
+	a.Equal("mqtt-2.example.com:1883", *disconnect.DisconnectProperties.ServerReference)
+	_, err = mqtt5.ReadPacket(conn5)
+	a.Equal(io.EOF, err)
+
+	// there is no DISCONNECT sent by the server in MQTT 3.1.1
+	_, err = mqtt311.ReadPacket(conn311)
+	a.Equal(io.EOF, err)
+
+	a.NoError(<-errs)
+	a.Equal(0, srv.NumActiveConn())
+}
+
+func TestShutdownInflight(t *testing.T) {
+	a := assert.New(t)
+	srv, addr := newDrainTestServer(t, 200*time.Millisecond)
+
+	conn := dialConnect(t, addr, mqttproto.MQTT_5)
+	_, err := mqtt5.ReadPacket(conn)
+	require.NoError(t, err)
+
+	publish := mqtt5.NewControlPacket(mqttproto.PUBLISH).(*mqtt5.PublishPacket)
+	publish.TopicName = "t"
+	publish.Qos = mqttproto.AT_LEAST_ONCE
+	publish.MessageID = 1
+	require.NoError(t, publish.Write(conn))
+	// the publish is being handled when the server shuts down
+	time.Sleep(50 * time.Millisecond)
+
+	errs := shutdown(srv, 5*time.Second)
+
+	packet, err := mqtt5.ReadPacket(conn)
+	require.NoError(t, err)
+	a.Equal(uint16(1), packet.(*mqtt5.PubackPacket).MessageID)
+	packet, err = mqtt5.ReadPacket(conn)
+	require.NoError(t, err)
+	a.Equal(mqtt5.ServerShuttingDown, packet.(*mqtt5.DisconnectPacket).ReasonCode)
+	a.NoError(<-errs)
+}
+
+func TestShutdownSpreadsDisconnects(t *testing.T) {
+	a := assert.New(t)
+	srv, addr := newDrainTestServer(t, 0)
+
+	var conns []net.Conn
+	for i := 0; i < 4; i++ {
+		conn := dialConnect(t, addr, mqttproto.MQTT_5)
+		_, err := mqtt5.ReadPacket(conn)
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+
+	start := time.Now()
+	errs := shutdown(srv, 800*time.Millisecond)
+	var last time.Duration
+	for _, conn := range conns {
+		_, err := mqtt5.ReadPacket(conn)
+		require.NoError(t, err)
+		if d := time.Since(start); d > last {
+			last = d
+		}
+	}
+	a.NoError(<-errs)
+	// the disconnects are spread over the first half of the grace period
+	a.GreaterOrEqual(last, 200*time.Millisecond)
+	a.Less(last, 800*time.Millisecond)
+}
+
+func TestConnections(t *testing.T) {
+	a := assert.New(t)
+	srv := &Server{
+		Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+			if p, ok := req.(*mqtt5.ConnectPacket); ok {
+				c.Properties().SetClientIdentifier(p.ClientIdentifier)
+				c.Properties().SetUsername(p.Username)
+				_ = mqtt5.NewControlPacket(mqttproto.CONNACK).Write(c)
+			}
+		}),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.ServeNamed("default", l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	start := time.Now()
+	conn := dialConnect(t, l.Addr(), mqttproto.MQTT_5)
+	_, err = mqtt5.ReadPacket(conn)
+	require.NoError(t, err)
+
+	var info ConnInfo
+	// the CONNACK can be received before the write returns
+	require.Eventually(t, func() bool {
+		infos := srv.Connections()
+		require.Len(t, infos, 1)
+		info = infos[0]
+		return info.PacketsOut == 1
+	}, time.Second, 10*time.Millisecond)
+	a.Equal(uint64(1), info.ID)
+	a.Equal("default", info.Listener)
+	a.Equal("c5", info.ClientID)
+	a.Equal(conn.LocalAddr().String(), info.RemoteAddr)
+	a.Equal("5", info.ProtocolVersion)
+	a.Empty(info.TLSPeerSubject)
+	a.WithinDuration(start, info.ConnectedAt, time.Second)
+	a.False(info.LastActivity.Before(info.ConnectedAt))
+	a.Equal(int64(1), info.PacketsIn)
+	a.Greater(info.BytesIn, int64(0))
+	a.Greater(info.BytesOut, int64(0))
+	a.Equal(0, info.Inflight)
+}
+
+func TestConnectionsProtocolVersion(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+			switch req.(type) {
+			case *mqtt311.ConnectPacket:
+				_ = mqtt311.NewControlPacket(mqttproto.CONNACK).Write(c)
+			case *mqtt311.PingreqPacket:
+				_ = mqtt311.NewControlPacket(mqttproto.PINGRESP).Write(c)
+			}
+		}),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn := dialConnect(t, l.Addr(), mqttproto.MQTT_3_1)
+	_, err = mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+	require.NoError(t, mqtt311.NewControlPacket(mqttproto.PINGREQ).Write(conn))
+	_, err = mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+
+	// the PINGREQ does not change the protocol version of the connection
+	infos := srv.Connections()
+	require.Len(t, infos, 1)
+	assert.Equal(t, int64(2), infos[0].PacketsIn)
+	assert.Equal(t, "3.1", infos[0].ProtocolVersion)
+}
+
+func TestDisconnect(t *testing.T) {
+	a := assert.New(t)
+	srv, addr := newDrainTestServer(t, 0)
+
+	conn5 := dialConnect(t, addr, mqttproto.MQTT_5)
+	_, err := mqtt5.ReadPacket(conn5)
+	require.NoError(t, err)
+	conn311 := dialConnect(t, addr, mqttproto.MQTT_3_1_1)
+	_, err = mqtt311.ReadPacket(conn311)
+	require.NoError(t, err)
+
+	a.Equal(0, srv.Disconnect(func(info ConnInfo) bool { return info.ClientID == "none" }))
+	a.Equal(2, srv.Disconnect(func(info ConnInfo) bool { return true }))
+
+	packet, err := mqtt5.ReadPacket(conn5)
+	require.NoError(t, err)
+	a.Equal(mqtt5.AdministrativeAction, packet.(*mqtt5.DisconnectPacket).ReasonCode)
+	_, err = mqtt5.ReadPacket(conn5)
+	a.Equal(io.EOF, err)
+	_, err = mqtt311.ReadPacket(conn311)
+	a.Equal(io.EOF, err)
+}
+
+func TestReceiveMaximum(t *testing.T) {
+	a := assert.New(t)
+	handled := make(chan uint16, 10)
+	done := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(c Conn, req mqttproto.ControlPacket) {
+			switch p := req.(type) {
+			case *mqtt311.ConnectPacket:
+				c.Properties().SetAuthenticated(true)
+				_ = mqtt311.NewControlPacket(mqttproto.CONNACK).Write(c)
+			case *mqtt311.PublishPacket:
+				handled <- p.MessageID
+				c.Properties().AddReceiving(1)
+				go func() {
+					<-done
+					c.Properties().AddReceiving(-1)
+				}()
+			}
+		}),
+		ReceiveMaximum: 2,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn := dialConnect(t, l.Addr(), mqttproto.MQTT_3_1_1)
+	_, err = mqtt311.ReadPacket(conn)
+	require.NoError(t, err)
+	for id := uint16(1); id <= 3; id++ {
+		publish := mqtt311.NewControlPacket(mqttproto.PUBLISH).(*mqtt311.PublishPacket)
+		publish.TopicName = "t"
+		publish.Qos = mqttproto.AT_LEAST_ONCE
+		publish.MessageID = id
+		require.NoError(t, publish.Write(conn))
+	}
+	a.Equal(uint16(1), <-handled)
+	a.Equal(uint16(2), <-handled)
+
+	// the third publish is read when an inflight publish is done
+	select {
+	case id := <-handled:
+		t.Fatalf("publish %d read while the receive maximum is reached", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+	done <- struct{}{}
+	select {
+	case id := <-handled:
+		a.Equal(uint16(3), id)
+	case <-time.After(time.Second):
+		t.Fatal("publish not read after an inflight publish was done")
+	}
+	close(done)
+}
@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// frame opcodes, see RFC 6455 section 5.2
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// close status codes, see RFC 6455 section 7.4.1
+const (
+	closeNormal          = 1000
+	closeProtocolError   = 1002
+	closeUnsupportedData = 1003
+)
+
+const (
+	maxControlPayloadSize = 125
+	closeTimeout          = time.Second
+)
+
+var errClosed = errors.New("websocket: connection closed")
+
+// Conn is a server side WebSocket connection exposing the payload of the binary messages as a byte stream.
+// MQTT packets may span several messages and a message may contain several packets.
+type Conn struct {
+	net.Conn
+	br       *bufio.Reader
+	tlsState *tls.ConnectionState
+
+	// read state, Read must not be called concurrently
+	remaining  uint64  // unread payload bytes of the current frame
+	mask       [4]byte // masking key of the current frame
+	maskPos    int
+	fragmented bool // a binary message is in progress
+	readErr    error
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+func newConn(netConn net.Conn, br *bufio.Reader, tlsState *tls.ConnectionState) *Conn {
+	return &Conn{
+		Conn:     netConn,
+		br:       br,
+		tlsState: tlsState,
+	}
+}
+
+// TLS returns the state of the secure WebSocket connection or nil.
+func (c *Conn) TLS() *tls.ConnectionState {
+	return c.tlsState
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			c.readErr = err
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// nextFrame reads the frame header and handles the control frames.
+func (c *Conn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return c.fail(closeProtocolError, errors.New("websocket: reserved bits set"))
+	}
+	if header[1]&0x80 == 0 {
+		return c.fail(closeProtocolError, errors.New("websocket: client frame is not masked"))
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	if _, err := io.ReadFull(c.br, c.mask[:]); err != nil {
+		return err
+	}
+	c.maskPos = 0
+
+	switch opcode {
+	case opBinary, opContinuation:
+		if (opcode == opBinary) == c.fragmented {
+			return c.fail(closeProtocolError, errors.New("websocket: unexpected continuation frame"))
+		}
+		c.fragmented = !fin
+		c.remaining = length
+		return nil
+	case opText:
+		return c.fail(closeUnsupportedData, errors.New("websocket: text messages are not supported"))
+	case opClose, opPing, opPong:
+		if !fin || length > maxControlPayloadSize {
+			return c.fail(closeProtocolError, errors.New("websocket: invalid control frame"))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= c.mask[i&3]
+		}
+		switch opcode {
+		case opPing:
+			return c.writeFrame(opPong, payload)
+		case opClose:
+			code := uint16(closeNormal)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			_ = c.writeClose(code)
+			return io.EOF
+		}
+		return nil
+	default:
+		return c.fail(closeProtocolError, fmt.Errorf("websocket: unknown opcode %d", opcode))
+	}
+}
+
+// Write sends p as a single binary message.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends the close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	// an unresponsive client must not block the close
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	_ = c.writeClose(closeNormal)
+	return c.Conn.Close()
+}
+
+func (c *Conn) fail(code uint16, err error) error {
+	_ = c.writeClose(code)
+	return err
+}
+
+func (c *Conn) writeClose(code uint16) error {
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], code)
+	return c.writeFrame(opClose, payload[:])
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+	header := make([]byte, 2, 10)
+	// server frames are never masked nor fragmented
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	buffers := net.Buffers{header, payload}
+	_, err := buffers.WriteTo(c.Conn)
+	return err
+}
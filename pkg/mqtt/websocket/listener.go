@@ -0,0 +1,231 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+)
+
+// websocketGUID is the magic value of the Sec-WebSocket-Accept computation, see RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// subprotocols accepted by the listener in the order of preference, mqttv3.1 is still offered by MQTT 3.1 clients
+var subprotocols = []string{"mqtt", "mqttv3.1"}
+
+// Listener accepts MQTT over WebSocket connections.
+// The HTTP upgrade is handled by the listener, the accepted connections carry the MQTT packets of the binary messages.
+type Listener struct {
+	l     net.Listener
+	srv   *http.Server
+	conns chan net.Conn
+
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+
+	opts options
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener serves the WebSocket upgrade requests received on l.
+// A secure WebSocket listener is created by passing a TLS listener.
+func NewListener(l net.Listener, opts ...Option) *Listener {
+	options := options{
+		path:             DefaultPath,
+		handshakeTimeout: defaultHandshakeTimeout,
+		errorLog:         log.GetInstance(),
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	if options.path == "" {
+		options.path = DefaultPath
+	}
+	wl := &Listener{
+		l:     l,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		opts:  options,
+	}
+	// the connections are not admitted by the MQTT server before the upgrade, the HTTP requests must not keep them open
+	wl.srv = &http.Server{
+		Handler:           wl,
+		ReadHeaderTimeout: options.handshakeTimeout,
+		ReadTimeout:       options.handshakeTimeout,
+		IdleTimeout:       options.handshakeTimeout,
+		ErrorLog:          stdlog.New(errorLogWriter{logger: options.errorLog}, "", 0),
+	}
+	go wl.serve()
+	return wl
+}
+
+func (l *Listener) serve() {
+	l.closeWithError(l.srv.Serve(l.l))
+}
+
+// Accept waits for and returns the next upgraded connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close stops the listener, the connections already accepted are not closed.
+func (l *Listener) Close() error {
+	l.closeWithError(net.ErrClosed)
+	return l.srv.Close()
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+func (l *Listener) closeWithError(err error) {
+	l.doneOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the connection is closed after a response other than the upgrade
+	w.Header().Set("Connection", "close")
+	if r.URL.Path != l.opts.path {
+		http.NotFound(w, r)
+		return
+	}
+	conn := l.upgrade(w, r)
+	if conn == nil {
+		return
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// upgrade completes the WebSocket opening handshake or replies with an HTTP error and returns nil.
+func (l *Listener) upgrade(w http.ResponseWriter, r *http.Request) *Conn {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket: method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket: upgrade required", http.StatusBadRequest)
+		return nil
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return nil
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "websocket: missing key", http.StatusBadRequest)
+		return nil
+	}
+	if !l.checkOrigin(r) {
+		http.Error(w, "websocket: origin not allowed", http.StatusForbidden)
+		return nil
+	}
+	subprotocol := selectSubprotocol(r.Header)
+	if subprotocol == "" {
+		http.Error(w, "websocket: mqtt subprotocol required", http.StatusBadRequest)
+		return nil
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: hijacking not supported", http.StatusInternalServerError)
+		return nil
+	}
+	netConn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil
+	}
+	// the handshake deadline set by the HTTP server must not apply to the MQTT connection
+	_ = netConn.SetDeadline(time.Now().Add(l.opts.handshakeTimeout))
+
+	_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	_, _ = brw.WriteString(acceptKey(key))
+	_, _ = brw.WriteString("\r\nSec-WebSocket-Protocol: ")
+	_, _ = brw.WriteString(subprotocol)
+	_, _ = brw.WriteString("\r\n\r\n")
+	if err = brw.Flush(); err != nil {
+		_ = netConn.Close()
+		return nil
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	return newConn(netConn, brw.Reader, r.TLS)
+}
+
+func (l *Listener) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// only browsers send the origin, other clients are not restricted
+		return true
+	}
+	if len(l.opts.allowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range l.opts.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(header http.Header) string {
+	for _, subprotocol := range subprotocols {
+		if headerContainsToken(header, "Sec-WebSocket-Protocol", subprotocol) {
+			return subprotocol
+		}
+	}
+	return ""
+}
+
+// headerContainsToken reports whether the comma separated header values contain the token, case-insensitive.
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, s := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// errorLogWriter passes the messages of the HTTP server error log to the logger.
+type errorLogWriter struct {
+	logger log.Logger
+}
+
+func (w errorLogWriter) Write(p []byte) (int, error) {
+	w.logger.Print(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
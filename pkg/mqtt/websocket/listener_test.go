@@ -0,0 +1,315 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
+	mqtt311 "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/v311"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func newTestListener(t *testing.T, opts ...Option) *Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	wl := NewListener(l, opts...)
+	t.Cleanup(func() { _ = wl.Close() })
+	return wl
+}
+
+func dialTestClient(t *testing.T, addr net.Addr, path string, header http.Header) (*testClient, *http.Response) {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { _ = conn.Close() })
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr.String()+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", testKey)
+	req.Header.Set("Sec-WebSocket-Protocol", "mqtt")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	require.NoError(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	require.NoError(t, err)
+	return &testClient{conn: conn, br: br}, resp
+}
+
+func (c *testClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte) {
+	mask := [4]byte{1, 2, 3, 4}
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i&3])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frames must not be masked")
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var b [2]byte
+		_, err = io.ReadFull(c.br, b[:])
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(b[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0f, payload
+}
+
+func acceptTestConn(t *testing.T, l net.Listener) net.Conn {
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestUpgrade(t *testing.T) {
+	l := newTestListener(t, WithAllowedOrigins([]string{"https://dashboard.example.com"}))
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{
+			name:   "success",
+			path:   "/mqtt",
+			status: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "allowed origin",
+			path:   "/mqtt",
+			header: http.Header{"Origin": {"https://dashboard.example.com"}},
+			status: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "legacy subprotocol",
+			path:   "/mqtt",
+			header: http.Header{"Sec-Websocket-Protocol": {"mqttv3.1"}},
+			status: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "unknown path",
+			path:   "/ws",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "origin not allowed",
+			path:   "/mqtt",
+			header: http.Header{"Origin": {"https://evil.example.com"}},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unsupported subprotocol",
+			path:   "/mqtt",
+			header: http.Header{"Sec-Websocket-Protocol": {"chat"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unsupported version",
+			path:   "/mqtt",
+			header: http.Header{"Sec-Websocket-Version": {"8"}},
+			status: http.StatusUpgradeRequired,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			_, resp := dialTestClient(t, l.Addr(), tc.path, tc.header)
+			require.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == http.StatusSwitchingProtocols {
+				a.Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+				a.NotEmpty(resp.Header.Get("Sec-WebSocket-Protocol"))
+				acceptTestConn(t, l)
+			}
+		})
+	}
+}
+
+func TestIdleConnectionClosed(t *testing.T) {
+	l := newTestListener(t, WithHandshakeTimeout(500*time.Millisecond))
+
+	t.Run("non-upgrade request", func(t *testing.T) {
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		req, err := http.NewRequest(http.MethodGet, "http://"+l.Addr().String()+"/", nil)
+		require.NoError(t, err)
+		require.NoError(t, req.Write(conn))
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.True(t, resp.Close)
+
+		// the keep-alive connection is not held open
+		_, err = br.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("no request", func(t *testing.T) {
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		start := time.Now()
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		host    string
+		ok      bool
+	}{
+		{name: "no origin", ok: true},
+		{name: "same host", origin: "http://localhost:8083", host: "localhost:8083", ok: true},
+		{name: "cross origin", origin: "http://example.com", host: "localhost:8083", ok: false},
+		{name: "any origin", allowed: []string{"*"}, origin: "http://example.com", host: "localhost:8083", ok: true},
+		{name: "listed origin", allowed: []string{"http://example.com"}, origin: "http://example.com", ok: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &Listener{opts: options{allowedOrigins: tc.allowed}}
+			req := &http.Request{Host: tc.host, Header: http.Header{}}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			require.Equal(t, tc.ok, l.checkOrigin(req))
+		})
+	}
+}
+
+func TestConnReadWrite(t *testing.T) {
+	a := assert.New(t)
+	l := newTestListener(t)
+	client, resp := dialTestClient(t, l.Addr(), DefaultPath, nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	conn := acceptTestConn(t, l)
+
+	// a fragmented message with a ping in between
+	client.writeFrame(t, false, opBinary, []byte("hello "))
+	client.writeFrame(t, true, opPing, []byte("ping"))
+	client.writeFrame(t, true, opContinuation, bytes.Repeat([]byte("w"), 200))
+
+	data := make([]byte, 206)
+	_, err := io.ReadFull(conn, data)
+	require.NoError(t, err)
+	a.Equal("hello "+string(bytes.Repeat([]byte("w"), 200)), string(data))
+
+	opcode, payload := client.readFrame(t)
+	a.Equal(byte(opPong), opcode)
+	a.Equal("ping", string(payload))
+
+	_, err = conn.Write([]byte("world"))
+	require.NoError(t, err)
+	opcode, payload = client.readFrame(t)
+	a.Equal(byte(opBinary), opcode)
+	a.Equal("world", string(payload))
+
+	client.writeFrame(t, true, opText, []byte("text"))
+	_, err = conn.Read(data)
+	a.Error(err)
+	opcode, payload = client.readFrame(t)
+	a.Equal(byte(opClose), opcode)
+	a.Equal(uint16(closeUnsupportedData), binary.BigEndian.Uint16(payload))
+}
+
+func TestConnClose(t *testing.T) {
+	a := assert.New(t)
+	l := newTestListener(t)
+	client, _ := dialTestClient(t, l.Addr(), DefaultPath, nil)
+	conn := acceptTestConn(t, l)
+
+	client.writeFrame(t, true, opClose, []byte{0x03, 0xe8})
+	_, err := conn.Read(make([]byte, 1))
+	a.Equal(io.EOF, err)
+
+	opcode, payload := client.readFrame(t)
+	a.Equal(byte(opClose), opcode)
+	a.Equal(uint16(closeNormal), binary.BigEndian.Uint16(payload))
+}
+
+func TestServeMQTT(t *testing.T) {
+	a := assert.New(t)
+	srv := &mqttserver.Server{
+		Handler: mqttserver.HandlerFunc(func(c mqttserver.Conn, req mqttproto.ControlPacket) {
+			connack := mqtt311.NewControlPacket(mqttproto.CONNACK).(*mqtt311.ConnackPacket)
+			_ = connack.Write(c)
+		}),
+	}
+	l := newTestListener(t)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	client, _ := dialTestClient(t, l.Addr(), DefaultPath, nil)
+
+	connect := mqtt311.NewControlPacket(mqttproto.CONNECT).(*mqtt311.ConnectPacket)
+	connect.ProtocolName = mqttproto.MQTT
+	connect.ProtocolLevel = mqttproto.MQTT_3_1_1
+	connect.ClientIdentifier = "c1"
+	var buf bytes.Buffer
+	require.NoError(t, connect.Write(&buf))
+	// the packet spans two messages
+	encoded := buf.Bytes()
+	client.writeFrame(t, true, opBinary, encoded[:3])
+	client.writeFrame(t, true, opBinary, encoded[3:])
+
+	opcode, payload := client.readFrame(t)
+	a.Equal(byte(opBinary), opcode)
+	packet, err := mqtt311.ReadPacket(bytes.NewReader(payload))
+	require.NoError(t, err)
+	a.Equal(mqttproto.CONNACK, packet.Type())
+}
@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+)
+
+const (
+	DefaultPath             = "/mqtt"
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+type options struct {
+	path             string
+	allowedOrigins   []string
+	handshakeTimeout time.Duration
+	errorLog         log.Logger
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithPath sets the HTTP path of the endpoint, DefaultPath if empty.
+func WithPath(s string) Option {
+	return optionFunc(func(o *options) {
+		o.path = s
+	})
+}
+
+// WithAllowedOrigins sets the origins allowed to connect, "*" allows any origin.
+// If empty, only the Origin matching the Host is accepted. Requests without Origin header are always accepted.
+func WithAllowedOrigins(origins []string) Option {
+	return optionFunc(func(o *options) {
+		o.allowedOrigins = origins
+	})
+}
+
+// WithHandshakeTimeout sets the maximum duration for reading the upgrade request.
+// The connections are closed when no request is received within the duration.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.handshakeTimeout = d
+	})
+}
+
+// WithErrorLog sets the logger of the errors of the HTTP server, e.g. the failed TLS handshakes.
+func WithErrorLog(logger log.Logger) Option {
+	return optionFunc(func(o *options) {
+		o.errorLog = logger
+	})
+}
@@ -260,7 +260,7 @@ func (s *Publisher) getKafkaTopic(mqttTopic string) (string, error) {
 	if s.opts.defaultTopic != "" {
 		return s.opts.defaultTopic, nil
 	}
-	return "", fmt.Errorf("kafka topic not found for MQTT topic %s", mqttTopic)
+	return "", fmt.Errorf("kafka topic not found for MQTT topic %s: %w", mqttTopic, apis.ErrNoRoute)
 }
 
 func (s *Publisher) Publish(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
@@ -277,13 +277,13 @@ func (s *Publisher) Publish(ctx context.Context, request *apis.PublishRequest) (
 	deliveryChan := make(chan kafka.Event, 1)
 	err = producer.Produce(msg, deliveryChan)
 	if err != nil {
-		return nil, err
+		return nil, publishError(err)
 	}
 	select {
 	case event := <-deliveryChan:
 		switch e := event.(type) {
 		case *kafka.Message:
-			return &apis.PublishResponse{ID: &e.TopicPartition, Error: e.TopicPartition.Error}, nil
+			return &apis.PublishResponse{ID: &e.TopicPartition, Error: publishError(e.TopicPartition.Error)}, nil
 		default:
 			return nil, fmt.Errorf("unexpected event type: %v: %v", reflect.TypeOf(e), e)
 		}
@@ -309,11 +309,28 @@ func (s *Publisher) PublishAsync(_ context.Context, request *apis.PublishRequest
 	}
 	err = producer.Produce(msg, nil)
 	if err != nil {
-		return err
+		return publishError(err)
 	}
 	return nil
 }
 
+// publishError wraps the kafka errors which can be reported to the MQTT 5 clients with a matching reason code.
+func publishError(err error) error {
+	var kafkaErr kafka.Error
+	if !errors.As(err, &kafkaErr) {
+		return err
+	}
+	switch kafkaErr.Code() {
+	case kafka.ErrQueueFull:
+		return fmt.Errorf("%w: %w", apis.ErrQuotaExceeded, err)
+	case kafka.ErrMsgSizeTooLarge:
+		return fmt.Errorf("%w: %w", apis.ErrMessageRejected, err)
+	case kafka.ErrUnknownTopic, kafka.ErrUnknownTopicOrPart:
+		return fmt.Errorf("%w: %w", apis.ErrNoRoute, err)
+	}
+	return err
+}
+
 func (s *Publisher) Serve() error {
 	defer s.workersDone.Close()
 
@@ -347,7 +364,7 @@ func deliveryReportEventLoop(doneChannel *runtime.DoneChannel, logger log.Logger
 			case *kafka.Message:
 				opaque, ok := ev.Opaque.(*publishCallback)
 				if ok {
-					opaque.callback(opaque.request, &apis.PublishResponse{ID: &ev.TopicPartition, Error: ev.TopicPartition.Error})
+					opaque.callback(opaque.request, &apis.PublishResponse{ID: &ev.TopicPartition, Error: publishError(ev.TopicPartition.Error)})
 				} else {
 					logger.Errorf("unexpected opaque type %v: %v", reflect.TypeOf(opaque), ev)
 				}
@@ -1,7 +1,9 @@
 package kafka
 
 import (
+	"errors"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/grepplabs/mqtt-proxy/apis"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -46,3 +48,31 @@ func TestProducerProperties(t *testing.T) {
 		})
 	}
 }
+
+func TestPublishError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input error
+		is    error
+	}{
+		{name: "queue full", input: kafka.NewError(kafka.ErrQueueFull, "queue full", false), is: apis.ErrQuotaExceeded},
+		{name: "message too large", input: kafka.NewError(kafka.ErrMsgSizeTooLarge, "too large", false), is: apis.ErrMessageRejected},
+		{name: "unknown topic", input: kafka.NewError(kafka.ErrUnknownTopicOrPart, "unknown topic", false), is: apis.ErrNoRoute},
+		{name: "other kafka error", input: kafka.NewError(kafka.ErrTransport, "broker down", false)},
+		{name: "other error", input: errors.New("failed")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			err := publishError(tc.input)
+			a.ErrorIs(err, tc.input)
+			if tc.is != nil {
+				a.ErrorIs(err, tc.is)
+			} else {
+				a.Equal(tc.input, err)
+			}
+		})
+	}
+	assert.Nil(t, publishError(nil))
+}
@@ -93,7 +93,7 @@ func (p *Publisher) findQueueName(mqttTopic string) (string, error) {
 	if p.opts.defaultQueue != "" {
 		return p.opts.defaultQueue, nil
 	}
-	return "", fmt.Errorf("rabbitmq queue not found for MQTT topic %s", mqttTopic)
+	return "", fmt.Errorf("rabbitmq queue not found for MQTT topic %s: %w", mqttTopic, apis.ErrNoRoute)
 }
 
 func (p *Publisher) sendMessage(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
@@ -75,7 +75,7 @@ func (p *Publisher) findTopicARN(mqttTopic string) (string, error) {
 	if p.opts.defaultTopicARN != "" {
 		return p.opts.defaultTopicARN, nil
 	}
-	return "", fmt.Errorf("sns topic ARN not found for MQTT topic %s", mqttTopic)
+	return "", fmt.Errorf("sns topic ARN not found for MQTT topic %s: %w", mqttTopic, apis.ErrNoRoute)
 }
 
 func (p *Publisher) Publish(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
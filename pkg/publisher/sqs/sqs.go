@@ -99,7 +99,7 @@ func (p *Publisher) findQueueName(mqttTopic string) (string, error) {
 	if p.opts.defaultQueue != "" {
 		return p.opts.defaultQueue, nil
 	}
-	return "", fmt.Errorf("sqs queue not found for MQTT topic %s", mqttTopic)
+	return "", fmt.Errorf("sqs queue not found for MQTT topic %s: %w", mqttTopic, apis.ErrNoRoute)
 }
 
 func (p *Publisher) Publish(ctx context.Context, request *apis.PublishRequest) (*apis.PublishResponse, error) {
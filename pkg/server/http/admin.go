@@ -0,0 +1,138 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// AdminConnectionsPath lists the live MQTT connections, a single connection is inspected under AdminConnectionsPath/<id>.
+const AdminConnectionsPath = "/admin/connections"
+
+const (
+	defaultConnectionsLimit = 100
+	maxConnectionsLimit     = 1000
+)
+
+// ConnectionLister provides the live MQTT connections ordered by ID.
+type ConnectionLister interface {
+	Connections() []mqttserver.ConnInfo
+}
+
+// ConnectionsResponse is a page of the connections list.
+type ConnectionsResponse struct {
+	Total       int                   `json:"total"`          // number of the connections matching the filter
+	Connections []mqttserver.ConnInfo `json:"connections"`    // connections of the page
+	Next        uint64                `json:"next,omitempty"` // value of the after parameter of the next page, 0 on the last page
+}
+
+// connectionsFilter selects the connections by the query parameters.
+type connectionsFilter struct {
+	clientID        string
+	clientIDPrefix  string
+	username        string
+	remoteAddr      string
+	listener        string
+	protocolVersion string
+}
+
+func (f connectionsFilter) match(info mqttserver.ConnInfo) bool {
+	return (f.clientID == "" || info.ClientID == f.clientID) &&
+		strings.HasPrefix(info.ClientID, f.clientIDPrefix) &&
+		(f.username == "" || info.Username == f.username) &&
+		strings.HasPrefix(info.RemoteAddr, f.remoteAddr) &&
+		(f.listener == "" || info.Listener == f.listener) &&
+		(f.protocolVersion == "" || info.ProtocolVersion == f.protocolVersion)
+}
+
+// HandleConnections registers the admin API listing the connections.
+func (s *Server) HandleConnections(lister ConnectionLister) {
+	handler := connectionsHandler(lister)
+	s.mux.Handle(AdminConnectionsPath, handler)
+	s.mux.Handle(AdminConnectionsPath+"/", handler)
+}
+
+func connectionsHandler(lister ConnectionLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, AdminConnectionsPath), "/"); id != "" {
+			getConnection(w, lister, id)
+			return
+		}
+		listConnections(w, r, lister)
+	})
+}
+
+func getConnection(w http.ResponseWriter, lister ConnectionLister, idParam string) {
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid connection id '%s'", idParam), http.StatusBadRequest)
+		return
+	}
+	for _, info := range lister.Connections() {
+		if info.ID == id {
+			writeJSON(w, info)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("connection %d not found", id), http.StatusNotFound)
+}
+
+func listConnections(w http.ResponseWriter, r *http.Request, lister ConnectionLister) {
+	query := r.URL.Query()
+	after, err := uintParam(query.Get("after"), 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid after: %v", err), http.StatusBadRequest)
+		return
+	}
+	limit, err := uintParam(query.Get("limit"), defaultConnectionsLimit)
+	if err != nil || limit == 0 || limit > maxConnectionsLimit {
+		http.Error(w, fmt.Sprintf("invalid limit, expected 1 to %d", maxConnectionsLimit), http.StatusBadRequest)
+		return
+	}
+	filter := connectionsFilter{
+		clientID:        query.Get("client_id"),
+		clientIDPrefix:  query.Get("client_id_prefix"),
+		username:        query.Get("username"),
+		remoteAddr:      query.Get("remote_addr"),
+		listener:        query.Get("listener"),
+		protocolVersion: query.Get("protocol_version"),
+	}
+
+	res := ConnectionsResponse{Connections: []mqttserver.ConnInfo{}}
+	for _, info := range lister.Connections() {
+		if !filter.match(info) {
+			continue
+		}
+		res.Total++
+		if info.ID <= after {
+			continue
+		}
+		if uint64(len(res.Connections)) < limit {
+			res.Connections = append(res.Connections, info)
+		} else if res.Next == 0 {
+			res.Next = res.Connections[len(res.Connections)-1].ID
+		}
+	}
+	writeJSON(w, res)
+}
+
+func uintParam(s string, defaultValue uint64) (uint64, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
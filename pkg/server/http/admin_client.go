@@ -0,0 +1,94 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+)
+
+// AdminClient calls the admin API of a running server.
+type AdminClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewAdminClient creates a client of the admin API served at baseURL, e.g. http://localhost:9091.
+func NewAdminClient(baseURL string, timeout time.Duration) *AdminClient {
+	return &AdminClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Disconnect disconnects the matching clients.
+func (c *AdminClient) Disconnect(ctx context.Context, req DisconnectRequest) (*DisconnectResponse, error) {
+	var res DisconnectResponse
+	if err := c.do(ctx, http.MethodPost, AdminDisconnectPath, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Ban bans the clients and disconnects the live connections.
+func (c *AdminClient) Ban(ctx context.Context, req BanRequest) (*BanResponse, error) {
+	var res BanResponse
+	if err := c.do(ctx, http.MethodPost, AdminBansPath, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Unban removes the ban.
+func (c *AdminClient) Unban(ctx context.Context, kind string, value string) error {
+	query := url.Values{"kind": {kind}, "value": {value}}
+	return c.do(ctx, http.MethodDelete, AdminBansPath+"?"+query.Encode(), nil, nil)
+}
+
+// Bans lists the bans which are not expired.
+func (c *AdminClient) Bans(ctx context.Context) ([]ban.Entry, error) {
+	var res []ban.Entry
+	if err := c.do(ctx, http.MethodGet, AdminBansPath, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *AdminClient) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
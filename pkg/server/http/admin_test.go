@@ -0,0 +1,92 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+type testConnectionLister []mqttserver.ConnInfo
+
+func (l testConnectionLister) Connections() []mqttserver.ConnInfo {
+	return l
+}
+
+func TestListConnections(t *testing.T) {
+	lister := testConnectionLister{
+		{ID: 1, ClientID: "sensor-1", Username: "alice", RemoteAddr: "10.0.0.1:5000", ProtocolVersion: "5"},
+		{ID: 2, ClientID: "sensor-2", Username: "bob", RemoteAddr: "10.0.0.2:5000", ProtocolVersion: "3.1.1"},
+		{ID: 5, ClientID: "gateway-1", Username: "alice", RemoteAddr: "192.168.0.1:5000", ProtocolVersion: "5"},
+		{ID: 7, ClientID: "sensor-3", Username: "alice", RemoteAddr: "10.0.0.3:5000", ProtocolVersion: "5"},
+	}
+	tests := []struct {
+		name  string
+		query string
+		total int
+		ids   []uint64
+		next  uint64
+	}{
+		{name: "all", query: "", total: 4, ids: []uint64{1, 2, 5, 7}},
+		{name: "client id", query: "client_id=sensor-2", total: 1, ids: []uint64{2}},
+		{name: "client id prefix", query: "client_id_prefix=sensor-", total: 3, ids: []uint64{1, 2, 7}},
+		{name: "username and protocol version", query: "username=alice&protocol_version=5", total: 3, ids: []uint64{1, 5, 7}},
+		{name: "remote address", query: "remote_addr=10.0.0.", total: 3, ids: []uint64{1, 2, 7}},
+		{name: "first page", query: "limit=2", total: 4, ids: []uint64{1, 2}, next: 2},
+		{name: "second page", query: "limit=2&after=2", total: 4, ids: []uint64{5, 7}},
+		{name: "filtered page", query: "limit=1&after=1&username=alice", total: 3, ids: []uint64{5}, next: 5},
+		{name: "no match", query: "listener=websocket", total: 0, ids: nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+			rec := httptest.NewRecorder()
+			connectionsHandler(lister).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, AdminConnectionsPath+"?"+tc.query, nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+			a.Equal("application/json", rec.Header().Get("Content-Type"))
+
+			var res ConnectionsResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			var ids []uint64
+			for _, info := range res.Connections {
+				ids = append(ids, info.ID)
+			}
+			a.Equal(tc.total, res.Total)
+			a.Equal(tc.ids, ids)
+			a.Equal(tc.next, res.Next)
+		})
+	}
+}
+
+func TestGetConnection(t *testing.T) {
+	lister := testConnectionLister{{ID: 3, ClientID: "sensor-1", PacketsIn: 10}}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		code   int
+	}{
+		{name: "found", method: http.MethodGet, path: AdminConnectionsPath + "/3", code: http.StatusOK},
+		{name: "not found", method: http.MethodGet, path: AdminConnectionsPath + "/4", code: http.StatusNotFound},
+		{name: "invalid id", method: http.MethodGet, path: AdminConnectionsPath + "/sensor-1", code: http.StatusBadRequest},
+		{name: "invalid limit", method: http.MethodGet, path: AdminConnectionsPath + "?limit=0", code: http.StatusBadRequest},
+		{name: "invalid method", method: http.MethodPost, path: AdminConnectionsPath, code: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			connectionsHandler(lister).ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+			require.Equal(t, tc.code, rec.Code)
+			if tc.code == http.StatusOK {
+				var info mqttserver.ConnInfo
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+				assert.Equal(t, lister[0], info)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+const (
+	AdminDisconnectPath = "/admin/disconnect" // POST DisconnectRequest disconnects the matching clients
+	AdminBansPath       = "/admin/bans"       // GET lists the bans, POST BanRequest bans, DELETE ?kind=&value= unbans
+)
+
+// ConnectionDisconnector closes the live MQTT connections.
+type ConnectionDisconnector interface {
+	Disconnect(match func(mqttserver.ConnInfo) bool) int
+}
+
+// DisconnectRequest selects the clients to disconnect, all given fields must match.
+type DisconnectRequest struct {
+	ClientID string `json:"client_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"` // an IP address or a CIDR network
+}
+
+func (r DisconnectRequest) entries() ([]ban.Entry, error) {
+	var entries []ban.Entry
+	if r.ClientID != "" {
+		entries = append(entries, ban.Entry{Kind: ban.KindClientID, Value: r.ClientID})
+	}
+	if r.Username != "" {
+		entries = append(entries, ban.Entry{Kind: ban.KindUsername, Value: r.Username})
+	}
+	if r.IP != "" {
+		entries = append(entries, ban.Entry{Kind: ban.KindIP, Value: r.IP})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("one of client_id, username or ip is required")
+	}
+	for _, e := range entries {
+		if err := e.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// DisconnectResponse provides the number of closed connections.
+type DisconnectResponse struct {
+	Disconnected int `json:"disconnected"`
+}
+
+// BanRequest bans the clients with the client ID, username or IP, the live connections are disconnected.
+type BanRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason,omitempty"`
+	TTL    string `json:"ttl,omitempty"` // duration of the ban e.g. 24h, the ban does not expire if empty
+}
+
+// BanResponse provides the stored ban and the number of closed connections.
+type BanResponse struct {
+	Ban          ban.Entry `json:"ban"`
+	Disconnected int       `json:"disconnected"`
+}
+
+// HandleDisconnect registers the admin API disconnecting clients.
+func (s *Server) HandleDisconnect(disconnector ConnectionDisconnector) {
+	s.mux.Handle(AdminDisconnectPath, disconnectHandler(disconnector))
+}
+
+// HandleBans registers the admin API managing the bans.
+func (s *Server) HandleBans(list *ban.List, disconnector ConnectionDisconnector) {
+	s.mux.Handle(AdminBansPath, bansHandler(list, disconnector))
+}
+
+func disconnectHandler(disconnector ConnectionDisconnector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireJSON(w, r) {
+			return
+		}
+		var req DisconnectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		entries, err := req.entries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n := disconnector.Disconnect(func(info mqttserver.ConnInfo) bool {
+			for _, e := range entries {
+				if !matchConn(e, info) {
+					return false
+				}
+			}
+			return true
+		})
+		writeJSON(w, DisconnectResponse{Disconnected: n})
+	})
+}
+
+func bansHandler(list *ban.List, disconnector ConnectionDisconnector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, list.Entries())
+		case http.MethodPost:
+			addBan(w, r, list, disconnector)
+		case http.MethodDelete:
+			kind, value := r.URL.Query().Get("kind"), r.URL.Query().Get("value")
+			found, err := list.Remove(kind, value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, fmt.Sprintf("ban %s '%s' not found", kind, value), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func addBan(w http.ResponseWriter, r *http.Request, list *ban.List, disconnector ConnectionDisconnector) {
+	if !requireJSON(w, r) {
+		return
+	}
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	entry := ban.Entry{Kind: req.Kind, Value: req.Value, Reason: req.Reason, Created: time.Now()}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl '%s'", req.TTL), http.StatusBadRequest)
+			return
+		}
+		expires := entry.Created.Add(ttl)
+		entry.Expires = &expires
+	}
+	if err := entry.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := list.Add(entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	n := disconnector.Disconnect(func(info mqttserver.ConnInfo) bool {
+		return matchConn(entry, info)
+	})
+	writeJSON(w, BanResponse{Ban: entry, Disconnected: n})
+}
+
+// requireJSON rejects request bodies which are not JSON. Browsers cannot send a cross-site JSON request without
+// a CORS preflight, which is never allowed, so a web page cannot call the admin API on behalf of an operator.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+func matchConn(e ban.Entry, info mqttserver.ConnInfo) bool {
+	var ip net.IP
+	if host, _, err := net.SplitHostPort(info.RemoteAddr); err == nil {
+		ip = net.ParseIP(host)
+	}
+	return e.Match(info.ClientID, info.Username, ip)
+}
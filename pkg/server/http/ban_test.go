@@ -0,0 +1,162 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/ban"
+	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+)
+
+// testDisconnector records the connections which would be disconnected.
+type testDisconnector struct {
+	conns        []mqttserver.ConnInfo
+	disconnected []uint64
+}
+
+func (d *testDisconnector) Disconnect(match func(mqttserver.ConnInfo) bool) int {
+	n := 0
+	for _, info := range d.conns {
+		if match(info) {
+			d.disconnected = append(d.disconnected, info.ID)
+			n++
+		}
+	}
+	return n
+}
+
+func newTestDisconnector() *testDisconnector {
+	return &testDisconnector{conns: []mqttserver.ConnInfo{
+		{ID: 1, ClientID: "sensor-1", Username: "alice", RemoteAddr: "10.0.0.1:5000"},
+		{ID: 2, ClientID: "sensor-2", Username: "alice", RemoteAddr: "10.0.0.2:5000"},
+		{ID: 3, ClientID: "sensor-3", Username: "bob", RemoteAddr: "192.0.2.1:5000"},
+		{ID: 4, ClientID: "sensor-4", Username: "bob", RemoteAddr: "[2001:db8::1]:5000"},
+	}}
+}
+
+func newTestAdminClient(t *testing.T, list *ban.List, disconnector ConnectionDisconnector) *AdminClient {
+	s := NewAdmin(log.NewDefaultLogger())
+	s.HandleDisconnect(disconnector)
+	s.HandleBans(list, disconnector)
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+	return NewAdminClient(ts.URL+"/", 5*time.Second)
+}
+
+func TestDisconnect(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          DisconnectRequest
+		disconnected []uint64
+	}{
+		{name: "client id", req: DisconnectRequest{ClientID: "sensor-2"}, disconnected: []uint64{2}},
+		{name: "username", req: DisconnectRequest{Username: "alice"}, disconnected: []uint64{1, 2}},
+		{name: "ip", req: DisconnectRequest{IP: "2001:db8::1"}, disconnected: []uint64{4}},
+		{name: "cidr", req: DisconnectRequest{IP: "10.0.0.0/8"}, disconnected: []uint64{1, 2}},
+		{name: "all selectors match", req: DisconnectRequest{Username: "alice", IP: "10.0.0.1"}, disconnected: []uint64{1}},
+		{name: "no match", req: DisconnectRequest{ClientID: "sensor-5"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			disconnector := newTestDisconnector()
+			client := newTestAdminClient(t, nil, disconnector)
+
+			res, err := client.Disconnect(context.Background(), tc.req)
+			require.NoError(t, err)
+			assert.Equal(t, len(tc.disconnected), res.Disconnected)
+			assert.Equal(t, tc.disconnected, disconnector.disconnected)
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		client := newTestAdminClient(t, nil, newTestDisconnector())
+		_, err := client.Disconnect(context.Background(), DisconnectRequest{})
+		assert.ErrorContains(t, err, "400 Bad Request")
+		_, err = client.Disconnect(context.Background(), DisconnectRequest{IP: "host"})
+		assert.ErrorContains(t, err, "400 Bad Request")
+	})
+}
+
+func TestBans(t *testing.T) {
+	a := assert.New(t)
+	list, err := ban.Open("")
+	require.NoError(t, err)
+	disconnector := newTestDisconnector()
+	client := newTestAdminClient(t, list, disconnector)
+	ctx := context.Background()
+
+	res, err := client.Ban(ctx, BanRequest{Kind: ban.KindUsername, Value: "bob", Reason: "flooding", TTL: "1h"})
+	require.NoError(t, err)
+	a.Equal(2, res.Disconnected)
+	a.Equal([]uint64{3, 4}, disconnector.disconnected)
+	a.Equal("bob", res.Ban.Value)
+	require.NotNil(t, res.Ban.Expires)
+	a.WithinDuration(time.Now().Add(time.Hour), *res.Ban.Expires, time.Minute)
+
+	_, err = client.Ban(ctx, BanRequest{Kind: ban.KindIP, Value: "192.0.2.0/24"})
+	require.NoError(t, err)
+	_, banned := list.Banned("sensor-5", "carol", []byte{192, 0, 2, 9})
+	a.True(banned)
+
+	entries, err := client.Bans(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	a.Equal(ban.KindIP, entries[0].Kind)
+	a.Nil(entries[0].Expires)
+	a.Equal(ban.KindUsername, entries[1].Kind)
+
+	require.NoError(t, client.Unban(ctx, ban.KindUsername, "bob"))
+	a.ErrorContains(client.Unban(ctx, ban.KindUsername, "bob"), "404 Not Found")
+	entries, err = client.Bans(ctx)
+	require.NoError(t, err)
+	a.Len(entries, 1)
+
+	_, err = client.Ban(ctx, BanRequest{Kind: ban.KindClientID, Value: "sensor-1", TTL: "-1h"})
+	a.ErrorContains(err, "invalid ttl")
+	_, err = client.Ban(ctx, BanRequest{Kind: "topic", Value: "a/b"})
+	a.ErrorContains(err, "unsupported kind")
+
+	rec := httptest.NewRecorder()
+	bansHandler(list, disconnector).ServeHTTP(rec, httptest.NewRequest(http.MethodPut, AdminBansPath, nil))
+	a.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestAdminRequiresJSON(t *testing.T) {
+	list, err := ban.Open("")
+	require.NoError(t, err)
+	disconnector := newTestDisconnector()
+
+	tests := []struct {
+		name        string
+		handler     http.Handler
+		path        string
+		contentType string
+		code        int
+	}{
+		{name: "disconnect form", handler: disconnectHandler(disconnector), path: AdminDisconnectPath, contentType: "application/x-www-form-urlencoded", code: http.StatusUnsupportedMediaType},
+		{name: "disconnect text", handler: disconnectHandler(disconnector), path: AdminDisconnectPath, contentType: "text/plain", code: http.StatusUnsupportedMediaType},
+		{name: "disconnect json", handler: disconnectHandler(disconnector), path: AdminDisconnectPath, contentType: "application/json; charset=utf-8", code: http.StatusOK},
+		{name: "ban without content type", handler: bansHandler(list, disconnector), path: AdminBansPath, code: http.StatusUnsupportedMediaType},
+		{name: "ban text", handler: bansHandler(list, disconnector), path: AdminBansPath, contentType: "text/plain", code: http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(`{"kind": "client-id", "value": "sensor-1", "client_id": "sensor-1"}`))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+	assert.Equal(t, []uint64{1}, disconnector.disconnected)
+	assert.Empty(t, list.Entries())
+}
@@ -15,6 +15,7 @@ import (
 type Server struct {
 	logger log.Logger
 	prober *prober.HTTPProbe
+	served string // description of the served endpoints used in the logs
 
 	mux *http.ServeMux
 	srv *http.Server
@@ -38,6 +39,24 @@ func New(logger log.Logger, registry *prometheus.Registry, prober *prober.HTTPPr
 	return &Server{
 		logger: logger.WithField("service", "http/server"),
 		prober: prober,
+		served: "HTTP requests and metrics",
+		mux:    mux,
+		srv:    &http.Server{Addr: options.listen, Handler: mux},
+		opts:   options,
+	}
+}
+
+// NewAdmin creates a Server for the admin API only, so that it can listen on an address not reachable by the clients.
+func NewAdmin(logger log.Logger, opts ...Option) *Server {
+	options := options{}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	mux := http.NewServeMux()
+	return &Server{
+		logger: logger.WithField("service", "http/admin"),
+		served: "admin API requests",
 		mux:    mux,
 		srv:    &http.Server{Addr: options.listen, Handler: mux},
 		opts:   options,
@@ -45,8 +64,8 @@ func New(logger log.Logger, registry *prometheus.Registry, prober *prober.HTTPPr
 }
 
 func (s *Server) ListenAndServe() error {
-	s.logger.WithField("address", s.opts.listen).Infof("listening for HTTP requests and metrics")
-	return fmt.Errorf("serve HTTP and metrics: %w", s.srv.ListenAndServe())
+	s.logger.WithField("address", s.opts.listen).Infof("listening for %s", s.served)
+	return fmt.Errorf("serve %s: %w", s.served, s.srv.ListenAndServe())
 }
 
 func (s *Server) Shutdown(err error) {
@@ -1,6 +1,9 @@
 package http
 
 import (
+	"net/http"
+	"net/http/httptest"
+
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
 	"github.com/grepplabs/mqtt-proxy/pkg/prober"
 	"github.com/prometheus/client_golang/prometheus"
@@ -33,3 +36,21 @@ func TestNew(t *testing.T) {
 	a.Same(server.mux, server.srv.Handler)
 	a.Equal(server.opts.listen, server.srv.Addr)
 }
+
+func TestNewAdmin(t *testing.T) {
+	a := assert.New(t)
+
+	server := NewAdmin(log.NewDefaultLogger(),
+		WithListen("127.0.0.1:9091"),
+		WithGracePeriod(5*time.Second),
+	)
+
+	a.Nil(server.prober)
+	a.Equal("127.0.0.1:9091", server.srv.Addr)
+	a.Equal(5*time.Second, server.opts.gracePeriod)
+	a.Same(server.mux, server.srv.Handler)
+
+	// the admin server does not serve the metrics and the probes
+	_, pattern := server.mux.Handler(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	a.Empty(pattern)
+}
@@ -2,14 +2,45 @@ package mqtt
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
 	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
+	"github.com/grepplabs/mqtt-proxy/pkg/mqtt/websocket"
 	"github.com/grepplabs/mqtt-proxy/pkg/prober"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// names of the built-in listeners
+const (
+	DefaultListenerName   = "default"
+	WebSocketListenerName = "websocket"
+)
+
+// Listener describes an additional MQTT listener of the server.
+type Listener struct {
+	Name      string      // unique name of the listener
+	Network   string      // network of the address, tcp if empty
+	Address   string      // address to listen on, unix:// and systemd:// addresses are supported
+	TLSConfig *tls.Config // optional TLS config
+
+	MaxPacketSize *uint32 // optional maximum packet size, overrides the maximum packet size of the server
+}
+
+// CIDRConnLimit is the maximum number of connections from all sources of a network.
+type CIDRConnLimit = mqttserver.CIDRConnLimit
+
+// RejectReason is the reason why the admission control rejected a connection.
+type RejectReason = mqttserver.RejectReason
+
+// RejectReasons lists the reasons of rejected connections.
+var RejectReasons = mqttserver.RejectReasons
+
+// ConnInfo is a snapshot of a live connection.
+type ConnInfo = mqttserver.ConnInfo
+
 type Server struct {
 	logger log.Logger
 	prober *prober.HTTPProbe
@@ -38,7 +69,34 @@ func New(logger log.Logger, _ *prometheus.Registry, prober *prober.HTTPProbe, op
 		WriterBufferSize: options.writerBufferSize,
 		ReaderBufferSize: options.readerBufferSize,
 		TLSConfig:        options.tlsConfig,
+		UnixSocketMode:   options.socketMode,
+		ServerReference:  options.serverReference,
+		ClientIDPolicy:   options.clientIDPolicy,
 		ErrorLog:         logger,
+
+		MaxPacketSize:       options.maxPacketSize,
+		MaxPacketSizeByType: options.maxPacketSizeByType,
+		ReceiveMaximum:      options.receiveMaximum,
+		Strict:              options.strict,
+		Capture:             options.capture,
+	}
+	for _, l := range options.listeners {
+		if l.MaxPacketSize == nil {
+			continue
+		}
+		if s.MaxPacketSizeByListener == nil {
+			s.MaxPacketSizeByListener = make(map[string]uint32)
+		}
+		s.MaxPacketSizeByListener[l.Name] = *l.MaxPacketSize
+	}
+	if options.maxConns > 0 || options.maxConnsPerIP > 0 || len(options.maxConnsPerCIDR) != 0 || options.acceptRate > 0 {
+		s.Admission = &mqttserver.AdmissionControl{
+			MaxConns:        options.maxConns,
+			MaxConnsPerIP:   options.maxConnsPerIP,
+			MaxConnsPerCIDR: options.maxConnsPerCIDR,
+			AcceptRate:      options.acceptRate,
+			AcceptBurst:     options.acceptBurst,
+		}
 	}
 
 	return &Server{
@@ -58,19 +116,133 @@ func (s *Server) TotalConnections() int64 {
 	return s.srv.NumTotalConn()
 }
 
+func (s *Server) RejectedConnections(reason RejectReason) int64 {
+	return s.srv.NumRejectedConn(reason)
+}
+
+func (s *Server) ClientIDConflicts() int64 {
+	return s.srv.NumClientIDConflicts()
+}
+
+// Connections provides the snapshots of the live connections ordered by ID.
+func (s *Server) Connections() []ConnInfo {
+	return s.srv.Connections()
+}
+
+// Disconnect closes the live connections matching the filter and returns the number of closed connections.
+func (s *Server) Disconnect(match func(ConnInfo) bool) int {
+	return s.srv.Disconnect(match)
+}
+
+// ListenAndServe serves the default listener, the optional WebSocket listener and the additional listeners.
+// It returns when the first of the listeners fails.
 func (s *Server) ListenAndServe() error {
-	if s.opts.tlsConfig == nil {
-		s.logger.WithField("address", s.opts.listen).Infof("listening for MQTT requests")
-		return fmt.Errorf("serve MQTT: %w", s.srv.ListenAndServe())
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l namedListener) {
+			errs <- fmt.Errorf("serve MQTT listener %s: %w", l.name, s.srv.ServeNamed(l.name, l.listener))
+		}(l)
+	}
+	return <-errs
+}
+
+type namedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// listen opens all listeners, so that an unavailable address is reported before any connection is accepted.
+func (s *Server) listen() ([]namedListener, error) {
+	var listeners []namedListener
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.listener.Close()
+		}
+	}
+	configs := append([]Listener{{
+		Name:      DefaultListenerName,
+		Network:   s.opts.network,
+		Address:   s.opts.listen,
+		TLSConfig: s.opts.tlsConfig,
+	}}, s.opts.listeners...)
+
+	for _, cfg := range configs {
+		l, err := s.listenMQTT(cfg)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, namedListener{name: cfg.Name, listener: l})
+	}
+	if s.opts.webSocketListen != "" {
+		l, err := s.listenWebSocket()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, namedListener{name: WebSocketListenerName, listener: l})
+	}
+	return listeners, nil
+}
+
+func (s *Server) listenMQTT(cfg Listener) (net.Listener, error) {
+	l, err := s.listenConfig().Listen(cfg.Network, cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("listen MQTT listener %s: %w", cfg.Name, err)
+	}
+	l = s.proxyProtocolListener(l)
+	logger := s.logger.WithField("listener", cfg.Name).WithField("address", cfg.Address)
+	if cfg.TLSConfig == nil {
+		logger.Infof("listening for MQTT requests")
+		return l, nil
+	}
+	logger.Infof("listening TLS for MQTT requests")
+	return tls.NewListener(l, cfg.TLSConfig), nil
+}
+
+func (s *Server) listenWebSocket() (net.Listener, error) {
+	l, err := s.listenConfig().Listen("tcp", s.opts.webSocketListen)
+	if err != nil {
+		return nil, fmt.Errorf("listen MQTT listener %s: %w", WebSocketListenerName, err)
+	}
+	l = s.proxyProtocolListener(l)
+	logger := s.logger.WithField("listener", WebSocketListenerName).WithField("address", s.opts.webSocketListen)
+	if s.opts.webSocketTLSConfig == nil {
+		logger.Infof("listening for MQTT over WebSocket requests")
 	} else {
-		s.logger.WithField("address", s.opts.listen).Infof("listening TLS for MQTT request")
-		return fmt.Errorf("serve TLS MQTT: %w ", s.srv.ListenAndServeTLS(s.opts.tlsConfig))
+		logger.Infof("listening TLS for MQTT over WebSocket requests")
+		l = tls.NewListener(l, s.opts.webSocketTLSConfig)
+	}
+	return websocket.NewListener(l,
+		websocket.WithPath(s.opts.webSocketPath),
+		websocket.WithAllowedOrigins(s.opts.webSocketAllowedOrigins),
+		websocket.WithErrorLog(logger),
+	), nil
+}
+
+func (s *Server) listenConfig() *mqttserver.ListenConfig {
+	return &mqttserver.ListenConfig{UnixSocketMode: s.opts.socketMode}
+}
+
+// proxyProtocolListener wraps the network listener, the PROXY protocol header precedes the TLS handshake.
+func (s *Server) proxyProtocolListener(l net.Listener) net.Listener {
+	if !s.opts.proxyProtocol {
+		return l
+	}
+	return &mqttserver.ProxyProtocolListener{
+		Listener:      l,
+		Trusted:       s.opts.proxyProtocolTrusted,
+		HeaderTimeout: s.opts.proxyProtocolHeaderTimeout,
 	}
 }
 
 // Shutdown gracefully shuts down the server by waiting
 // for specified amount of time (by gracePeriod)
-// for connections to return to idle and then shut down.
+// for connections to be drained and then shut down.
 func (s *Server) Shutdown(err error) {
 	defer s.logger.WithError(err).Infof("internal server shutdown")
 	if s.opts.gracePeriod == 0 {
@@ -3,10 +3,12 @@ package mqtt
 import (
 	"crypto/tls"
 	"github.com/grepplabs/mqtt-proxy/pkg/log"
+	mqttproto "github.com/grepplabs/mqtt-proxy/pkg/mqtt/codec/proto"
 	mqtthandler "github.com/grepplabs/mqtt-proxy/pkg/mqtt/handler"
 	"github.com/grepplabs/mqtt-proxy/pkg/prober"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -19,6 +21,7 @@ func TestNew(t *testing.T) {
 	serverProber := prober.NewHTTP()
 	tlsCfg := &tls.Config{}
 	handler := &mqtthandler.MQTTHandler{}
+	sidecarMaxPacketSize := uint32(0)
 
 	server := New(logger, registry, serverProber,
 		WithNetwork("tcp"),
@@ -28,7 +31,27 @@ func TestNew(t *testing.T) {
 		WithIdleTimeout(12*time.Second),
 		WithReaderBufferSize(2048),
 		WithWriterBufferSize(4096),
+		WithMaxPacketSize(1024),
+		WithMaxPacketSizeByType(map[byte]uint32{mqttproto.PUBLISH: 2048}),
+		WithReceiveMaximum(50),
+		WithStrict(true),
 		WithTLSConfig(tlsCfg),
+		WithWebSocketListen("0.0.0.0:8083"),
+		WithWebSocketPath("/ws"),
+		WithWebSocketAllowedOrigins([]string{"*"}),
+		WithWebSocketTLSConfig(tlsCfg),
+		WithProxyProtocol(true),
+		WithProxyProtocolHeaderTimeout(3*time.Second),
+		WithMaxConnections(100),
+		WithMaxConnectionsPerIP(10),
+		WithAcceptRate(5),
+		WithAcceptBurst(20),
+		WithServerReference("mqtt-2:1883"),
+		WithClientIDPolicy("reject-new"),
+		WithListeners([]Listener{
+			{Name: "internal", Address: "127.0.0.1:1884"},
+			{Name: "sidecar", Address: "unix:///run/mqtt.sock", MaxPacketSize: &sidecarMaxPacketSize},
+		}),
 		WithHandler(handler),
 	)
 
@@ -45,7 +68,22 @@ func TestNew(t *testing.T) {
 	a.Equal(12*time.Second, server.opts.idleTimeout)
 	a.Equal(2048, server.opts.readerBufferSize)
 	a.Equal(4096, server.opts.writerBufferSize)
+	a.Equal(uint32(1024), server.opts.maxPacketSize)
+	a.Equal(map[byte]uint32{mqttproto.PUBLISH: 2048}, server.opts.maxPacketSizeByType)
+	a.Equal(uint16(50), server.opts.receiveMaximum)
 	a.Equal(handler, server.opts.handler)
+	a.Equal("0.0.0.0:8083", server.opts.webSocketListen)
+	a.Equal("/ws", server.opts.webSocketPath)
+	a.Equal([]string{"*"}, server.opts.webSocketAllowedOrigins)
+	a.Same(tlsCfg, server.opts.webSocketTLSConfig)
+	a.True(server.opts.proxyProtocol)
+	a.Equal(3*time.Second, server.opts.proxyProtocolHeaderTimeout)
+	a.Equal(100, server.opts.maxConns)
+	a.Equal(10, server.opts.maxConnsPerIP)
+	a.Equal(5.0, server.opts.acceptRate)
+	a.Equal(20, server.opts.acceptBurst)
+	a.Equal("mqtt-2:1883", server.opts.serverReference)
+	a.Equal("reject-new", server.opts.clientIDPolicy)
 
 	a.Equal("tcp", server.srv.Network)
 	a.Equal("0.0.0.0:1883", server.srv.Addr)
@@ -54,7 +92,49 @@ func TestNew(t *testing.T) {
 	a.Equal(12*time.Second, server.srv.IdleTimeout)
 	a.Equal(2048, server.srv.ReaderBufferSize)
 	a.Equal(4096, server.srv.WriterBufferSize)
+	a.Equal(uint32(1024), server.srv.MaxPacketSize)
+	a.Equal(map[byte]uint32{mqttproto.PUBLISH: 2048}, server.srv.MaxPacketSizeByType)
+	a.Equal(map[string]uint32{"sidecar": 0}, server.srv.MaxPacketSizeByListener)
+	a.Equal(uint16(50), server.srv.ReceiveMaximum)
+	a.True(server.srv.Strict)
 	a.NotNil(server.srv.ErrorLog)
 	a.Equal(handler, server.srv.Handler)
+	a.Equal("mqtt-2:1883", server.srv.ServerReference)
+	a.Equal("reject-new", server.srv.ClientIDPolicy)
+	a.Equal(100, server.srv.Admission.MaxConns)
+	a.Equal(10, server.srv.Admission.MaxConnsPerIP)
+	a.Equal(5.0, server.srv.Admission.AcceptRate)
+	a.Equal(20, server.srv.Admission.AcceptBurst)
 
 }
+
+func TestListen(t *testing.T) {
+	a := assert.New(t)
+
+	logger := log.NewDefaultLogger()
+	server := New(logger, prometheus.NewRegistry(), prober.NewHTTP(),
+		WithListen("127.0.0.1:0"),
+		WithListeners([]Listener{
+			{Name: "internal", Address: "127.0.0.1:0"},
+			{Name: "secure", Network: "tcp4", Address: "127.0.0.1:0", TLSConfig: &tls.Config{}},
+			{Name: "sidecar", Address: "unix://" + filepath.Join(t.TempDir(), "mqtt.sock")},
+		}),
+		WithWebSocketListen("127.0.0.1:0"),
+	)
+	listeners, err := server.listen()
+	a.NoError(err)
+	var names []string
+	for _, l := range listeners {
+		names = append(names, l.name)
+		_ = l.listener.Close()
+	}
+	a.Equal([]string{DefaultListenerName, "internal", "secure", "sidecar", WebSocketListenerName}, names)
+	a.Equal("unix", listeners[3].listener.Addr().Network())
+
+	server = New(logger, prometheus.NewRegistry(), prober.NewHTTP(),
+		WithListen("127.0.0.1:0"),
+		WithListeners([]Listener{{Name: "invalid", Address: "127.0.0.1:-1"}}),
+	)
+	_, err = server.listen()
+	a.ErrorContains(err, "listen MQTT listener invalid")
+}
@@ -2,6 +2,8 @@ package mqtt
 
 import (
 	"crypto/tls"
+	"net"
+	"os"
 	"time"
 
 	mqttserver "github.com/grepplabs/mqtt-proxy/pkg/mqtt/server"
@@ -11,15 +13,43 @@ type options struct {
 	gracePeriod  time.Duration
 	listen       string
 	network      string
+	socketMode   os.FileMode
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	idleTimeout  time.Duration
 
+	serverReference string
+	clientIDPolicy  string
+
 	readerBufferSize int
 	writerBufferSize int
 
+	maxPacketSize       uint32
+	maxPacketSizeByType map[byte]uint32
+	receiveMaximum      uint16
+	strict              bool
+
+	capture mqttserver.Capture
+
 	tlsConfig *tls.Config
 
+	webSocketListen         string
+	webSocketPath           string
+	webSocketAllowedOrigins []string
+	webSocketTLSConfig      *tls.Config
+
+	listeners []Listener
+
+	proxyProtocol              bool
+	proxyProtocolTrusted       []*net.IPNet
+	proxyProtocolHeaderTimeout time.Duration
+
+	maxConns        int
+	maxConnsPerIP   int
+	maxConnsPerCIDR []CIDRConnLimit
+	acceptRate      float64
+	acceptBurst     int
+
 	handler mqttserver.Handler
 }
 
@@ -51,6 +81,20 @@ func WithNetwork(s string) Option {
 	})
 }
 
+// WithServerReference sets the Server Reference sent to MQTT 5 clients disconnected on shutdown.
+func WithServerReference(s string) Option {
+	return optionFunc(func(o *options) {
+		o.serverReference = s
+	})
+}
+
+// WithUnixSocketMode sets the permissions of the unix domain sockets created by the listeners.
+func WithUnixSocketMode(mode os.FileMode) Option {
+	return optionFunc(func(o *options) {
+		o.socketMode = mode
+	})
+}
+
 func WithTLSConfig(cfg *tls.Config) Option {
 	return optionFunc(func(o *options) {
 		o.tlsConfig = cfg
@@ -92,3 +136,126 @@ func WithWriterBufferSize(i int) Option {
 		o.writerBufferSize = i
 	})
 }
+
+func WithMaxPacketSize(n uint32) Option {
+	return optionFunc(func(o *options) {
+		o.maxPacketSize = n
+	})
+}
+
+func WithMaxPacketSizeByType(m map[byte]uint32) Option {
+	return optionFunc(func(o *options) {
+		o.maxPacketSizeByType = m
+	})
+}
+
+// WithReceiveMaximum limits the number of inflight QoS 1 and 2 publishes per connection, 0 means no limit.
+func WithReceiveMaximum(n uint16) Option {
+	return optionFunc(func(o *options) {
+		o.receiveMaximum = n
+	})
+}
+
+func WithStrict(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.strict = b
+	})
+}
+
+func WithCapture(c mqttserver.Capture) Option {
+	return optionFunc(func(o *options) {
+		o.capture = c
+	})
+}
+
+func WithWebSocketListen(s string) Option {
+	return optionFunc(func(o *options) {
+		o.webSocketListen = s
+	})
+}
+
+func WithWebSocketPath(s string) Option {
+	return optionFunc(func(o *options) {
+		o.webSocketPath = s
+	})
+}
+
+func WithWebSocketAllowedOrigins(origins []string) Option {
+	return optionFunc(func(o *options) {
+		o.webSocketAllowedOrigins = origins
+	})
+}
+
+func WithWebSocketTLSConfig(cfg *tls.Config) Option {
+	return optionFunc(func(o *options) {
+		o.webSocketTLSConfig = cfg
+	})
+}
+
+// WithListeners adds listeners to the default listener configured by WithListen, WithNetwork and WithTLSConfig.
+func WithListeners(listeners []Listener) Option {
+	return optionFunc(func(o *options) {
+		o.listeners = listeners
+	})
+}
+
+// WithProxyProtocol enables reading the PROXY protocol header on all listeners.
+func WithProxyProtocol(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.proxyProtocol = b
+	})
+}
+
+// WithProxyProtocolTrusted sets the sources required to send the PROXY protocol header, no source is trusted if empty.
+func WithProxyProtocolTrusted(trusted []*net.IPNet) Option {
+	return optionFunc(func(o *options) {
+		o.proxyProtocolTrusted = trusted
+	})
+}
+
+func WithProxyProtocolHeaderTimeout(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.proxyProtocolHeaderTimeout = d
+	})
+}
+
+// WithMaxConnections limits the number of connections, 0 means no limit.
+func WithMaxConnections(n int) Option {
+	return optionFunc(func(o *options) {
+		o.maxConns = n
+	})
+}
+
+// WithMaxConnectionsPerIP limits the number of connections from a source IP, 0 means no limit.
+func WithMaxConnectionsPerIP(n int) Option {
+	return optionFunc(func(o *options) {
+		o.maxConnsPerIP = n
+	})
+}
+
+// WithMaxConnectionsPerCIDR limits the number of connections from all sources of the networks.
+func WithMaxConnectionsPerCIDR(limits []CIDRConnLimit) Option {
+	return optionFunc(func(o *options) {
+		o.maxConnsPerCIDR = limits
+	})
+}
+
+// WithAcceptRate limits the number of connections accepted per second, 0 means no limit.
+func WithAcceptRate(rate float64) Option {
+	return optionFunc(func(o *options) {
+		o.acceptRate = rate
+	})
+}
+
+func WithAcceptBurst(n int) Option {
+	return optionFunc(func(o *options) {
+		o.acceptBurst = n
+	})
+}
+
+// WithClientIDPolicy sets how connections with the same client identifier are resolved, takeover or reject-new.
+func WithClientIDPolicy(policy string) Option {
+	return optionFunc(func(o *options) {
+		o.clientIDPolicy = policy
+	})
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket is refilled with rate tokens per second up to burst tokens. It is not safe for concurrent use.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full bucket.
+func NewTokenBucket(rate float64, burst float64, now time.Time) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Allow takes n tokens if available. Requests larger than the burst are allowed when the bucket is full.
+func (b *TokenBucket) Allow(now time.Time, n float64) bool {
+	if !b.Available(now, n) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Available reports whether Allow would take n tokens.
+func (b *TokenBucket) Available(now time.Time, n float64) bool {
+	b.refill(now)
+	return b.tokens >= math.Min(n, b.burst)
+}
+
+// Take takes n tokens and returns the duration to wait until the tokens are available.
+// The debt is limited to one burst, so the wait never exceeds burst / rate.
+func (b *TokenBucket) Take(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens = math.Max(b.tokens-n, -b.burst)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Full reports whether the bucket would be full at the time, i.e. it is equivalent to a new bucket.
+func (b *TokenBucket) Full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := NewTokenBucket(2, 2, now)
+
+	a.True(b.Allow(now, 1))
+	a.True(b.Allow(now, 1))
+	a.False(b.Allow(now, 1))
+	a.True(b.Allow(now.Add(500*time.Millisecond), 1))
+	a.False(b.Allow(now.Add(500*time.Millisecond), 1))
+	// tokens are refilled up to the burst
+	now = now.Add(time.Hour)
+	a.True(b.Full(now))
+	a.True(b.Allow(now, 1))
+	a.True(b.Allow(now, 1))
+	a.False(b.Allow(now, 1))
+	a.False(b.Full(now))
+}
+
+func TestTokenBucketAllowLargerThanBurst(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := NewTokenBucket(100, 100, now)
+
+	a.True(b.Allow(now, 250))
+	a.False(b.Allow(now.Add(time.Second), 250))
+	a.True(b.Allow(now.Add(2500*time.Millisecond), 250))
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := NewTokenBucket(10, 10, now)
+
+	a.Equal(time.Duration(0), b.Take(now, 10))
+	a.Equal(500*time.Millisecond, b.Take(now, 5))
+	a.Equal(time.Second, b.Take(now, 5))
+	// the debt is limited to one burst
+	a.Equal(time.Second, b.Take(now, 1000))
+}